@@ -0,0 +1,288 @@
+package pipes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAdminCanceled is returned for executions canceled via an Admin.
+var ErrAdminCanceled = errors.New("canceled by admin")
+
+// Admin tracks running executions for introspection and control, e.g. via
+// its HTTP handler.  Executions are tracked with WithAdmin.
+type Admin struct {
+	// Clock, if non-nil, is used instead of the real clock to compute
+	// uptimes.
+	Clock Clock
+
+	mu     sync.Mutex
+	nextID int
+	execs  map[int]*adminExec
+}
+
+type adminExec struct {
+	id     int
+	c      *config
+	start  time.Time
+	stdout int64
+	stderr int64
+
+	// mu protects pids, which holds the pid of each stage once started.
+	mu   sync.Mutex
+	pids []int
+}
+
+// ExecutionInfo describes a running execution tracked by an Admin.
+type ExecutionInfo struct {
+	ID        int           `json:"id"`
+	RunID     string        `json:"run_id"`
+	Label     string        `json:"label,omitempty"`
+	Principal string        `json:"principal,omitempty"`
+	Start     time.Time     `json:"start"`
+	Uptime    time.Duration `json:"uptime_ns"`
+	Stages    []StageInfo   `json:"stages"`
+	// StdoutBytes and StderrBytes count the output written so far.
+	StdoutBytes int64 `json:"stdout_bytes"`
+	StderrBytes int64 `json:"stderr_bytes"`
+}
+
+// StageInfo describes a command of a running execution.
+type StageInfo struct {
+	Args []string `json:"args"`
+	// Pid is the command's pid once started.
+	Pid int `json:"pid,omitempty"`
+	// Running is set if the command has been started and hasn't exited.
+	Running bool `json:"running"`
+}
+
+// NewAdmin returns an Admin tracking no executions.
+func NewAdmin() *Admin {
+	return &Admin{execs: make(map[int]*adminExec)}
+}
+
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+// WithAdmin tracks the execution with a, from when its first command is
+// started until it completes.  The execution's output is copied through this
+// process to count it, rather than written by the commands directly.
+func WithAdmin(a *Admin) Option {
+	return func(c *config) {
+		e := &adminExec{c: c}
+
+		c.onSetup(func(c *config) error {
+			e.pids = make([]int, len(c.cmds))
+			stdout, stderr := c.stdout, c.stderr
+			if stdout == nil {
+				stdout = ioutil.Discard
+			}
+			if stderr == nil {
+				stderr = ioutil.Discard
+			}
+			c.stdout = &countWriter{stdout, &e.stdout}
+			c.stderr = &countWriter{stderr, &e.stderr}
+			return nil
+		})
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			i := stageIndex(c.cmds, cmd)
+			// Register once the execution can be canceled.
+			if i == 0 {
+				a.mu.Lock()
+				a.nextID++
+				e.id = a.nextID
+				e.start = clockOrReal(a.Clock).Now()
+				a.execs[e.id] = e
+				a.mu.Unlock()
+			}
+			if err := start(); err != nil {
+				return err
+			}
+			e.mu.Lock()
+			e.pids[i] = cmd.Process.Pid
+			e.mu.Unlock()
+			return nil
+		}, nil)
+
+		c.onRelease(func() {
+			a.mu.Lock()
+			delete(a.execs, e.id)
+			a.mu.Unlock()
+		})
+	}
+}
+
+func (a *Admin) lookup(id int) (*adminExec, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.execs[id]
+	if !ok {
+		return nil, fmt.Errorf("execution %d not running", id)
+	}
+	return e, nil
+}
+
+// Running returns the running executions, oldest first.
+func (a *Admin) Running() []ExecutionInfo {
+	a.mu.Lock()
+	execs := make([]*adminExec, 0, len(a.execs))
+	for _, e := range a.execs {
+		execs = append(execs, e)
+	}
+	a.mu.Unlock()
+	sort.Slice(execs, func(i, j int) bool { return execs[i].id < execs[j].id })
+
+	now := clockOrReal(a.Clock).Now()
+	infos := make([]ExecutionInfo, len(execs))
+	for i, e := range execs {
+		info := ExecutionInfo{
+			ID:          e.id,
+			RunID:       e.c.runID,
+			Label:       e.c.label,
+			Principal:   e.c.principal,
+			Start:       e.start,
+			Uptime:      now.Sub(e.start),
+			StdoutBytes: atomic.LoadInt64(&e.stdout),
+			StderrBytes: atomic.LoadInt64(&e.stderr),
+		}
+		e.mu.Lock()
+		for j, cmd := range e.c.cmds {
+			pid := e.pids[j]
+			info.Stages = append(info.Stages, StageInfo{
+				Args:    append([]string(nil), cmd.Args...),
+				Pid:     pid,
+				Running: pid != 0 && isTracked(pid),
+			})
+		}
+		e.mu.Unlock()
+		infos[i] = info
+	}
+	return infos
+}
+
+// Cancel kills the commands of the execution with the given ID, failing it
+// with ErrAdminCanceled.
+func (a *Admin) Cancel(id int) error {
+	e, err := a.lookup(id)
+	if err != nil {
+		return err
+	}
+	e.c.abort(ErrAdminCanceled)
+	return nil
+}
+
+// Signal sends sig to the running commands of the execution with the given
+// ID.
+func (a *Admin) Signal(id int, sig os.Signal) error {
+	e, err := a.lookup(id)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, pid := range e.pids {
+		// Only signal commands that haven't been waited on, whose
+		// pids can't have been reused.
+		if pid == 0 || !isTracked(pid) {
+			continue
+		}
+		if err := e.c.cmds[i].Process.Signal(sig); err != nil {
+			return fmt.Errorf("%s %s", e.c.cmds[i].Path, err.Error())
+		}
+	}
+	return nil
+}
+
+// Handler returns an http.Handler exposing the Admin, wrapped in auth, which
+// must authenticate and authorize requests.  If auth is nil all requests are
+// forbidden.  Mount it with http.StripPrefix, it serves:
+//
+//	GET  /                     the running executions as JSON, see Running
+//	POST /<id>/cancel          cancels an execution, see Cancel
+//	POST /<id>/signal?sig=TERM signals an execution, see Signal
+//
+// Signals are named without the "SIG" prefix.  Only INT and KILL are
+// supported on all platforms.
+func (a *Admin) Handler(auth func(http.Handler) http.Handler) http.Handler {
+	if auth == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}
+	return auth(http.HandlerFunc(a.serveHTTP))
+}
+
+func (a *Admin) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Running())
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch parts[1] {
+	case "cancel":
+		err = a.Cancel(id)
+	case "signal":
+		name := strings.TrimPrefix(strings.ToUpper(r.FormValue("sig")), "SIG")
+		sig, ok := signalsByName[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unsupported signal %q", name), http.StatusBadRequest)
+			return
+		}
+		err = a.Signal(id, sig)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		if _, lookupErr := a.lookup(id); lookupErr != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
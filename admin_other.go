@@ -0,0 +1,11 @@
+//go:build !unix
+
+package pipes
+
+import "os"
+
+// signalsByName are the signals an Admin's handler can send.
+var signalsByName = map[string]os.Signal{
+	"INT":  os.Interrupt,
+	"KILL": os.Kill,
+}
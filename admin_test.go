@@ -0,0 +1,105 @@
+package pipes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// startAdminExec starts `sleep 10 | cat` tracked by a, waiting until both
+// commands are running, and returns its ID and the execution's error.
+func startAdminExec(t *testing.T, a *Admin) (int, <-chan error) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		cmds := []*exec.Cmd{exec.Command("sleep", "10"), exec.Command("cat")}
+		_, err := (&Runner{}).ExecPipeline(context.Background(), cmds, WithAdmin(a), WithLabel("job"))
+		done <- err
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		infos := a.Running()
+		if len(infos) == 1 && len(infos[0].Stages) == 2 && infos[0].Stages[0].Running && infos[0].Stages[1].Running {
+			return infos[0].ID, done
+		}
+	}
+	t.Fatal("execution not running")
+	return 0, nil
+}
+
+func TestAdmin(t *testing.T) {
+	a := NewAdmin()
+	srv := httptest.NewServer(a.Handler(func(h http.Handler) http.Handler { return h }))
+	defer srv.Close()
+
+	post := func(path string) int {
+		resp, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	id, done := startAdminExec(t, a)
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []ExecutionInfo
+	err = json.NewDecoder(resp.Body).Decode(&infos)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].ID != id || infos[0].Label != "job" || !reflect.DeepEqual(infos[0].Stages[0].Args, []string{"sleep", "10"}) || infos[0].Stages[0].Pid == 0 {
+		t.Errorf("GET / = %+v, want the execution", infos)
+	}
+
+	for path, want := range map[string]int{
+		"/99/cancel":          http.StatusNotFound,
+		"/1/frobnicate":       http.StatusNotFound,
+		"/x/cancel":           http.StatusNotFound,
+		"/1/signal?sig=BOGUS": http.StatusBadRequest,
+	} {
+		if code := post(path); code != want {
+			t.Errorf("POST %s = %d, want %d", path, code, want)
+		}
+	}
+	if resp, err := http.Get(srv.URL + "/1/cancel"); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /1/cancel = %v, %v, want %d", resp, err, http.StatusMethodNotAllowed)
+	}
+
+	// Signaling fails the execution, which is then no longer tracked.
+	if code := post("/1/signal?sig=SIGKILL"); code != http.StatusNoContent {
+		t.Errorf("POST /1/signal = %d", code)
+	}
+	if err := <-done; err == nil {
+		t.Error("signaled execution succeeded")
+	}
+	if infos := a.Running(); len(infos) != 0 {
+		t.Errorf("Running() = %+v after the execution", infos)
+	}
+
+	id, done = startAdminExec(t, a)
+	if code := post("/2/cancel"); id != 2 || code != http.StatusNoContent {
+		t.Errorf("POST /2/cancel = %d, want the second execution canceled", code)
+	}
+	if err := <-done; !errors.Is(err, ErrAdminCanceled) {
+		t.Errorf("error = %v, want %v", err, ErrAdminCanceled)
+	}
+}
+
+func TestAdminForbidden(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewAdmin().Handler(nil).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,20 @@
+package pipes
+
+import (
+	"os/exec"
+)
+
+// WithCPUAffinity pins the commands at the given stages, or all commands if
+// no stages are given, to the given CPUs, e.g. to reduce noise when
+// benchmarking.  Only supported on Linux.
+func WithCPUAffinity(cpus []int, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			release, err := startWithAffinity(cmd, cpus, start)
+			if err == nil {
+				c.onRelease(release)
+			}
+			return err
+		}, stages)
+	}
+}
@@ -0,0 +1,28 @@
+package pipes
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// startWithAffinity calls start on a thread pinned to cpus, whose affinity
+// the child inherits, see startOnThread.
+func startWithAffinity(cmd *exec.Cmd, cpus []int, start func() error) (func(), error) {
+	var set [1024 / 64]uint64
+	for _, cpu := range cpus {
+		if cpu < 0 || cpu >= len(set)*64 {
+			return nil, fmt.Errorf("invalid CPU %d", cpu)
+		}
+		set[cpu/64] |= 1 << (uint(cpu) % 64)
+	}
+
+	return startOnThread(cmd, func() error {
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(set), uintptr(unsafe.Pointer(&set[0])))
+		if errno != 0 {
+			return fmt.Errorf("setting CPU affinity: %s", errno.Error())
+		}
+		return nil
+	}, start)
+}
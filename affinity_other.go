@@ -0,0 +1,12 @@
+//go:build !linux
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func startWithAffinity(cmd *exec.Cmd, cpus []int, start func() error) (func(), error) {
+	return nil, errors.New("CPU affinity not supported on this platform")
+}
@@ -0,0 +1,179 @@
+package pipes
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// withoutEnv returns cmd's environment, or this process's if it's nil,
+// without the variable key.
+func withoutEnv(cmd *exec.Cmd, key string) []string {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	kept := make([]string, 0, len(env))
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, key+"=") {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// agentProxy forwards the connections to a socket in a private directory to
+// an agent's socket.
+type agentProxy struct {
+	dir   string
+	ln    net.Listener
+	agent string
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+}
+
+// newAgentProxy starts proxying to the agent's socket at path.
+func newAgentProxy(path string) (*agentProxy, error) {
+	// TempDir creates the directory accessible only to this user.
+	dir, err := ioutil.TempDir("", "pipes-agent-")
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	p := &agentProxy{dir: dir, ln: ln, agent: path, conns: make(map[net.Conn]bool)}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// path returns the path of the proxy's socket.
+func (p *agentProxy) path() string {
+	return p.ln.Addr().String()
+}
+
+func (p *agentProxy) serve() {
+	defer p.wg.Done()
+	for {
+		client, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		agent, err := net.Dial("unix", p.agent)
+		if err != nil {
+			client.Close()
+			continue
+		}
+		if !p.track(client, agent) {
+			return
+		}
+
+		p.wg.Add(2)
+		go p.forward(agent, client)
+		go p.forward(client, agent)
+	}
+}
+
+// track tracks the connections of a client, so that close can close them,
+// unless the proxy was closed.
+func (p *agentProxy) track(conns ...net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns == nil {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		return false
+	}
+	for _, conn := range conns {
+		p.conns[conn] = true
+	}
+	return true
+}
+
+// forward copies src to dst until either fails, then closes both.
+func (p *agentProxy) forward(dst net.Conn, src net.Conn) {
+	defer p.wg.Done()
+	io.Copy(dst, src)
+	dst.Close()
+	src.Close()
+}
+
+// close stops proxying, closing all connections, and removes the socket.
+func (p *agentProxy) close() {
+	p.ln.Close()
+	p.mu.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+	p.mu.Unlock()
+	p.wg.Wait()
+	os.RemoveAll(p.dir)
+}
+
+// WithAgentSocket exposes the agent socket at path, e.g. ssh-agent's, only
+// to the commands at the given stages, via the environment variable env,
+// and removes env from the environment of all other commands, e.g. so
+// that only the stage signing or fetching with a key can use it.  The
+// stages are given the path of a proxy socket in a private temporary
+// directory rather than path itself, which is removed once the execution
+// completes, so that their access to the agent ends with the execution,
+// including that of any processes they leave behind.  This doesn't keep
+// other processes running as the same user from finding and using the
+// agent's socket, nor hides agents found other than through the
+// environment, like gpg-agent since GnuPG 2.1.
+func WithAgentSocket(env string, path string, stages ...int) Option {
+	return func(c *config) {
+		var proxy *agentProxy
+		c.onSetup(func(c *config) error {
+			var err error
+			if proxy, err = newAgentProxy(path); err != nil {
+				return err
+			}
+			c.onRelease(proxy.close)
+			return nil
+		})
+
+		exposed := make(map[int]bool, len(stages))
+		for _, stage := range stages {
+			exposed[stage] = true
+		}
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			cmd.Env = withoutEnv(cmd, env)
+			if exposed[stageIndex(c.cmds, cmd)] {
+				cmd.Env = append(cmd.Env, env+"="+proxy.path())
+			}
+			return start()
+		}, nil)
+	}
+}
+
+// WithSSHAgent exposes the ssh-agent named by this process's SSH_AUTH_SOCK,
+// if any, only to the commands at the given stages, see WithAgentSocket.
+// Without an ssh-agent, SSH_AUTH_SOCK is merely removed from the
+// environment of every command.
+func WithSSHAgent(stages ...int) Option {
+	const env = "SSH_AUTH_SOCK"
+	path := os.Getenv(env)
+	if path == "" {
+		return func(c *config) {
+			c.onStart(func(cmd *exec.Cmd, start func() error) error {
+				cmd.Env = withoutEnv(cmd, env)
+				return start()
+			}, nil)
+		}
+	}
+	return WithAgentSocket(env, path, stages...)
+}
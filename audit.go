@@ -0,0 +1,143 @@
+package pipes
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord records a single execution by a Runner: who requested it,
+// what was executed, when and with what result.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Principal identifies who requested the execution, see WithPrincipal.
+	Principal string `json:"principal,omitempty"`
+	Result    Result `json:"result"`
+	// Error is the execution's error string, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink receives an AuditRecord for every execution by a Runner.  Each
+// record is a deep copy that the sink may retain.  Audit is called
+// synchronously before the execution returns and may be called
+// concurrently; errors are the sink's to handle as they don't affect the
+// outcome of an execution that has already completed.
+type AuditSink interface {
+	Audit(rec AuditRecord) error
+}
+
+// WithPrincipal identifies who requested the execution, e.g. the user on
+// whose behalf a service executes a command, for the Runner's AuditSink.
+func WithPrincipal(principal string) Option {
+	return func(c *config) {
+		c.principal = principal
+	}
+}
+
+func newAuditRecord(now time.Time, c *config, res *Result, err error) AuditRecord {
+	rec := AuditRecord{Time: now, Principal: c.principal, Result: *res}
+
+	// Deep copy everything the Runner's caller may hang on to.
+	rec.Result.Stages = make([]StageResult, len(res.Stages))
+	for i, stage := range res.Stages {
+		stage.Args = copyStrings(stage.Args)
+		if stage.Usage != nil {
+			u := *stage.Usage
+			stage.Usage = &u
+		}
+		rec.Result.Stages[i] = stage
+	}
+	rec.Result.Stdout = copyBytes(res.Stdout)
+	rec.Result.Stderr = copyBytes(res.Stderr)
+	rec.Result.PartialStdout = copyBytes(res.PartialStdout)
+	if res.StdoutType != nil {
+		t := *res.StdoutType
+		rec.Result.StdoutType = &t
+	}
+	if res.StderrType != nil {
+		t := *res.StderrType
+		rec.Result.StderrType = &t
+	}
+	if res.Diagnostics != nil {
+		rec.Result.Diagnostics = make([]Diagnostics, len(res.Diagnostics))
+		for i, d := range res.Diagnostics {
+			d.Kernel = copyStrings(d.Kernel)
+			rec.Result.Diagnostics[i] = d
+		}
+	}
+	if res.Attempts != nil {
+		rec.Result.Attempts = make([]Attempt, len(res.Attempts))
+		for i, a := range res.Attempts {
+			if a.Changes != nil {
+				changes := make([]StageChange, len(a.Changes))
+				for j, change := range a.Changes {
+					change.Args = copyStrings(change.Args)
+					change.EnvSet = copyStrings(change.EnvSet)
+					change.EnvUnset = copyStrings(change.EnvUnset)
+					changes[j] = change
+				}
+				a.Changes = changes
+			}
+			rec.Result.Attempts[i] = a
+		}
+	}
+
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	return rec
+}
+
+// copyBytes returns a copy of b, preserving whether it's nil.
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// copyStrings returns a copy of s, preserving whether it's nil.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+// JSONLAudit is an AuditSink that appends records to a file as JSON, one
+// record per line.
+type JSONLAudit struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewJSONLAudit returns a JSONLAudit that appends to the file at path,
+// creating it, readable only by its owner, if it doesn't exist.
+func NewJSONLAudit(path string) (*JSONLAudit, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLAudit{f: f}, nil
+}
+
+// Audit appends rec to the file with a single write.
+func (a *JSONLAudit) Audit(rec AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = a.f.Write(data)
+	return err
+}
+
+// Close closes the file.
+func (a *JSONLAudit) Close() error {
+	return a.f.Close()
+}
@@ -0,0 +1,87 @@
+package pipes
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sharedMemory returns the path of the first pointer or non-empty slice
+// shared by a and b, which must have the same type, or "" if none.
+func sharedMemory(path string, a reflect.Value, b reflect.Value) string {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return ""
+		}
+		if a.Pointer() == b.Pointer() {
+			return path
+		}
+		return sharedMemory(path, a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.Len() > 0 && b.Len() > 0 && a.Pointer() == b.Pointer() {
+			return path
+		}
+		for i := 0; i < a.Len() && i < b.Len(); i++ {
+			if p := sharedMemory(path+"[]", a.Index(i), b.Index(i)); p != "" {
+				return p
+			}
+		}
+	case reflect.Struct:
+		// Locations are immutable, and meant to be shared.
+		if a.Type() == reflect.TypeOf(time.Time{}) {
+			return ""
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if p := sharedMemory(path+"."+a.Type().Field(i).Name, a.Field(i), b.Field(i)); p != "" {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+func TestAuditRecordDeepCopy(t *testing.T) {
+	res := &Result{
+		RunID:         "run",
+		Label:         "label",
+		Stages:        []StageResult{{Path: "/bin/true", Args: []string{"true"}, Usage: &Usage{MinorFaults: 1}}},
+		Start:         time.Unix(0, 0),
+		Stdout:        []byte("out"),
+		Stderr:        []byte("err"),
+		PartialStdout: []byte("partial"),
+		StdoutType:    &OutputType{ContentType: "text/plain"},
+		StderrType:    &OutputType{Binary: true},
+		Diagnostics:   []Diagnostics{{Stage: 0, Kernel: []string{"oom"}}},
+		Attempts: []Attempt{{Attempt: 1, Changes: []StageChange{{
+			Args:     []string{"true"},
+			EnvSet:   []string{"A=1"},
+			EnvUnset: []string{"B"},
+		}}}},
+	}
+
+	rec := newAuditRecord(time.Unix(1, 0), &config{principal: "alice"}, res, errors.New("failed"))
+	if p := sharedMemory("Result", reflect.ValueOf(res).Elem(), reflect.ValueOf(rec.Result)); p != "" {
+		t.Errorf("AuditRecord shares %s with the Result", p)
+	}
+	if !reflect.DeepEqual(*res, rec.Result) {
+		t.Errorf("AuditRecord.Result = %+v, want %+v", rec.Result, *res)
+	}
+	if rec.Principal != "alice" || rec.Error != "failed" {
+		t.Errorf("AuditRecord = %+v", rec)
+	}
+}
+
+func TestAuditRecordPreservesNil(t *testing.T) {
+	// An empty PartialStdout means a failed execution wrote nothing, a
+	// nil one that the execution didn't fail.
+	res := &Result{PartialStdout: []byte{}}
+	rec := newAuditRecord(time.Unix(1, 0), &config{}, res, nil)
+	if rec.Result.PartialStdout == nil {
+		t.Error("empty PartialStdout copied as nil")
+	}
+	if rec.Result.Stdout != nil || rec.Result.Attempts != nil || rec.Result.Diagnostics != nil {
+		t.Errorf("nil fields copied as non-nil: %+v", rec.Result)
+	}
+}
@@ -0,0 +1,83 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ExecAllError is returned by Runner.ExecAll if any command failed, and by
+// Runner.ExecRace if all alternatives failed.
+type ExecAllError struct {
+	// Errors holds each command's or alternative's error, nil if it
+	// succeeded, in order.
+	Errors []error
+}
+
+func (e *ExecAllError) Error() string {
+	var failed []string
+	for _, err := range e.Errors {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	return fmt.Sprintf("%d of %d commands failed: %s", len(failed), len(e.Errors), strings.Join(failed, "; "))
+}
+
+// Unwrap returns the errors of the commands that failed.
+func (e *ExecAllError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// ExecAll executes independent commands, see Exec, running up to parallel
+// of them at a time, or all at once if parallel is zero, e.g. to collect
+// facts from many diagnostic tools.  Every command is executed with opts,
+// so the options must not share a reader or writer unless it's safe to use
+// concurrently, e.g. use WithTail to capture each command's output in its
+// Result instead.  Every command is executed even if others fail, unless
+// ctx is done.  Returns the Result of each command, in order, and an
+// *ExecAllError if any command failed.
+func (r *Runner) ExecAll(ctx context.Context, cmds []*exec.Cmd, parallel int, opts ...Option) ([]Result, error) {
+	if parallel <= 0 || parallel > len(cmds) {
+		parallel = len(cmds)
+	}
+
+	results := make([]Result, len(cmds))
+	errs := make([]error, len(cmds))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(parallel)
+	for w := 0; w < parallel; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				res, err := r.Exec(ctx, cmds[i], opts...)
+				if res != nil {
+					results[i] = *res
+				}
+				errs[i] = err
+			}
+		}()
+	}
+	for i := range cmds {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return results, &ExecAllError{Errors: errs}
+		}
+	}
+	return results, nil
+}
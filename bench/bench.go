@@ -0,0 +1,156 @@
+// Package bench benchmarks pipelines executed by a pipes.Runner, e.g. to
+// detect performance regressions in wrapped tools in CI.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/sean-jc/pipes"
+)
+
+// Config configures a benchmark.
+type Config struct {
+	// Runs is the number of measured runs of the pipeline.
+	Runs int
+	// Warmup is the number of runs before the measured runs, whose
+	// results are discarded, e.g. to warm the page cache.
+	Warmup int
+	// CPUs, if non-empty, pins the commands to these CPUs, see
+	// pipes.WithCPUAffinity.
+	CPUs []int
+	// Stdin, if non-nil, is replayed to the first command on every run.
+	Stdin []byte
+}
+
+// Report summarizes the measured runs of a benchmark.
+type Report struct {
+	Runs int
+	// Min, Max, Mean and the percentiles are the latencies of the runs,
+	// i.e. the durations of the pipelines.
+	Min  time.Duration
+	Max  time.Duration
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	// RunsPerSecond is the number of runs completed per second of
+	// pipeline execution, and BytesPerSecond is the corresponding rate at
+	// which Stdin was processed.
+	RunsPerSecond  float64
+	BytesPerSecond float64
+}
+
+// String renders the report on a single line, e.g. for CI logs.
+func (r *Report) String() string {
+	return fmt.Sprintf("runs=%d min=%s mean=%s p50=%s p90=%s p99=%s max=%s runs/s=%.2f bytes/s=%.0f",
+		r.Runs, r.Min, r.Mean, r.P50, r.P90, r.P99, r.Max, r.RunsPerSecond, r.BytesPerSecond)
+}
+
+// percentile returns the pth percentile of sorted, using the nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Run benchmarks the pipeline returned by cmds, which is called for every
+// run as commands can't be reused, executing it via r with opts.  Returns
+// an error if any run fails.
+func Run(ctx context.Context, r *pipes.Runner, cmds func() []*exec.Cmd, cfg Config, opts ...pipes.Option) (*Report, error) {
+	if cfg.Runs < 1 {
+		return nil, fmt.Errorf("bench: at least one run required")
+	}
+	if len(cfg.CPUs) > 0 {
+		opts = append(opts[:len(opts):len(opts)], pipes.WithCPUAffinity(cfg.CPUs))
+	}
+
+	var latencies []time.Duration
+	for i := 0; i < cfg.Warmup+cfg.Runs; i++ {
+		runOpts := opts
+		if cfg.Stdin != nil {
+			runOpts = append(opts[:len(opts):len(opts)], pipes.WithStdin(bytes.NewReader(cfg.Stdin)))
+		}
+		res, err := r.ExecPipeline(ctx, cmds(), runOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("bench: run %d: %w", i+1, err)
+		}
+		if i >= cfg.Warmup {
+			latencies = append(latencies, res.Duration)
+		}
+	}
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range latencies {
+		total += d
+	}
+
+	rep := &Report{
+		Runs: len(latencies),
+		Min:  sorted[0],
+		Max:  sorted[len(sorted)-1],
+		Mean: total / time.Duration(len(latencies)),
+		P50:  percentile(sorted, 50),
+		P90:  percentile(sorted, 90),
+		P99:  percentile(sorted, 99),
+	}
+	if total > 0 {
+		rep.RunsPerSecond = float64(len(latencies)) / total.Seconds()
+		rep.BytesPerSecond = float64(len(cfg.Stdin)*len(latencies)) / total.Seconds()
+	}
+	return rep, nil
+}
+
+// CopyVariants returns variants for Compare of the ways this package can
+// move data between a pipeline's commands and its writers: "exec", os/exec's
+// copying, "fastcopy", pipes.WithFastCopy, and "iouring", pipes.WithIOUring,
+// if supported.
+func CopyVariants() map[string][]pipes.Option {
+	variants := map[string][]pipes.Option{
+		"exec":     nil,
+		"fastcopy": {pipes.WithFastCopy(0)},
+	}
+	if pipes.IOUringSupported() {
+		variants["iouring"] = []pipes.Option{pipes.WithIOUring()}
+	}
+	return variants
+}
+
+// Compare benchmarks the pipeline returned by cmds once per variant, each
+// executed with opts followed by the variant's options, e.g. to compare
+// pipes.WithFastCopy against os/exec's copying:
+//
+//	reports, err := bench.Compare(ctx, r, cmds, cfg, map[string][]pipes.Option{
+//		"exec":     nil,
+//		"fastcopy": {pipes.WithFastCopy(0)},
+//	}, pipes.WithStdout(&buf))
+//
+// Returns the Report of each variant, keyed by name, or an error if any run
+// fails.
+func Compare(ctx context.Context, r *pipes.Runner, cmds func() []*exec.Cmd, cfg Config, variants map[string][]pipes.Option, opts ...pipes.Option) (map[string]*Report, error) {
+	names := make([]string, 0, len(variants))
+	for name := range variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reports := make(map[string]*Report, len(variants))
+	for _, name := range names {
+		variantOpts := append(opts[:len(opts):len(opts)], variants[name]...)
+		rep, err := Run(ctx, r, cmds, cfg, variantOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("bench: %s: %w", name, err)
+		}
+		reports[name] = rep
+	}
+	return reports, nil
+}
@@ -0,0 +1,50 @@
+package bench
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+
+	"github.com/sean-jc/pipes"
+)
+
+// benchmarkExec executes a tiny command with discarded output b.N times.
+func benchmarkExec(b *testing.B, opts ...pipes.Option) {
+	r := &pipes.Runner{}
+	opts = append(opts, pipes.WithStdout(ioutil.Discard), pipes.WithStderr(ioutil.Discard))
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Exec(context.Background(), exec.Command("true"), opts...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExec(b *testing.B) {
+	benchmarkExec(b)
+}
+
+func BenchmarkExecLeanSpawn(b *testing.B) {
+	benchmarkExec(b, pipes.WithLeanSpawn())
+}
+
+func TestRun(t *testing.T) {
+	cmds := func() []*exec.Cmd {
+		return []*exec.Cmd{exec.Command("cat"), exec.Command("wc", "-c")}
+	}
+	report, err := Run(context.Background(), &pipes.Runner{}, cmds, Config{Runs: 3, Warmup: 1, Stdin: []byte("data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Runs != 3 || report.Min <= 0 || report.Min > report.P50 || report.P50 > report.Max || report.BytesPerSecond <= 0 {
+		t.Errorf("report = %s, want 3 consistent runs", report)
+	}
+
+	if _, err := Run(context.Background(), &pipes.Runner{}, cmds, Config{}); err == nil {
+		t.Error("no error for zero runs")
+	}
+	fail := func() []*exec.Cmd { return []*exec.Cmd{exec.Command("false")} }
+	if _, err := Run(context.Background(), &pipes.Runner{}, fail, Config{Runs: 1}); err == nil {
+		t.Error("no error for failing runs")
+	}
+}
@@ -0,0 +1,128 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BreadcrumbError annotates an execution's error with where it happened:
+// the Runner, the pipeline's label, the stage that failed and the attempt.
+// Use the accessor functions, e.g. ErrorStage, rather than parsing the
+// error string.  Executions by a Runner return a BreadcrumbError if the
+// Runner is named or the execution is labeled or numbered, see Runner.Name,
+// WithLabel, WithStageLabels and WithAttempt.
+type BreadcrumbError struct {
+	// Err is the underlying error.
+	Err error
+	// Runner is the Runner's name, see Runner.Name.
+	Runner string
+	// Label is the pipeline's label, see WithLabel.
+	Label string
+	// Stage is the index of the command that failed, or -1 if the
+	// failure isn't attributable to a command, e.g. because the Limiter's
+	// queue timed out.
+	Stage int
+	// StageLabel is the label of the command that failed, see
+	// WithStageLabels.
+	StageLabel string
+	// Attempt is the execution's attempt number, starting at 1, or 0 if
+	// unknown, see WithAttempt.
+	Attempt int
+}
+
+// Error returns the underlying error string prefixed with the breadcrumbs.
+func (e *BreadcrumbError) Error() string {
+	var crumbs []string
+	if e.Runner != "" {
+		crumbs = append(crumbs, "runner "+e.Runner)
+	}
+	if e.Label != "" {
+		crumbs = append(crumbs, "pipeline "+e.Label)
+	}
+	if e.Stage >= 0 {
+		stage := fmt.Sprintf("stage %d", e.Stage)
+		if e.StageLabel != "" {
+			stage += " (" + e.StageLabel + ")"
+		}
+		crumbs = append(crumbs, stage)
+	}
+	if e.Attempt > 0 {
+		crumbs = append(crumbs, fmt.Sprintf("attempt %d", e.Attempt))
+	}
+	return strings.Join(crumbs, " > ") + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *BreadcrumbError) Unwrap() error {
+	return e.Err
+}
+
+// WithStageLabels labels the pipeline's commands, in order, for the
+// breadcrumbs of the execution's error, see BreadcrumbError.
+func WithStageLabels(labels ...string) Option {
+	return func(c *config) {
+		c.stageLabels = labels
+	}
+}
+
+// WithAttempt numbers the execution, starting at 1, for the breadcrumbs of
+// its error when the caller retries it, see BreadcrumbError.
+func WithAttempt(attempt int) Option {
+	return func(c *config) {
+		c.attempt = attempt
+	}
+}
+
+// breadcrumbs annotates err, the error of the execution by the Runner named
+// runner, with the execution's breadcrumbs, if any.
+func (c *config) breadcrumbs(runner string, err error) error {
+	if err == nil || (runner == "" && c.label == "" && len(c.stageLabels) == 0 && c.attempt == 0) {
+		return err
+	}
+	e := &BreadcrumbError{Err: err, Runner: runner, Label: c.label, Stage: c.failedStage - 1, Attempt: c.attempt}
+	if e.Stage >= 0 && e.Stage < len(c.stageLabels) {
+		e.StageLabel = c.stageLabels[e.Stage]
+	}
+	return e
+}
+
+// ErrorRunner returns the name of the Runner whose execution failed with
+// err, if known.
+func ErrorRunner(err error) string {
+	var e *BreadcrumbError
+	if errors.As(err, &e) {
+		return e.Runner
+	}
+	return ""
+}
+
+// ErrorLabel returns the label of the pipeline that failed with err, if
+// known.
+func ErrorLabel(err error) string {
+	var e *BreadcrumbError
+	if errors.As(err, &e) {
+		return e.Label
+	}
+	return ""
+}
+
+// ErrorStage returns the index and label of the command that failed with
+// err.  ok is false if unknown.
+func ErrorStage(err error) (stage int, label string, ok bool) {
+	var e *BreadcrumbError
+	if errors.As(err, &e) && e.Stage >= 0 {
+		return e.Stage, e.StageLabel, true
+	}
+	return -1, "", false
+}
+
+// ErrorAttempt returns the attempt number of the execution that failed with
+// err, or 0 if unknown.
+func ErrorAttempt(err error) int {
+	var e *BreadcrumbError
+	if errors.As(err, &e) {
+		return e.Attempt
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned, wrapped, for executions rejected by a Breaker.
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// Breaker fast-fails executions of a command once it has failed Threshold
+// consecutive times, until Cooldown has elapsed.  After the cooldown, a
+// single trial execution is allowed through; the breaker closes if the trial
+// succeeds and stays open for another cooldown if it fails.  Executions are
+// identified by their label, see WithLabel, or by their commands' paths.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	// Clock, if non-nil, is used instead of the real clock, e.g. by
+	// tests.
+	Clock Clock
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+}
+
+// NewBreaker returns a Breaker that opens after threshold consecutive
+// failures and stays open for cooldown.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// breakerKey returns the key identifying an execution of cmds.
+func breakerKey(label string, cmds []*exec.Cmd) string {
+	if label != "" {
+		return label
+	}
+	paths := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		paths[i] = cmd.Path
+	}
+	return strings.Join(paths, " | ")
+}
+
+// allow returns true if an execution identified by key may run.
+func (b *Breaker) allow(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[key]
+	if c == nil || c.failures < b.Threshold {
+		return true
+	}
+
+	now := clockOrReal(b.Clock).Now()
+	if now.Before(c.openUntil) {
+		return false
+	}
+	// Let this execution through as a trial, but keep rejecting others
+	// until it completes.
+	c.openUntil = now.Add(b.Cooldown)
+	return true
+}
+
+// record updates the circuit for key with the outcome of an execution.
+func (b *Breaker) record(key string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		delete(b.circuits, key)
+		return
+	}
+	if b.circuits == nil {
+		b.circuits = make(map[string]*circuit)
+	}
+	c := b.circuits[key]
+	if c == nil {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	if c.failures++; c.failures >= b.Threshold {
+		c.openUntil = clockOrReal(b.Clock).Now().Add(b.Cooldown)
+	}
+}
+
+// cancel notes that an execution allowed for key didn't run to completion,
+// so that a pending trial doesn't hold the breaker open for a full cooldown.
+func (b *Breaker) cancel(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c := b.circuits[key]; c != nil && c.failures >= b.Threshold {
+		c.openUntil = clockOrReal(b.Clock).Now()
+	}
+}
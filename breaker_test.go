@@ -0,0 +1,110 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock that only moves when told to.
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestBreaker(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	b := NewBreaker(2, time.Minute)
+	b.Clock = clock
+	r := &Runner{Breaker: b}
+	run := func(name string) error {
+		_, err := r.Exec(context.Background(), exec.Command(name), WithLabel("job"))
+		return err
+	}
+
+	// Failures below the threshold, or interrupted by a success, don't
+	// open the breaker.
+	for _, name := range []string{"false", "true", "false"} {
+		if err := run(name); errors.Is(err, ErrBreakerOpen) {
+			t.Fatalf("%s rejected: %v", name, err)
+		}
+	}
+	if err := run("false"); err == nil || errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("Exec() error = %v, want false's", err)
+	}
+
+	// Open, rejecting executions with the same label only.
+	cmd := exec.Command("true")
+	if _, err := r.Exec(context.Background(), cmd, WithLabel("job")); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("Exec() error = %v, want %v", err, ErrBreakerOpen)
+	}
+	if cmd.Process != nil {
+		t.Error("rejected command started")
+	}
+	if _, err := r.Exec(context.Background(), exec.Command("true"), WithLabel("other")); err != nil {
+		t.Errorf("other label rejected: %v", err)
+	}
+
+	// A failed trial after the cooldown keeps it open for another one.
+	clock.now = clock.now.Add(time.Minute)
+	if err := run("false"); err == nil || errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("trial error = %v, want false's", err)
+	}
+	clock.now = clock.now.Add(time.Minute - time.Second)
+	if err := run("true"); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("Exec() error = %v during the cooldown, want %v", err, ErrBreakerOpen)
+	}
+
+	// A successful trial closes it.
+	clock.now = clock.now.Add(time.Second)
+	if err := run("true"); err != nil {
+		t.Errorf("trial error = %v", err)
+	}
+	if err := run("false"); errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("Exec() error = %v after a successful trial", err)
+	}
+}
+
+func TestBreakerTrial(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	b := NewBreaker(1, time.Minute)
+	b.Clock = clock
+	b.record("k", true)
+
+	// Only one trial is let through while it runs.
+	clock.now = clock.now.Add(time.Minute)
+	if !b.allow("k") {
+		t.Fatal("trial rejected after the cooldown")
+	}
+	if b.allow("k") {
+		t.Error("second execution allowed during the trial")
+	}
+
+	// A trial that doesn't run lets the next execution through.
+	b.cancel("k")
+	if !b.allow("k") {
+		t.Error("execution rejected after the trial was canceled")
+	}
+}
+
+func TestBreakerKey(t *testing.T) {
+	cmds := []*exec.Cmd{{Path: "/bin/a"}, {Path: "/bin/b"}}
+	if key := breakerKey("", cmds); key != "/bin/a | /bin/b" {
+		t.Errorf("breakerKey() = %q, want the commands' paths", key)
+	}
+	if key := breakerKey("label", cmds); key != "label" {
+		t.Errorf("breakerKey() = %q, want the label", key)
+	}
+}
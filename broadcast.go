@@ -0,0 +1,345 @@
+package pipes
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// subscriberBuffer is the number of lines buffered for each subscriber of a
+// Broadcaster before the subscriber is considered too slow and dropped.
+const subscriberBuffer = 256
+
+// Line is a single line, or record, of output from a command.
+type Line struct {
+	// Stream is "stdout" or "stderr".
+	Stream string `json:"stream"`
+	Text   string `json:"text"`
+}
+
+// Broadcaster fans out lines written to its Stdout and Stderr writers to any
+// number of subscribers, replaying the last lines written to each new
+// subscriber, e.g. to stream a pipeline's output to browsers for live build
+// logs.  Subscribers that fall too far behind are dropped rather than
+// stalling the pipeline.  A Broadcaster is also an http.Handler that streams
+// lines via Server-Sent Events or, for WebSocket upgrade requests, as JSON
+// encoded Lines in WebSocket text messages.
+type Broadcaster struct {
+	stdout *lineWriter
+	stderr *lineWriter
+
+	mu     sync.Mutex
+	replay []Line
+	max    int
+	subs   map[chan Line]struct{}
+	closed bool
+}
+
+// NewBroadcaster returns a Broadcaster that replays up to the last replay
+// lines to new subscribers.
+func NewBroadcaster(replay int) *Broadcaster {
+	return NewRecordBroadcaster(replay, '\n')
+}
+
+// NewRecordBroadcaster is like NewBroadcaster, but broadcasts records
+// terminated by delim, e.g. NUL for `find -print0`, instead of lines.
+func NewRecordBroadcaster(replay int, delim byte) *Broadcaster {
+	b := &Broadcaster{max: replay, subs: make(map[chan Line]struct{})}
+	b.stdout = newRecordWriter(delim, func(line []byte) {
+		b.broadcast(Line{Stream: "stdout", Text: string(line)})
+	})
+	b.stderr = newRecordWriter(delim, func(line []byte) {
+		b.broadcast(Line{Stream: "stderr", Text: string(line)})
+	})
+	return b
+}
+
+// Stdout returns a writer whose lines are broadcast as "stdout" lines.
+func (b *Broadcaster) Stdout() io.Writer {
+	return b.stdout
+}
+
+// Stderr returns a writer whose lines are broadcast as "stderr" lines.
+func (b *Broadcaster) Stderr() io.Writer {
+	return b.stderr
+}
+
+func (b *Broadcaster) broadcast(line Line) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	if b.max > 0 {
+		if len(b.replay) == b.max {
+			copy(b.replay, b.replay[1:])
+			b.replay = b.replay[:b.max-1]
+		}
+		b.replay = append(b.replay, line)
+	}
+	for sub := range b.subs {
+		select {
+		case sub <- line:
+		default:
+			delete(b.subs, sub)
+			close(sub)
+		}
+	}
+}
+
+// Subscribe returns a channel that receives the replayed lines followed by
+// all subsequently written lines, and a function to cancel the subscription.
+// The channel is closed when the Broadcaster is closed, the subscription is
+// cancelled or the subscriber falls too far behind.
+func (b *Broadcaster) Subscribe() (<-chan Line, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := make(chan Line, subscriberBuffer+len(b.replay))
+	for _, line := range b.replay {
+		sub <- line
+	}
+	if b.closed {
+		close(sub)
+		return sub, func() {}
+	}
+	b.subs[sub] = struct{}{}
+
+	return sub, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[sub]; ok {
+			delete(b.subs, sub)
+			close(sub)
+		}
+	}
+}
+
+// Close broadcasts any trailing partial lines and ends all subscriptions.
+func (b *Broadcaster) Close() {
+	b.stdout.flush()
+	b.stderr.flush()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub)
+	}
+}
+
+// ServeHTTP streams lines to the client until the Broadcaster is closed or
+// the client disconnects.
+func (b *Broadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		b.serveWebSocket(w, r)
+	} else {
+		b.serveSSE(w, r)
+	}
+}
+
+func (b *Broadcaster) serveSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	lines, cancel := b.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			// SSE treats a lone CR as a line terminator, drop them,
+			// and records may hold newlines, which are sent as
+			// several data lines.
+			text := strings.Replace(line.Text, "\r", "", -1)
+			text = strings.Replace(text, "\n", "\ndata: ", -1)
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", line.Stream, text); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// websocketGUID is the magic GUID used to compute Sec-WebSocket-Accept.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+func (b *Broadcaster) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "bad websocket handshake", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err = rw.Flush(); err != nil {
+		return
+	}
+
+	lines, cancel := b.Subscribe()
+	defer cancel()
+
+	// Frames are written by both this goroutine and the reader, which
+	// answers pings and closes.
+	var wmu sync.Mutex
+	write := func(opcode byte, payload []byte) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+
+		if err := writeWebSocketFrame(rw.Writer, opcode, payload); err != nil {
+			return err
+		}
+		return rw.Flush()
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		readWebSocket(rw.Reader, write)
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				write(wsClose, nil)
+				return
+			}
+			data, _ := json.Marshal(line)
+			if err := write(wsText, data); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// writeWebSocketFrame writes a single, unfragmented and unmasked frame, as
+// sent by a server.
+func writeWebSocketFrame(w *bufio.Writer, opcode byte, payload []byte) error {
+	hdr := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xFFFF:
+		hdr[1] = 126
+		hdr = append(hdr, 0, 0)
+		binary.BigEndian.PutUint16(hdr[2:], uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = append(hdr, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(hdr[2:], uint64(n))
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readWebSocket reads and discards frames sent by the client, answering
+// pings, until the client closes the connection or an error occurs.
+func readWebSocket(r *bufio.Reader, write func(opcode byte, payload []byte) error) {
+	for {
+		var hdr [2]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return
+		}
+		opcode := hdr[0] & 0x0F
+
+		n := uint64(hdr[1] & 0x7F)
+		switch n {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+
+		var mask [4]byte
+		if hdr[1]&0x80 != 0 {
+			if _, err := io.ReadFull(r, mask[:]); err != nil {
+				return
+			}
+		}
+
+		switch opcode {
+		case wsClose:
+			write(wsClose, nil)
+			return
+		case wsPing:
+			// Control frames carry at most 125 bytes.
+			if n > 125 {
+				return
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+			if write(wsPong, payload) != nil {
+				return
+			}
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, int64(n)); err != nil {
+				return
+			}
+		}
+	}
+}
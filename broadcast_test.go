@@ -0,0 +1,131 @@
+package pipes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// collect returns the lines received from sub until it's closed.
+func collect(sub <-chan Line) []Line {
+	var lines []Line
+	for line := range sub {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster(2)
+	fmt.Fprint(b.Stdout(), "1\n2\n")
+	fmt.Fprint(b.Stderr(), "3\n")
+
+	// The last lines are replayed to new subscribers.
+	sub, _ := b.Subscribe()
+	cancelled, cancel := b.Subscribe()
+	fmt.Fprint(b.Stdout(), "4\n5")
+	cancel()
+	b.Close()
+
+	want := []Line{{"stdout", "2"}, {"stderr", "3"}, {"stdout", "4"}, {"stdout", "5"}}
+	if got := collect(sub); !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+	if got := collect(cancelled); !reflect.DeepEqual(got, want[:3]) {
+		t.Errorf("cancelled lines = %v, want %v", got, want[:3])
+	}
+	if got := collect(func() <-chan Line { sub, _ := b.Subscribe(); return sub }()); !reflect.DeepEqual(got, want[2:]) {
+		t.Errorf("lines after close = %v, want %v", got, want[2:])
+	}
+}
+
+// readFrame reads an unfragmented frame of at most 125 bytes sent by a
+// WebSocket server.
+func readFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, hdr[1]&0x7F)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[0] & 0x0F, payload
+}
+
+func TestBroadcasterWebSocket(t *testing.T) {
+	b := NewBroadcaster(10)
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: pipes\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake response = %s %q", resp.Status, resp.Header)
+	}
+
+	// Pings, masked as sent by clients, are answered.
+	conn.Write([]byte{0x80 | wsPing, 0x80 | 2, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2})
+	if opcode, payload := readFrame(t, r); opcode != wsPong || string(payload) != "hi" {
+		t.Errorf("frame = %x %q, want pong", opcode, payload)
+	}
+
+	fmt.Fprint(b.Stderr(), "oops\n")
+	opcode, payload := readFrame(t, r)
+	var line Line
+	if opcode != wsText || json.Unmarshal(payload, &line) != nil || line != (Line{"stderr", "oops"}) {
+		t.Errorf("frame = %x %q, want the line", opcode, payload)
+	}
+	b.Close()
+	if opcode, _ := readFrame(t, r); opcode != wsClose {
+		t.Errorf("frame = %x, want close", opcode)
+	}
+}
+
+func TestRecordBroadcasterSSE(t *testing.T) {
+	b := NewRecordBroadcaster(10, 0)
+	fmt.Fprint(b.Stdout(), "a\nb\x00c\x00")
+	b.Close()
+
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Newlines in records are sent as several data lines.
+	var events []string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			data = append(data, line[len("data: "):])
+		} else if line == "" && data != nil {
+			events = append(events, strings.Join(data, "\n"))
+			data = nil
+		}
+	}
+	if want := []string{"a\nb", "c"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
@@ -0,0 +1,235 @@
+package pipes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores the output of commands, keyed by a digest of the command,
+// its environment and its input.
+type Cache interface {
+	// Get returns the data stored for key, if any.
+	Get(key string) ([]byte, bool)
+	// Put stores data for key.
+	Put(key string, data []byte) error
+}
+
+// DiskCache is a Cache that stores each entry as a file in Dir.  Entries
+// older than TTL are ignored, and expired entries as well as the oldest
+// entries are evicted when the total size of all entries exceeds MaxSize.
+// A zero TTL or MaxSize means no limit.
+type DiskCache struct {
+	Dir     string
+	TTL     time.Duration
+	MaxSize int64
+
+	mu sync.Mutex
+}
+
+// NewDiskCache returns a DiskCache rooted at dir, creating dir if needed.
+func NewDiskCache(dir string, ttl time.Duration, maxSize int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{Dir: dir, TTL: ttl, MaxSize: maxSize}, nil
+}
+
+func (c *DiskCache) expired(fi os.FileInfo) bool {
+	return c.TTL > 0 && time.Since(fi.ModTime()) > c.TTL
+}
+
+// Get returns the data stored for key if it exists and hasn't expired.
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	path := filepath.Join(c.Dir, key)
+
+	fi, err := os.Stat(path)
+	if err != nil || c.expired(fi) {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Put atomically stores data for key and evicts entries as needed to honor
+// the cache's TTL and size bounds.
+func (c *DiskCache) Put(key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := ioutil.TempFile(c.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(c.Dir, key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return c.evict()
+}
+
+// evict removes expired entries, then the oldest entries until the total
+// size of the cache fits in MaxSize.  Must be called with mu held.
+func (c *DiskCache) evict() error {
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	live := entries[:0]
+	for _, fi := range entries {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".tmp-") {
+			continue
+		}
+		if c.expired(fi) {
+			os.Remove(filepath.Join(c.Dir, fi.Name()))
+			continue
+		}
+		size += fi.Size()
+		live = append(live, fi)
+	}
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].ModTime().Before(live[j].ModTime())
+	})
+	for _, fi := range live {
+		if size <= c.MaxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.Dir, fi.Name())); err != nil {
+			return err
+		}
+		size -= fi.Size()
+	}
+	return nil
+}
+
+var (
+	defaultCache     Cache
+	defaultCacheOnce sync.Once
+)
+
+// getDefaultCache returns a DiskCache in the user's cache directory with a
+// one hour TTL and a 64MiB size bound, or nil if it can't be created.
+func getDefaultCache() Cache {
+	defaultCacheOnce.Do(func() {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return
+		}
+		if c, err := NewDiskCache(filepath.Join(dir, "pipes"), time.Hour, 64<<20); err == nil {
+			defaultCache = c
+		}
+	})
+	return defaultCache
+}
+
+// lookupEnv returns the value of key in cmd's environment, which is the
+// parent's environment if cmd.Env is nil.
+func lookupEnv(cmd *exec.Cmd, key string) (string, bool) {
+	if cmd.Env == nil {
+		return os.LookupEnv(key)
+	}
+	// Like os/exec, the last value wins if a key is duplicated.
+	for i := len(cmd.Env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(cmd.Env[i], key+"=") {
+			return cmd.Env[i][len(key)+1:], true
+		}
+	}
+	return "", false
+}
+
+// cacheKey computes the cache key for cmd from its path, arguments and
+// working directory, the values of the environment variables named by env,
+// in any order, and stdin.
+func cacheKey(cmd *exec.Cmd, env []string, stdin []byte) string {
+	h := sha256.New()
+
+	env = append([]string(nil), env...)
+	sort.Strings(env)
+
+	field := func(s string) {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+	field(cmd.Path)
+	for _, arg := range cmd.Args {
+		field(arg)
+	}
+	field(cmd.Dir)
+	for i, key := range env {
+		if i > 0 && key == env[i-1] {
+			continue
+		}
+		if val, ok := lookupEnv(cmd, key); ok {
+			field(key + "=" + val)
+		} else {
+			field(key)
+		}
+	}
+	stdinSum := sha256.Sum256(stdin)
+	h.Write(stdinSum[:])
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ExecOCached executes a single command like ExecO, memoizing its output in
+// cache, or in a default on-disk cache in the user's cache directory if
+// cache is nil.  The cache key is derived from the command's path, arguments
+// and working directory, the values of the environment variables named by
+// env, and a digest of stdin, which is read in full before the command is
+// run.  Only the output of successful executions is cached, and failing to
+// store the output is not treated as an error.  Returns the command's Stdout
+// as a byte slice, and an error containing the command that failed, the
+// system error string and any information captured from Stderr.
+func ExecOCached(cache Cache, cmd *exec.Cmd, env []string, stdin io.Reader) ([]byte, error) {
+	if cache == nil {
+		if cache = getDefaultCache(); cache == nil {
+			return ExecO(cmd, stdin)
+		}
+	}
+
+	var input []byte
+	if stdin != nil {
+		var err error
+		if input, err = ioutil.ReadAll(stdin); err != nil {
+			return nil, err
+		}
+		stdin = bytes.NewReader(input)
+	}
+
+	key := cacheKey(cmd, env, input)
+	if data, ok := cache.Get(key); ok {
+		return data, nil
+	}
+
+	data, err := ExecO(cmd, stdin)
+	if err != nil {
+		return nil, err
+	}
+	cache.Put(key, data)
+	return data, nil
+}
@@ -0,0 +1,114 @@
+package pipes
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecOCached(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Count the runs of the command, which echos $X and its input.
+	runs := filepath.Join(t.TempDir(), "runs")
+	command := func(env ...string) *exec.Cmd {
+		cmd := exec.Command("sh", "-c", `echo >>`+runs+`; echo "$X"; cat`)
+		cmd.Env = env
+		return cmd
+	}
+	check := func(cmd *exec.Cmd, env []string, stdin string, want string, wantRun bool) {
+		t.Helper()
+		before, _ := ioutil.ReadFile(runs)
+		out, err := ExecOCached(cache, cmd, env, strings.NewReader(stdin))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want {
+			t.Errorf("output = %q, want %q", out, want)
+		}
+		after, _ := ioutil.ReadFile(runs)
+		if ran := len(after) > len(before); ran != wantRun {
+			t.Errorf("ran = %v, want %v", ran, wantRun)
+		}
+	}
+
+	check(command("X=1", "Y=1"), []string{"X", "Y"}, "in", "1\nin", true)
+	check(command("X=1", "Y=1"), []string{"X", "Y"}, "in", "1\nin", false)
+
+	// The key depends on the input and the named variables, whatever
+	// their order, using the last value of duplicated variables.
+	check(command("X=1", "Y=1"), []string{"X", "Y"}, "other", "1\nother", true)
+	check(command("Y=1", "X=1"), []string{"Y", "X", "Y"}, "in", "1\nin", false)
+	check(command("X=0", "Y=1", "X=1"), []string{"X", "Y"}, "in", "1\nin", false)
+	check(command("X=1", "Y=2"), []string{"X", "Y"}, "in", "1\nin", true)
+	check(command("X=1", "Y=3"), []string{"X"}, "in", "1\nin", true)
+	check(command("X=1", "Y=4"), []string{"X"}, "in", "1\nin", false)
+	check(command("X=1"), []string{"X", "Y"}, "in", "1\nin", true)
+
+	// Failures aren't cached.
+	for i := 0; i < 2; i++ {
+		if _, err := ExecOCached(cache, exec.Command("sh", "-c", "echo >>"+runs+"; exit 1"), nil, nil); err == nil {
+			t.Fatal("no error for failing command")
+		}
+	}
+	if data, _ := ioutil.ReadFile(runs); strings.Count(string(data), "\n") != 7 {
+		t.Errorf("%d runs, want the failing command to run twice", strings.Count(string(data), "\n"))
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get of missing entry succeeded")
+	}
+	if err := c.Put("a", []byte("aaaa")); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := c.Get("a"); !ok || string(data) != "aaaa" {
+		t.Errorf("Get = %q, %v, want the entry", data, ok)
+	}
+
+	// Expired entries are ignored.
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get of expired entry succeeded")
+	}
+
+	// The oldest entries are evicted to fit the size bound, along with
+	// the expired ones.
+	for i, key := range []string{"b", "c", "d"} {
+		if err := c.Put(key, []byte("1234")); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(time.Duration(i-3) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, key), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range entries {
+		names = append(names, fi.Name())
+	}
+	if got := strings.Join(names, ","); got != "c,d" {
+		t.Errorf("entries = %s, want c,d", got)
+	}
+}
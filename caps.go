@@ -0,0 +1,27 @@
+package pipes
+
+import (
+	"os/exec"
+)
+
+// WithDropCapabilities drops all Linux capabilities other than keep, from
+// the bounding, permitted and inheritable sets, of the commands at the
+// given stages, or of all commands if no stages are given, so that commands
+// run by a privileged daemon don't have CAP_NET_ADMIN and friends.  Kept
+// capabilities that this process has are made ambient, so that the commands
+// keep them even if they aren't run as root, though commands that switch
+// credentials via SysProcAttr.Credential must keep CAP_SETUID and
+// CAP_SETGID to do so.  Capabilities are numbered as by the kernel, e.g.
+// unix.CAP_NET_BIND_SERVICE.  Requires CAP_SETPCAP unless the bounding set
+// already excludes the dropped capabilities, and fails on other platforms.
+func WithDropCapabilities(keep []uintptr, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			release, err := startWithCapabilities(cmd, keep, start)
+			if err == nil {
+				c.onRelease(release)
+			}
+			return err
+		}, stages)
+	}
+}
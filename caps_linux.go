@@ -0,0 +1,128 @@
+package pipes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	linuxCapabilityVersion3 = 0x20080522
+
+	prCapbsetRead        = 23
+	prCapbsetDrop        = 24
+	prCapAmbient         = 47
+	prCapAmbientClearAll = 4
+)
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// lastCap returns the highest capability supported by the kernel.
+func lastCap() (uintptr, error) {
+	b, err := ioutil.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	return uintptr(n), err
+}
+
+// dropCapabilities drops all capabilities other than keep from the calling
+// thread, which must be locked, and returns the kept capabilities that are
+// still permitted.
+func dropCapabilities(keep []uintptr) ([]uintptr, error) {
+	last, err := lastCap()
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[uintptr]bool)
+	for _, c := range keep {
+		kept[c] = true
+	}
+
+	// Drop from the bounding set first, which requires CAP_SETPCAP, so
+	// that the commands can't regain capabilities by executing a setuid
+	// or file capability binary, or by running as root.
+	for c := uintptr(0); c <= last; c++ {
+		if kept[c] {
+			continue
+		}
+		r, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapbsetRead, c, 0)
+		if errno != 0 {
+			return nil, fmt.Errorf("reading capability %d: %s", c, errno.Error())
+		}
+		if r == 0 {
+			continue
+		}
+		if _, _, errno = syscall.RawSyscall(syscall.SYS_PRCTL, prCapbsetDrop, c, 0); errno != 0 {
+			return nil, fmt.Errorf("dropping capability %d: %s", c, errno.Error())
+		}
+	}
+
+	// Ambient capabilities aren't supported before Linux 4.3, in which
+	// case there are none to clear.
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0, 0, 0, 0)
+	if errno != 0 && errno != syscall.EINVAL {
+		return nil, fmt.Errorf("clearing ambient capabilities: %s", errno.Error())
+	}
+
+	hdr := capHeader{version: linuxCapabilityVersion3}
+	var data [2]capData
+	if _, _, errno = syscall.RawSyscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return nil, fmt.Errorf("getting capabilities: %s", errno.Error())
+	}
+
+	var permitted []uintptr
+	for i := range data {
+		var mask uint32
+		for c := range kept {
+			if c/32 == uintptr(i) {
+				mask |= 1 << (c % 32)
+			}
+		}
+		data[i].effective &= mask
+		data[i].permitted &= mask
+		data[i].inheritable = data[i].permitted
+		for c := uintptr(0); c < 32; c++ {
+			if data[i].permitted&(1<<c) != 0 {
+				permitted = append(permitted, uintptr(i)*32+c)
+			}
+		}
+	}
+	if _, _, errno = syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return nil, fmt.Errorf("setting capabilities: %s", errno.Error())
+	}
+	return permitted, nil
+}
+
+// startWithCapabilities calls start on a thread that has dropped all
+// capabilities other than keep, see startOnThread, raising the kept
+// capabilities in cmd's ambient set.  Capabilities are dropped last, see
+// startOnThreadLast, so that the options changing the thread otherwise,
+// e.g. WithReadOnlyView's mounts, can use them regardless of their order.
+func startWithCapabilities(cmd *exec.Cmd, keep []uintptr, start func() error) (func(), error) {
+	return startOnThreadLast(cmd, func() error {
+		permitted, err := dropCapabilities(keep)
+		if err != nil {
+			return err
+		}
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.AmbientCaps = permitted
+		return nil
+	}, start)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// startWithCapabilities fails, as this platform doesn't have capabilities.
+func startWithCapabilities(cmd *exec.Cmd, keep []uintptr, start func() error) (func(), error) {
+	return nil, errors.New("capabilities not supported on this platform")
+}
@@ -0,0 +1,143 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Capture is an io.Writer that captures all output written to it, sized
+// up front from a hint of the expected output size so that large outputs,
+// e.g. from pg_dump, aren't copied over and over as a bytes.Buffer grows.
+// Output larger than a threshold is spooled to a temporary file instead of
+// being held in memory.
+type Capture struct {
+	mu         sync.Mutex
+	buf        []byte
+	spoolAbove int64
+	dir        string
+	f          *os.File
+	n          int64
+	err        error
+}
+
+// NewCapture returns a Capture expecting sizeHint bytes of output.  If
+// spoolAbove is positive, output is spooled to a temporary file in dir, or
+// the default temporary directory if dir is empty, once it exceeds
+// spoolAbove bytes, or right away if sizeHint does.  The Capture must be
+// closed to remove the file.
+func NewCapture(sizeHint int64, spoolAbove int64, dir string) (*Capture, error) {
+	c := &Capture{spoolAbove: spoolAbove, dir: dir}
+	if spoolAbove > 0 && sizeHint > spoolAbove {
+		if err := c.spool(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	if sizeHint > 0 {
+		c.buf = make([]byte, 0, sizeHint)
+	}
+	return c, nil
+}
+
+// spool moves the captured output to a temporary file.
+func (c *Capture) spool() error {
+	f, err := ioutil.TempFile(c.dir, "capture-")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(c.buf); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	c.f, c.buf = f, nil
+	return nil
+}
+
+func (c *Capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.f == nil && c.spoolAbove > 0 && c.n+int64(len(p)) > c.spoolAbove {
+		if c.err = c.spool(); c.err != nil {
+			return 0, c.err
+		}
+	}
+
+	n := len(p)
+	if c.f != nil {
+		n, c.err = c.f.Write(p)
+	} else {
+		c.buf = append(c.buf, p...)
+	}
+	c.n += int64(n)
+	return n, c.err
+}
+
+// Len returns the number of bytes captured.
+func (c *Capture) Len() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.n
+}
+
+// Spooled returns true if the output was spooled to a file.
+func (c *Capture) Spooled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.f != nil
+}
+
+// Bytes returns the captured output, read into memory if it was spooled.
+// The returned slice aliases the in-memory capture, if any.
+func (c *Capture) Bytes() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		return c.buf, c.err
+	}
+	data := make([]byte, c.n)
+	if _, err := c.f.ReadAt(data, 0); err != nil {
+		return nil, err
+	}
+	return data, c.err
+}
+
+// Reader returns a reader of the captured output, which reads spooled
+// output from the file rather than into memory.  The reader is invalid
+// once the Capture is closed.
+func (c *Capture) Reader() io.Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		return bytes.NewReader(c.buf)
+	}
+	return io.NewSectionReader(c.f, 0, c.n)
+}
+
+// Close releases the captured output, removing the spool file, if any.
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf = nil
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	if rerr := os.Remove(c.f.Name()); err == nil {
+		err = rerr
+	}
+	c.f = nil
+	return err
+}
@@ -0,0 +1,74 @@
+package pipes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name             string
+		sizeHint, spool  int64
+		writes           []string
+		wantSpooled      bool
+		wantSpooledFirst bool
+	}{
+		{"memory", 4, 0, []string{"ab", "cdef"}, false, false},
+		{"below threshold", 0, 6, []string{"ab", "cdef"}, false, false},
+		{"above threshold", 0, 5, []string{"ab", "cdef"}, true, false},
+		{"hint above threshold", 10, 5, []string{"ab", "cdef"}, true, true},
+	} {
+		c, err := NewCapture(tt.sizeHint, tt.spool, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Spooled() != tt.wantSpooledFirst {
+			t.Errorf("%s: Spooled() = %v before writing", tt.name, c.Spooled())
+		}
+		for _, w := range tt.writes {
+			if n, err := c.Write([]byte(w)); n != len(w) || err != nil {
+				t.Fatalf("%s: Write = %d, %v", tt.name, n, err)
+			}
+		}
+		if c.Spooled() != tt.wantSpooled || c.Len() != 6 {
+			t.Errorf("%s: Spooled() = %v, Len() = %d", tt.name, c.Spooled(), c.Len())
+		}
+		if data, err := c.Bytes(); err != nil || string(data) != "abcdef" {
+			t.Errorf("%s: Bytes() = %q, %v", tt.name, data, err)
+		}
+		if data, err := ioutil.ReadAll(c.Reader()); err != nil || string(data) != "abcdef" {
+			t.Errorf("%s: Reader() read %q, %v", tt.name, data, err)
+		}
+		if err := c.Close(); err != nil {
+			t.Errorf("%s: Close() = %v", tt.name, err)
+		}
+	}
+
+	// Spool files are removed on Close.
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left in %s", len(entries), dir)
+	}
+}
+
+func TestCaptureCommand(t *testing.T) {
+	c, err := NewCapture(1<<20, 1<<16, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := Exec(exec.Command("head", "-c", "1000000", "/dev/zero"), nil, c, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.Bytes()
+	if err != nil || !c.Spooled() || !bytes.Equal(data, make([]byte, 1000000)) {
+		t.Errorf("captured %d bytes, spooled %v, %v", len(data), c.Spooled(), err)
+	}
+
+	if _, err := NewCapture(10, 5, "/nonexistent"); !os.IsNotExist(err) {
+		t.Errorf("error = %v for missing spool directory", err)
+	}
+}
@@ -0,0 +1,153 @@
+package pipes
+
+import (
+	"io"
+	"math/rand"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Chaos injects faults into executions according to a seeded policy, to
+// validate that callers' retry and cleanup logic actually works, see
+// WithChaos.  Probabilities range from 0, never, to 1, always.
+type Chaos struct {
+	// Seed seeds the random decisions, so that a run can be replayed.
+	Seed int64
+
+	// KillProbability is the probability that a command is killed, at a
+	// random time up to MaxKillDelay after it's started.
+	KillProbability float64
+	MaxKillDelay    time.Duration
+
+	// FailProbability is the probability that a command isn't run but
+	// instead exits with FailExitCode, e.g. a transient error code.
+	FailProbability float64
+	FailExitCode    int
+
+	// DelayProbability is the probability that each write of the
+	// pipeline's output is delayed by a random duration up to MaxDelay.
+	DelayProbability float64
+	MaxDelay         time.Duration
+
+	// TruncateProbability is the probability that the pipeline's output
+	// is silently truncated at a random offset of up to TruncateMax bytes.
+	TruncateProbability float64
+	TruncateMax         int64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// roll returns true with probability p.
+func (ch *Chaos) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.rng == nil {
+		ch.rng = rand.New(rand.NewSource(ch.Seed))
+	}
+	return ch.rng.Float64() < p
+}
+
+// int63n returns a random number in [0, n), or 0 if n isn't positive.
+func (ch *Chaos) int63n(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.rng == nil {
+		ch.rng = rand.New(rand.NewSource(ch.Seed))
+	}
+	return ch.rng.Int63n(n)
+}
+
+type delayWriter struct {
+	w  io.Writer
+	ch *Chaos
+}
+
+func (d *delayWriter) Write(p []byte) (int, error) {
+	if d.ch.roll(d.ch.DelayProbability) {
+		time.Sleep(time.Duration(d.ch.int63n(int64(d.ch.MaxDelay))))
+	}
+	return d.w.Write(p)
+}
+
+// truncWriter forwards the first n bytes written to it and discards the
+// rest, while reporting success.
+type truncWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (t *truncWriter) Write(p []byte) (int, error) {
+	if t.n <= 0 {
+		return len(p), nil
+	}
+	b := p
+	if int64(len(b)) > t.n {
+		b = b[:t.n]
+	}
+	n, err := t.w.Write(b)
+	t.n -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	return len(p), nil
+}
+
+// WithChaos injects faults into the execution according to ch, which may be
+// shared by executions, whose decisions are then drawn from the same seeded
+// sequence.  Only meant for resilience testing.
+func WithChaos(ch *Chaos) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			if c.stdout == nil {
+				return nil
+			}
+			if ch.roll(ch.TruncateProbability) {
+				c.stdout = &truncWriter{c.stdout, ch.int63n(ch.TruncateMax)}
+			}
+			if ch.DelayProbability > 0 {
+				c.stdout = &delayWriter{c.stdout, ch}
+			}
+			return nil
+		})
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			if ch.roll(ch.FailProbability) {
+				// Restore the command once started, so that errors
+				// and the Result refer to the command, not the shell.
+				path, args := cmd.Path, cmd.Args
+				sh, err := exec.LookPath("sh")
+				if err != nil {
+					return err
+				}
+				cmd.Path, cmd.Args = sh, []string{"sh", "-c", "exit " + strconv.Itoa(ch.FailExitCode)}
+				err = start()
+				cmd.Path, cmd.Args = path, args
+				return err
+			}
+
+			if err := start(); err != nil {
+				return err
+			}
+			if ch.roll(ch.KillProbability) {
+				timer := time.AfterFunc(time.Duration(ch.int63n(int64(ch.MaxKillDelay))), func() {
+					cmd.Process.Kill()
+				})
+				c.onRelease(func() {
+					timer.Stop()
+				})
+			}
+			return nil
+		}, nil)
+	}
+}
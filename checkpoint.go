@@ -0,0 +1,107 @@
+package pipes
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// ExecPipelineCheckpoint pipes several commands together, optionally reading
+// data from stdin for the first command, writing the output from the last
+// command to stdout and writing all commands' Stderr output to stderr, like
+// ExecPipeline.  Additionally, the output of each command whose index is a
+// key in checkpoints is persisted to the file named by the corresponding
+// value and then fed to the next command.  If a checkpoint file already
+// exists, the pipeline resumes from the last completed checkpoint, i.e. the
+// commands up to and including the checkpointed command are not run and
+// stdin is ignored.  Checkpoint files are written to a temporary file and
+// renamed once the command succeeds, so a partial checkpoint is never used
+// to resume.  Callers are responsible for removing checkpoint files once
+// they are no longer needed.  Returns an error containing the command that
+// failed as well as the system error string.
+func ExecPipelineCheckpoint(cmds []*exec.Cmd, checkpoints map[int]string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	// Require at least one command
+	if len(cmds) < 1 {
+		return fmt.Errorf("No commands provided to ExecPipelineCheckpoint")
+	}
+
+	stages := make([]int, 0, len(checkpoints))
+	for i := range checkpoints {
+		if i < 0 || i >= len(cmds) {
+			return fmt.Errorf("Checkpoint %d is out of range for %d commands", i, len(cmds))
+		}
+		stages = append(stages, i)
+	}
+	sort.Ints(stages)
+
+	// Find the last completed checkpoint, if any, and resume from there
+	start, input := 0, stdin
+	for j := len(stages) - 1; j >= 0; j-- {
+		f, err := os.Open(checkpoints[stages[j]])
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		start, input, stages = stages[j]+1, f, stages[j+1:]
+		break
+	}
+
+	// Run each segment of the pipeline up to the next checkpoint, persisting
+	// its output and feeding the persisted output to the next segment.
+	for _, stage := range stages {
+		path := checkpoints[stage]
+		if err := execCheckpoint(cmds[start:stage+1], path, input, stderr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		start, input = stage+1, f
+	}
+
+	// The last command may itself be checkpointed, in which case all that's
+	// left is to copy its output.
+	if start == len(cmds) {
+		if stdout != nil {
+			_, err := copyStream(stdout, input)
+			return err
+		}
+		return nil
+	}
+	return ExecPipeline(cmds[start:], input, stdout, stderr)
+}
+
+// execCheckpoint runs a segment of a pipeline, atomically writing its output
+// to path on success.
+func execCheckpoint(cmds []*exec.Cmd, path string, stdin io.Reader, stderr io.Writer) error {
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	err = ExecPipeline(cmds, stdin, f, stderr)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package pipes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecPipelineCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	checkpoints := map[int]string{0: filepath.Join(dir, "0"), 1: filepath.Join(dir, "1")}
+
+	// Each stage records that it ran, and the last fails unless ok.
+	stages := func(ok bool) []*exec.Cmd {
+		status := "1"
+		if ok {
+			status = "0"
+		}
+		return []*exec.Cmd{
+			exec.Command("sh", "-c", "echo 0 >>"+runs+"; cat"),
+			exec.Command("sh", "-c", "echo 1 >>"+runs+"; tr a-z A-Z"),
+			exec.Command("sh", "-c", "echo 2 >>"+runs+"; cat; exit "+status),
+		}
+	}
+	ran := func() string {
+		data, _ := ioutil.ReadFile(runs)
+		os.Remove(runs)
+		return strings.Replace(string(data), "\n", "", -1)
+	}
+
+	if err := ExecPipelineCheckpoint(stages(false), checkpoints, strings.NewReader("data"), nil, nil); err == nil {
+		t.Fatal("no error for failing stage")
+	}
+	if got := ran(); got != "012" {
+		t.Errorf("ran stages %s, want 012", got)
+	}
+	for i, want := range []string{"data", "DATA"} {
+		if data, err := ioutil.ReadFile(checkpoints[i]); err != nil || string(data) != want {
+			t.Errorf("checkpoint %d = %q, %v, want %q", i, data, err, want)
+		}
+	}
+
+	// Resuming skips the checkpointed stages and ignores stdin.
+	var stdout bytes.Buffer
+	if err := ExecPipelineCheckpoint(stages(true), checkpoints, strings.NewReader("other"), &stdout, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := ran(); got != "2" {
+		t.Errorf("ran stages %s, want 2", got)
+	}
+	if stdout.String() != "DATA" {
+		t.Errorf("stdout = %q, want DATA", stdout.String())
+	}
+
+	// A failing stage leaves no partial checkpoint.
+	os.Remove(checkpoints[1])
+	failing := stages(true)
+	failing[1] = exec.Command("sh", "-c", "echo partial; exit 1")
+	if err := ExecPipelineCheckpoint(failing, checkpoints, nil, nil, nil); err == nil {
+		t.Fatal("no error for failing stage")
+	}
+	if _, err := os.Stat(checkpoints[1]); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of failing stage exists, error = %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); matches != nil {
+		t.Errorf("temporary files %q left behind", matches)
+	}
+
+	// If the last stage is checkpointed, its output is copied.
+	ran()
+	stdout.Reset()
+	checkpoints[2] = filepath.Join(dir, "2")
+	if err := ExecPipelineCheckpoint(stages(true), checkpoints, nil, &stdout, nil); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if err := ExecPipelineCheckpoint(stages(true), checkpoints, nil, &stdout, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := ran(); got != "12" {
+		t.Errorf("ran stages %s, want 12", got)
+	}
+	if stdout.String() != "DATA" {
+		t.Errorf("stdout = %q, want DATA", stdout.String())
+	}
+
+	if err := ExecPipelineCheckpoint(stages(true), map[int]string{3: "x"}, nil, nil, nil); err == nil {
+		t.Error("no error for out of range checkpoint")
+	}
+	if err := ExecPipelineCheckpoint(nil, nil, nil, nil, nil); err == nil {
+		t.Error("no error for no commands")
+	}
+}
@@ -0,0 +1,32 @@
+package pipes
+
+import (
+	"time"
+)
+
+// Clock tells the time, so that tests can control the time seen by a Runner
+// or Breaker, e.g. with a fake clock.
+type Clock interface {
+	Now() time.Time
+	// After waits for d to elapse and then sends the current time on the
+	// returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// clockOrReal returns clock, or the real clock if clock is nil.
+func clockOrReal(clock Clock) Clock {
+	if clock == nil {
+		return realClock{}
+	}
+	return clock
+}
@@ -0,0 +1,87 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// EndOfOptions is the conventional argument marking the end of a command's
+// options; all subsequent arguments are operands even if they start with a
+// dash.
+const EndOfOptions = "--"
+
+// Args returns argument templates for Command.
+func Args(templates ...string) []string {
+	return templates
+}
+
+// Operands returns argument templates for Command that are preceded by
+// EndOfOptions, so that interpolated values starting with a dash can't be
+// mistaken for options.
+func Operands(templates ...string) []string {
+	return append([]string{EndOfOptions}, templates...)
+}
+
+// errNUL is returned by expandTemplate if the result contains a NUL byte.
+var errNUL = errors.New("contains a NUL byte")
+
+// expandTemplate expands the text/template text applied to data.
+func expandTemplate(name string, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err = tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	if strings.IndexByte(sb.String(), 0) >= 0 {
+		return "", errNUL
+	}
+	return sb.String(), nil
+}
+
+// templateError describes the failure to expand the i'th template of the
+// given kind, e.g. "argument", for name.
+func templateError(name string, what string, i int, err error) error {
+	if err == errNUL {
+		return fmt.Errorf("%s %s %d %s", name, what, i+1, err.Error())
+	}
+	return fmt.Errorf("%s %s %d: %s", name, what, i+1, err.Error())
+}
+
+// Command returns an exec.Cmd to execute the named program with arguments
+// expanded from text/template templates applied to data, e.g.
+//
+//	pipes.Command("rsync", pipes.Args("--exclude={{.Pattern}}", "{{.Src}}", "{{.Dst}}"), data)
+//
+// Each template expands to exactly one argument, regardless of whitespace
+// or shell metacharacters in the interpolated values, as no shell is ever
+// involved.  Returns an error if a template references a missing value, an
+// argument contains a NUL byte, which can't be passed to a program, or an
+// argument before EndOfOptions starts with a dash that comes from an
+// interpolated value rather than the template itself, as that would let the
+// value inject an option.
+func Command(name string, args []string, data interface{}) (*exec.Cmd, error) {
+	argv := make([]string, len(args))
+	operands := false
+
+	for i, text := range args {
+		arg, err := expandTemplate(name, text, data)
+		if err != nil {
+			return nil, templateError(name, "argument", i, err)
+		}
+		if !operands && strings.HasPrefix(arg, "-") && !strings.HasPrefix(text, "-") {
+			return nil, fmt.Errorf("%s argument %d %q would be interpreted as an option, use Operands", name, i+1, arg)
+		}
+		if text == EndOfOptions {
+			operands = true
+		}
+		argv[i] = arg
+	}
+	return exec.Command(name, argv...), nil
+}
@@ -0,0 +1,39 @@
+package pipes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	data := map[string]string{
+		"Pattern": "*.o; rm -rf /",
+		"Src":     "my files/",
+		"Dst":     "-host:dst",
+		"NUL":     "a\x00b",
+	}
+
+	// Each template expands to exactly one argument.
+	cmd, err := Command("rsync", append(Args("--exclude={{.Pattern}}", "{{.Src}}"), Operands("{{.Dst}}")...), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"rsync", "--exclude=*.o; rm -rf /", "my files/", "--", "-host:dst"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Args = %q, want %q", cmd.Args, want)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{Args("{{.Dst}}"), "rsync argument 1 \"-host:dst\" would be interpreted as an option, use Operands"},
+		{Args("{{.Missing}}"), "rsync argument 1: "},
+		{Args("a", "{{.NUL}}"), "rsync argument 2 contains a NUL byte"},
+		{Args("{{.Src"), "rsync argument 1: "},
+	} {
+		if _, err := Command("rsync", tt.args, data); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Command(%q) error = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package pipes
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// WithConn binds the pipeline's stdin and stdout to conn, e.g. a client
+// connection accepted by a network service.  If conn is backed by a file
+// descriptor, e.g. a *net.TCPConn or *net.UnixConn, the commands read and
+// write the socket directly rather than via a goroutine copying each
+// direction.  Otherwise, e.g. for a TLS connection, conn is used as an
+// io.Reader and io.Writer.  conn isn't closed.
+func WithConn(conn net.Conn) Option {
+	return func(c *config) {
+		fc, ok := conn.(interface {
+			File() (f *os.File, err error)
+		})
+		if !ok {
+			c.stdin, c.stdout = conn, conn
+			return
+		}
+
+		c.onSetup(func(c *config) error {
+			// File returns a duplicate of the descriptor, which is
+			// passed to the commands and closed once they complete.
+			f, err := fc.File()
+			if err != nil {
+				return err
+			}
+			c.stdin, c.stdout = f, f
+			c.onRelease(func() {
+				f.Close()
+			})
+			return nil
+		})
+	}
+}
+
+// Server is an inetd-style server that executes a fresh pipeline for each
+// connection it accepts, with the pipeline's stdin and stdout bound to the
+// connection, see WithConn.
+type Server struct {
+	// Runner executes the pipelines, or a zero Runner if nil.
+	Runner *Runner
+	// Pipeline returns the commands to execute for conn.
+	Pipeline func(conn net.Conn) []*exec.Cmd
+	// Options configure each execution.
+	Options []Option
+
+	// MaxConns, if positive, limits the number of connections served
+	// concurrently.  Further connections aren't accepted until one
+	// completes.
+	MaxConns int
+	// IdleTimeout, if positive, kills a connection's pipeline and closes
+	// the connection once nothing has been read from or written to it
+	// for IdleTimeout.  Detecting idleness requires copying the
+	// connection's data, so the commands read and write pipes rather
+	// than the connection itself.
+	IdleTimeout time.Duration
+}
+
+// idleConn is a net.Conn that calls the idle timer's function once it's
+// been idle for the timeout.
+type idleConn struct {
+	net.Conn
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.timer.Reset(c.timeout)
+	return n, err
+}
+
+func (c *idleConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.timer.Reset(c.timeout)
+	return n, err
+}
+
+// serveConn executes the pipeline for conn and closes conn.
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	r := s.Runner
+	if r == nil {
+		r = &Runner{}
+	}
+	if s.IdleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		// Close the connection as well, lest copying its data to the
+		// commands keep the execution waiting.
+		c := conn
+		timer := time.AfterFunc(s.IdleTimeout, func() {
+			cancel()
+			c.Close()
+		})
+		defer timer.Stop()
+		conn = &idleConn{Conn: conn, timer: timer, timeout: s.IdleTimeout}
+	}
+
+	opts := append(s.Options[:len(s.Options):len(s.Options)], WithConn(conn))
+	r.ExecPipeline(ctx, s.Pipeline(conn), opts...)
+}
+
+// Serve accepts connections on l until ctx is done or accepting fails, and
+// serves each in its own goroutine.  Each connection is closed once its
+// pipeline completes.  The pipelines' errors are only reported to the
+// Runner's AuditSink, if any.  Serve closes l once ctx is done and returns
+// once all pipelines have completed, with the error that stopped accepting,
+// or nil if ctx is done.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-stop:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var slots chan struct{}
+	if s.MaxConns > 0 {
+		slots = make(chan struct{}, s.MaxConns)
+	}
+
+	for {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+			if slots != nil {
+				<-slots
+			}
+		}()
+	}
+}
+
+// Serve serves connections on l with a Server that executes the pipeline
+// returned by cmds for each connection, like inetd, see Server.Serve.
+func (r *Runner) Serve(ctx context.Context, l net.Listener, cmds func() []*exec.Cmd, opts ...Option) error {
+	s := &Server{
+		Runner:   r,
+		Pipeline: func(conn net.Conn) []*exec.Cmd { return cmds() },
+		Options:  opts,
+	}
+	return s.Serve(ctx, l)
+}
@@ -0,0 +1,185 @@
+package pipes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"sync"
+)
+
+// ReadResponse reads a single response to a request from a Coprocess's
+// stdout.  It must consume exactly one response, as defined by the
+// coprocess's protocol, and no more.
+type ReadResponse func(r *bufio.Reader) ([]byte, error)
+
+// ReadLine is a ReadResponse for line-oriented protocols, e.g. `git
+// cat-file --batch-check`.  The returned line does not include the trailing
+// newline.
+func ReadLine(r *bufio.Reader) ([]byte, error) {
+	return ReadRecord('\n')(r)
+}
+
+// ReadRecord returns a ReadResponse for protocols whose responses are
+// terminated by delim, e.g. NUL for `git cat-file --batch-check -z`.  The
+// returned record does not include delim.
+func ReadRecord(delim byte) ReadResponse {
+	return func(r *bufio.Reader) ([]byte, error) {
+		record, err := r.ReadBytes(delim)
+		if err != nil {
+			return nil, err
+		}
+		return record[:len(record)-1], nil
+	}
+}
+
+// Coprocess manages a long-lived child process that serves many requests
+// over its stdin and stdout, e.g. `git cat-file --batch`, instead of forking
+// a new process per request.  Requests are written in the order Do is called
+// and responses are read in the same order, so concurrent callers pipeline
+// their requests rather than waiting for each other's responses.  Once
+// writing a request or reading a response fails, the stream is out of sync
+// and all subsequent requests fail.
+type Coprocess struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	pending chan *coRequest
+	done    chan struct{}
+
+	// mu serializes writing requests and queueing them for the reader.
+	mu     sync.Mutex
+	closed bool
+
+	errMu sync.Mutex
+	err   error
+}
+
+type coRequest struct {
+	read ReadResponse
+	resp chan coResponse
+}
+
+type coResponse struct {
+	data []byte
+	err  error
+}
+
+// StartCoprocess starts cmd as a Coprocess, writing its Stderr output to
+// stderr, which is discarded if nil.  Returns an error containing the
+// command that failed as well as the system error string.
+func StartCoprocess(cmd *exec.Cmd, stderr io.Writer) (*Coprocess, error) {
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", cmd.Path, err.Error())
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", cmd.Path, err.Error())
+	}
+	if err = forkTracked(cmd); err != nil {
+		return nil, fmt.Errorf("%s %s", cmd.Path, err.Error())
+	}
+
+	c := &Coprocess{
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  bufio.NewReader(stdout),
+		pending: make(chan *coRequest, 64),
+		done:    make(chan struct{}),
+	}
+	go c.reader()
+	return c, nil
+}
+
+// reader reads responses for pending requests, in order.
+func (c *Coprocess) reader() {
+	defer close(c.done)
+
+	var failed error
+	for req := range c.pending {
+		if failed != nil {
+			req.resp <- coResponse{err: failed}
+			continue
+		}
+		data, err := req.read(c.stdout)
+		if err != nil {
+			failed = c.fail(err)
+			err = failed
+		}
+		req.resp <- coResponse{data: data, err: err}
+	}
+}
+
+func (c *Coprocess) broken() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// fail marks the Coprocess as broken, returning the wrapped error.
+func (c *Coprocess) fail(err error) error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+
+	if c.err == nil {
+		c.err = fmt.Errorf("%s %s", c.cmd.Path, err.Error())
+	}
+	return c.err
+}
+
+// Do writes req to the coprocess's stdin and returns the response read by
+// read.  Do may be called concurrently.  Returns an error containing the
+// command as well as the system error string if the request or response
+// couldn't be transferred.
+func (c *Coprocess) Do(req []byte, read ReadResponse) ([]byte, error) {
+	r := &coRequest{read: read, resp: make(chan coResponse, 1)}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%s coprocess is closed", c.cmd.Path)
+	}
+	if err := c.broken(); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	if _, err := c.stdin.Write(req); err != nil {
+		c.mu.Unlock()
+		return nil, c.fail(err)
+	}
+	c.pending <- r
+	c.mu.Unlock()
+
+	resp := <-r.resp
+	return resp.data, resp.err
+}
+
+// Close closes the coprocess's stdin, waits for outstanding requests to
+// complete and for the coprocess to exit.  Returns an error containing the
+// command as well as the system error string if the coprocess failed.
+func (c *Coprocess) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return fmt.Errorf("%s coprocess is closed", c.cmd.Path)
+	}
+	c.closed = true
+	c.stdin.Close()
+	close(c.pending)
+	c.mu.Unlock()
+
+	<-c.done
+	err := c.cmd.Wait()
+	untrack(c.cmd)
+	if err != nil {
+		return fmt.Errorf("%s %s", c.cmd.Path, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package pipes
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"testing"
+)
+
+func TestCoprocess(t *testing.T) {
+	c, err := StartCoprocess(exec.Command("cat"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent requests each get their own response.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := fmt.Sprint(i)
+			if resp, err := c.Do([]byte(req+"\n"), ReadLine); err != nil || string(resp) != req {
+				t.Errorf("Do(%s) = %q, %v", req, resp, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do([]byte("x\n"), ReadLine); err == nil {
+		t.Error("no error for request after Close")
+	}
+	if err := c.Close(); err == nil {
+		t.Error("no error for second Close")
+	}
+}
+
+func TestCoprocessBroken(t *testing.T) {
+	c, err := StartCoprocess(exec.Command("sh", "-c", "read x; echo $x; exit 3"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := c.Do([]byte("a\n"), ReadLine); err != nil || string(resp) != "a" {
+		t.Errorf("Do = %q, %v, want a", resp, err)
+	}
+
+	// Once a response can't be read, all subsequent requests fail.
+	if _, err := c.Do([]byte("b\n"), ReadLine); err == nil {
+		t.Error("no error for request to exited coprocess")
+	}
+	if _, err := c.Do([]byte("c\n"), ReadLine); err == nil {
+		t.Error("no error for request to broken coprocess")
+	}
+	if err := c.Close(); err == nil {
+		t.Error("no error for failed coprocess")
+	}
+}
@@ -0,0 +1,62 @@
+package pipes
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// WithCoreDumps enables core dumps for the commands at the given stages, or
+// all commands if no stages are given, by raising their RLIMIT_CORE soft
+// limit to the hard limit.  If a command dumps its core, the core file's
+// path is included in the returned error, and if dir is non-empty, the core
+// file is moved into dir, as the kernel's core pattern is global rather
+// than per-execution.  Core files are only located on Linux, where the core
+// pattern doesn't pipe cores to a handler such as systemd-coredump.  Not
+// supported on Windows.
+func WithCoreDumps(dir string, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			return startWithCoreLimit(cmd, true, start)
+		}, stages)
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			err := wait()
+			if err != nil {
+				if path := coreFile(cmd, dir); path != "" {
+					err = fmt.Errorf("%w, core file %s", err, path)
+				}
+			}
+			return err
+		}, stages)
+	}
+}
+
+// WithoutCoreDumps disables core dumps for the commands at the given stages,
+// or all commands if no stages are given, by lowering their RLIMIT_CORE soft
+// limit to zero, e.g. so that crashing commands don't fill the disk or leak
+// sensitive data in core files.  Not supported on Windows.
+func WithoutCoreDumps(stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			return startWithCoreLimit(cmd, false, start)
+		}, stages)
+	}
+}
+
+// coreFile returns the path of the core file dumped by cmd, if any, having
+// moved it into dir if dir is non-empty.
+func coreFile(cmd *exec.Cmd, dir string) string {
+	if cmd.ProcessState == nil {
+		return ""
+	}
+	path := locateCore(cmd)
+	if path == "" || dir == "" {
+		return path
+	}
+	moved := filepath.Join(dir, filepath.Base(path))
+	if err := os.Rename(path, moved); err != nil {
+		return path
+	}
+	return moved
+}
@@ -0,0 +1,92 @@
+package pipes
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// locateCore returns the path of the core file dumped by cmd, which has
+// been waited for, by expanding the kernel's core pattern, see core(5), or
+// an empty string if cmd didn't dump its core or it can't be located.
+func locateCore(cmd *exec.Cmd) string {
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.CoreDump() {
+		return ""
+	}
+	b, err := ioutil.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil {
+		return ""
+	}
+	// Cores piped to a handler, e.g. systemd-coredump, aren't files.
+	pattern := strings.TrimSpace(string(b))
+	if pattern == "" || pattern[0] == '|' {
+		return ""
+	}
+
+	pid := strconv.Itoa(cmd.Process.Pid)
+	var sb strings.Builder
+	glob := false
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			sb.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case '%':
+			sb.WriteByte('%')
+		case 'p', 'P', 'i', 'I':
+			sb.WriteString(pid)
+		case 's':
+			sb.WriteString(strconv.Itoa(int(status.Signal())))
+		case 'e':
+			// The kernel truncates command names to 15 bytes.
+			comm := filepath.Base(cmd.Path)
+			if len(comm) > 15 {
+				comm = comm[:15]
+			}
+			sb.WriteString(comm)
+		case 'h':
+			host, _ := os.Hostname()
+			sb.WriteString(host)
+		default:
+			// E.g. the time of the dump, which isn't known exactly.
+			sb.WriteByte('*')
+			glob = true
+		}
+	}
+	if b, err := ioutil.ReadFile("/proc/sys/kernel/core_uses_pid"); err == nil && strings.TrimSpace(string(b)) == "1" && !strings.Contains(pattern, "%p") {
+		sb.WriteString("." + pid)
+	}
+
+	path := sb.String()
+	if !filepath.IsAbs(path) {
+		dir := cmd.Dir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		path = filepath.Join(dir, path)
+	}
+	if !glob {
+		if _, err := os.Stat(path); err != nil {
+			return ""
+		}
+		return path
+	}
+
+	// Pick the most recent match.
+	matches, _ := filepath.Glob(path)
+	path = ""
+	var newest int64
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.ModTime().UnixNano() >= newest {
+			path, newest = match, info.ModTime().UnixNano()
+		}
+	}
+	return path
+}
@@ -0,0 +1,68 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// childCoreLimit returns the soft RLIMIT_CORE of a command run with opts,
+// as shown by /proc/<pid>/limits.
+func childCoreLimit(t *testing.T, opts ...Option) string {
+	var out bytes.Buffer
+	cmd := exec.Command("grep", "Max core file size", "/proc/self/limits")
+	if _, err := (&Runner{}).Exec(context.Background(), cmd, append(opts, WithStdout(&out))...); err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(strings.TrimPrefix(out.String(), "Max core file size"))
+	if len(fields) < 2 {
+		t.Fatalf("unexpected limits %q", out.String())
+	}
+	return fields[0]
+}
+
+func TestCoreLimit(t *testing.T) {
+	var old syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &old); err != nil {
+		t.Fatal(err)
+	}
+	if old.Max == 0 {
+		t.Skip("hard RLIMIT_CORE is zero")
+	}
+	// Start from a soft limit that neither option leaves in place.
+	lim := syscall.Rlimit{Cur: 1 << 20, Max: old.Max}
+	if old.Max < lim.Cur {
+		lim.Cur = old.Max / 2
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &lim); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_CORE, &old)
+
+	if got := childCoreLimit(t, WithoutCoreDumps()); got != "0" {
+		t.Errorf("WithoutCoreDumps: child's soft limit = %s, want 0", got)
+	}
+	want := "unlimited"
+	if old.Max != ^uint64(0) {
+		want = strconv.FormatUint(old.Max, 10)
+	}
+	if got := childCoreLimit(t, WithCoreDumps("")); got != want {
+		t.Errorf("WithCoreDumps: child's soft limit = %s, want %s", got, want)
+	}
+
+	// Neither this process nor other commands keep the changed limit.
+	var cur syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &cur); err != nil {
+		t.Fatal(err)
+	}
+	if cur != lim {
+		t.Errorf("RLIMIT_CORE = %+v after starting commands, want %+v", cur, lim)
+	}
+	if got, want := childCoreLimit(t), strconv.FormatUint(lim.Cur, 10); got != want {
+		t.Errorf("child's soft limit = %s without options, want %s", got, want)
+	}
+}
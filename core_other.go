@@ -0,0 +1,18 @@
+//go:build !unix
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// startWithCoreLimit fails, as this platform doesn't have core dumps.
+func startWithCoreLimit(cmd *exec.Cmd, enable bool, start func() error) error {
+	return errors.New("core dumps not supported on this platform")
+}
+
+// forkCmd starts cmd.
+func forkCmd(cmd *exec.Cmd) error {
+	return forkTracked(cmd)
+}
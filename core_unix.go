@@ -0,0 +1,73 @@
+//go:build unix
+
+package pipes
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// forkMu is held for reading while commands are started, and for writing
+// while this process's resource limits are changed for a command to inherit
+// them, so that the changed limits aren't inherited by others.  Commands
+// started other than by a Runner may still inherit them.
+var forkMu sync.RWMutex
+
+// coreLimits holds the commands being started by startWithCoreLimit,
+// mapped to whether their core dumps are enabled.
+var coreLimits = struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]bool
+}{cmds: make(map[*exec.Cmd]bool)}
+
+// startWithCoreLimit calls start, arranging for cmd to be forked with its
+// RLIMIT_CORE soft limit set to the hard limit if enable is true, or to
+// zero otherwise, see forkCmd.  Resource limits are per-process, even on
+// Linux, so the child can only inherit it from this process, and setting
+// it for the child once started would leave a window in which the child
+// could crash with the wrong limit.
+func startWithCoreLimit(cmd *exec.Cmd, enable bool, start func() error) error {
+	coreLimits.Lock()
+	coreLimits.cmds[cmd] = enable
+	coreLimits.Unlock()
+
+	err := start()
+
+	coreLimits.Lock()
+	delete(coreLimits.cmds, cmd)
+	coreLimits.Unlock()
+	return err
+}
+
+// forkCmd starts cmd, with this process's RLIMIT_CORE soft limit changed
+// as arranged by startWithCoreLimit, if at all, and restored once the
+// child has inherited it.
+func forkCmd(cmd *exec.Cmd) error {
+	coreLimits.Lock()
+	enable, ok := coreLimits.cmds[cmd]
+	coreLimits.Unlock()
+	if !ok {
+		forkMu.RLock()
+		defer forkMu.RUnlock()
+		return forkTracked(cmd)
+	}
+
+	forkMu.Lock()
+	defer forkMu.Unlock()
+
+	var old syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &old); err != nil {
+		return err
+	}
+	lim := old
+	lim.Cur = 0
+	if enable {
+		lim.Cur = lim.Max
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &lim); err != nil {
+		return err
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_CORE, &old)
+	return forkTracked(cmd)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package pipes
+
+import "os/exec"
+
+// locateCore isn't supported on this platform.
+func locateCore(cmd *exec.Cmd) string {
+	return ""
+}
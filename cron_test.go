@@ -0,0 +1,45 @@
+package pipes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	// Monday, 15 January 2024, 10:07.
+	now := time.Date(2024, 1, 15, 10, 7, 30, 0, time.UTC)
+	for spec, want := range map[string]time.Time{
+		"* * * * *":              time.Date(2024, 1, 15, 10, 8, 0, 0, time.UTC),
+		"*/15 9-17 * * mon-fri":  time.Date(2024, 1, 15, 10, 15, 0, 0, time.UTC),
+		"0 9 * * 1,3":            time.Date(2024, 1, 17, 9, 0, 0, 0, time.UTC),
+		"30 8 * * 7":             time.Date(2024, 1, 21, 8, 30, 0, 0, time.UTC),
+		"5/20 * * * *":           time.Date(2024, 1, 15, 10, 25, 0, 0, time.UTC),
+		"0 0 1 MAR *":            time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":             time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 13 * fri":           time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC),
+		"@hourly":                time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+		"@weekly":                time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC),
+		"@yearly":                time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		"@every 90s":             now.Add(90 * time.Second),
+		"0 0 30 2 *":             {},
+		" 0-10/5 10 15 jan mon ": time.Date(2024, 1, 15, 10, 10, 0, 0, time.UTC),
+	} {
+		s, err := ParseCron(spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q) error = %v", spec, err)
+			continue
+		}
+		if got := s.Next(now); !got.Equal(want) {
+			t.Errorf("ParseCron(%q).Next = %s, want %s", spec, got, want)
+		}
+	}
+
+	for _, spec := range []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@every 0s", "@every x",
+	} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", spec)
+		}
+	}
+}
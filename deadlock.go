@@ -0,0 +1,79 @@
+package pipes
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+)
+
+// ErrDeadlock is returned, wrapped, for pipelines that are configured such
+// that they're guaranteed to deadlock rather than hang forever.
+var ErrDeadlock = errors.New("pipeline would deadlock")
+
+// ioPipe returns an identifier of the pipe underlying an *io.PipeReader or
+// *io.PipeWriter, or 0 if p is neither or its layout is unknown.  io.Pipe
+// doesn't expose which ends belong together, so peek at the unexported
+// fields: older releases point both ends at a shared *pipe, newer releases
+// embed the pipe in the reader, which the writer embeds in turn.
+func ioPipe(p interface{}) uintptr {
+	var v reflect.Value
+	switch p := p.(type) {
+	case *io.PipeReader:
+		v = reflect.ValueOf(p).Elem()
+	case *io.PipeWriter:
+		v = reflect.ValueOf(p).Elem()
+		if r := v.FieldByName("r"); r.IsValid() && r.Kind() == reflect.Struct {
+			v = r
+		}
+	default:
+		return 0
+	}
+	if f := v.FieldByName("p"); f.IsValid() && f.Kind() == reflect.Ptr {
+		return f.Pointer()
+	}
+	if f := v.FieldByName("pipe"); f.IsValid() && f.Kind() == reflect.Struct {
+		return f.UnsafeAddr()
+	}
+	return 0
+}
+
+// samePipe returns true if r and w are the read and write ends of the same
+// pipe, either an io.Pipe or an OS pipe.
+func samePipe(r io.Reader, w io.Writer) bool {
+	if p := ioPipe(r); p != 0 {
+		return p == ioPipe(w)
+	}
+
+	rf, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	wf, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	rfi, err := rf.Stat()
+	if err != nil || rfi.Mode()&os.ModeNamedPipe == 0 {
+		return false
+	}
+	wfi, err := wf.Stat()
+	if err != nil {
+		return false
+	}
+	// Both ends of an OS pipe share an inode.
+	return os.SameFile(rfi, wfi)
+}
+
+// checkDeadlock returns ErrDeadlock if the pipeline's output is fed back as
+// its own input, in which case the first command never sees the end of its
+// input because the pipeline itself holds the pipe's write end open.
+func checkDeadlock(stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if stdin == nil {
+		return nil
+	}
+	if samePipe(stdin, stdout) || samePipe(stdin, stderr) {
+		return ErrDeadlock
+	}
+	return nil
+}
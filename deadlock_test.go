@@ -0,0 +1,60 @@
+package pipes
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestSamePipe(t *testing.T) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	if ioPipe(r1) == 0 || ioPipe(w1) == 0 {
+		t.Fatal("io.Pipe's layout is unknown")
+	}
+	if !samePipe(r1, w1) || samePipe(r1, w2) || samePipe(r2, w1) {
+		t.Error("io.Pipe ends not matched")
+	}
+
+	or1, ow1, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer or1.Close()
+	defer ow1.Close()
+	or2, ow2, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer or2.Close()
+	defer ow2.Close()
+	if !samePipe(or1, ow1) || samePipe(or1, ow2) || samePipe(or1, w1) || samePipe(r1, ow1) {
+		t.Error("OS pipe ends not matched")
+	}
+}
+
+func TestExecPipelineDeadlock(t *testing.T) {
+	r, w := io.Pipe()
+	or, ow, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer or.Close()
+	defer ow.Close()
+
+	for _, tt := range []struct {
+		stdin          io.Reader
+		stdout, stderr io.Writer
+	}{
+		{r, w, nil},
+		{r, nil, w},
+		{or, ow, nil},
+	} {
+		cmds := []*exec.Cmd{exec.Command("cat"), exec.Command("cat")}
+		if err := ExecPipeline(cmds, tt.stdin, tt.stdout, tt.stderr); !errors.Is(err, ErrDeadlock) {
+			t.Errorf("error = %v, want %v", err, ErrDeadlock)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package pipes
+
+import (
+	"os/exec"
+)
+
+// Diagnostics describes a command that died unexpectedly, i.e. was killed
+// by a signal, e.g. by the OOM killer, see WithDiagnostics.  Fields other
+// than Stage, Pid and Signal are only available on Linux, and only if
+// readable by this process.
+type Diagnostics struct {
+	// Stage is the command's index in the pipeline.
+	Stage int `json:"stage"`
+	Pid   int `json:"pid"`
+	// Signal is the signal that killed the command, and CoreDumped is
+	// true if the kernel dumped its core.
+	Signal     string `json:"signal"`
+	CoreDumped bool   `json:"core_dumped"`
+	// Status is the content of /proc/<pid>/status once the command died.
+	Status string `json:"status,omitempty"`
+	// Cgroup is the command's cgroup v2 path, and MemoryEvents is the
+	// content of the cgroup's memory.events file, which counts OOM kills.
+	Cgroup       string `json:"cgroup,omitempty"`
+	MemoryEvents string `json:"memory_events,omitempty"`
+	// Kernel holds the kernel log lines about OOM kills of the command.
+	Kernel []string `json:"kernel,omitempty"`
+	// CorePattern is the kernel's core_pattern, describing where a core
+	// dump would be written, see core(5).
+	CorePattern string `json:"core_pattern,omitempty"`
+}
+
+// stageIndex returns the index of cmd in cmds, or -1 if not found.
+func stageIndex(cmds []*exec.Cmd, cmd *exec.Cmd) int {
+	for i, c := range cmds {
+		if c == cmd {
+			return i
+		}
+	}
+	return -1
+}
+
+// WithDiagnostics collects Diagnostics for commands that die unexpectedly,
+// i.e. are killed by a signal other than because the execution's context
+// is done, which are available via Result.Diagnostics, so that they don't
+// have to be reconstructed after the fact.
+func WithDiagnostics() Option {
+	return func(c *config) {
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			snap := snapshotExited(cmd)
+			err := wait()
+			if d := diagnose(cmd, snap); d != nil {
+				d.Stage = stageIndex(c.cmds, cmd)
+				c.diagnostics = append(c.diagnostics, *d)
+			}
+			return err
+		}, nil)
+	}
+}
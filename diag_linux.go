@@ -0,0 +1,166 @@
+package pipes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	pPid    = 1
+	wNowait = 0x1000000
+)
+
+// exitSnapshot holds the state of a command that has exited but hasn't been
+// reaped yet.
+type exitSnapshot struct {
+	status string
+	cgroup string
+}
+
+// waitExited waits for pid to exit without reaping it.
+func waitExited(pid int) error {
+	var info [128]byte
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPid, uintptr(pid), uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|wNowait, 0, 0)
+		if errno != syscall.EINTR {
+			if errno != 0 {
+				return errno
+			}
+			return nil
+		}
+	}
+}
+
+// snapshotExited waits for cmd to exit and records its final state from
+// /proc before it is reaped.
+func snapshotExited(cmd *exec.Cmd) *exitSnapshot {
+	if waitExited(cmd.Process.Pid) != nil {
+		return nil
+	}
+	dir := "/proc/" + strconv.Itoa(cmd.Process.Pid) + "/"
+
+	var snap exitSnapshot
+	if b, err := ioutil.ReadFile(dir + "status"); err == nil {
+		snap.status = string(b)
+	}
+	if b, err := ioutil.ReadFile(dir + "cgroup"); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			// The cgroup v2 hierarchy has ID 0 and no controllers.
+			if strings.HasPrefix(line, "0::") {
+				snap.cgroup = line[len("0::"):]
+			}
+		}
+	}
+	return &snap
+}
+
+// oomKills returns the kernel log lines about OOM kills of pid, or nil if
+// the kernel log isn't readable.
+func oomKills(pid int) []string {
+	// Use the raw fd, as the runtime's poller would block reads of a
+	// non-blocking os.File until more records are logged.
+	fd, err := syscall.Open("/dev/kmsg", syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil
+	}
+	defer syscall.Close(fd)
+
+	patterns := []string{"Killed process " + strconv.Itoa(pid) + " ", ",pid=" + strconv.Itoa(pid) + ","}
+
+	// Each read returns a single record, until there are none left.
+	var lines []string
+	buf := make([]byte, 8192)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EPIPE {
+			// Records were overwritten while reading.
+			continue
+		}
+		if err != nil || n <= 0 {
+			break
+		}
+		record := buf[:n]
+		i := bytes.IndexByte(record, ';')
+		if i < 0 {
+			continue
+		}
+		msg := strings.TrimRight(string(record[i+1:]), "\n")
+		if j := strings.IndexByte(msg, '\n'); j >= 0 {
+			msg = msg[:j]
+		}
+		for _, pattern := range patterns {
+			if strings.Contains(msg, pattern) {
+				lines = append(lines, msg)
+				break
+			}
+		}
+	}
+	return lines
+}
+
+// diagnose returns Diagnostics for cmd, which has been waited for, if it
+// was killed by a signal.
+func diagnose(cmd *exec.Cmd, snap *exitSnapshot) *Diagnostics {
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return nil
+	}
+
+	d := &Diagnostics{
+		Pid:        cmd.Process.Pid,
+		Signal:     status.Signal().String(),
+		CoreDumped: status.CoreDump(),
+		Kernel:     oomKills(cmd.Process.Pid),
+	}
+	if snap != nil {
+		d.Status, d.Cgroup = snap.status, snap.cgroup
+		if d.Cgroup != "" {
+			if b, err := ioutil.ReadFile("/sys/fs/cgroup" + d.Cgroup + "/memory.events"); err == nil {
+				d.MemoryEvents = string(b)
+			}
+		}
+	}
+	if b, err := ioutil.ReadFile("/proc/sys/kernel/core_pattern"); err == nil {
+		d.CorePattern = strings.TrimSpace(string(b))
+	}
+	return d
+}
+
+// ioSnapshot holds the I/O counters of a command that has exited.
+type ioSnapshot struct {
+	readBytes  int64
+	writeBytes int64
+}
+
+// snapshotIO waits for cmd to exit and reads its I/O counters from
+// /proc/<pid>/io before it is reaped.
+func snapshotIO(cmd *exec.Cmd) *ioSnapshot {
+	if waitExited(cmd.Process.Pid) != nil {
+		return nil
+	}
+	b, err := ioutil.ReadFile("/proc/" + strconv.Itoa(cmd.Process.Pid) + "/io")
+	if err != nil {
+		return nil
+	}
+
+	var snap ioSnapshot
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		n, _ := strconv.ParseInt(fields[1], 10, 64)
+		switch fields[0] {
+		case "rchar:":
+			snap.readBytes = n
+		case "wchar:":
+			snap.writeBytes = n
+		}
+	}
+	return &snap
+}
@@ -0,0 +1,35 @@
+//go:build !linux && !plan9
+
+package pipes
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// exitSnapshot is unavailable on this platform.
+type exitSnapshot struct{}
+
+func snapshotExited(cmd *exec.Cmd) *exitSnapshot {
+	return nil
+}
+
+// diagnose returns Diagnostics for cmd, which has been waited for, if it
+// was killed by a signal.
+func diagnose(cmd *exec.Cmd, snap *exitSnapshot) *Diagnostics {
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return nil
+	}
+	return &Diagnostics{Pid: cmd.Process.Pid, Signal: status.Signal().String(), CoreDumped: status.CoreDump()}
+}
+
+// ioSnapshot is unavailable on this platform.
+type ioSnapshot struct {
+	readBytes  int64
+	writeBytes int64
+}
+
+func snapshotIO(cmd *exec.Cmd) *ioSnapshot {
+	return nil
+}
@@ -0,0 +1,27 @@
+package pipes
+
+import (
+	"os/exec"
+)
+
+// exitSnapshot is unavailable on this platform.
+type exitSnapshot struct{}
+
+func snapshotExited(cmd *exec.Cmd) *exitSnapshot {
+	return nil
+}
+
+// diagnose returns nil, as commands aren't killed by signals on Plan 9.
+func diagnose(cmd *exec.Cmd, snap *exitSnapshot) *Diagnostics {
+	return nil
+}
+
+// ioSnapshot is unavailable on this platform.
+type ioSnapshot struct {
+	readBytes  int64
+	writeBytes int64
+}
+
+func snapshotIO(cmd *exec.Cmd) *ioSnapshot {
+	return nil
+}
@@ -0,0 +1,187 @@
+package pipes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// isEnvKey returns true if key is a valid variable name for a dotenv file.
+func isEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// closingQuote returns the index of the quote q that terminates s, skipping
+// backslash escapes in double quoted values, or -1 if s isn't terminated.
+func closingQuote(s string, q byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && q == '"' {
+			i++
+		} else if s[i] == q {
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeDotenv replaces the backslash escapes in a double quoted value,
+// escaping dollar signs for Env's expansion if they were escaped in s.
+func unescapeDotenv(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case '"', '\\':
+			sb.WriteByte(s[i])
+		case '$':
+			sb.WriteString("$$")
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// parseDotenv parses the variables in data, read from the file name, in the
+// order in which they are set.
+func parseDotenv(data string, name string, noDuplicates bool) ([]envVar, error) {
+	var vars []envVar
+	seen := make(map[string]bool)
+
+	next := func() string {
+		line := data
+		if i := strings.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = ""
+		}
+		return strings.TrimSuffix(line, "\r")
+	}
+
+	for n := 1; data != ""; n++ {
+		start := n
+		line := strings.TrimSpace(next())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") {
+			line = strings.TrimLeft(line[len("export "):], " \t")
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: missing '='", name, start)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimLeft(line[i+1:], " \t")
+		if !isEnvKey(key) {
+			return nil, fmt.Errorf("%s:%d: invalid variable name %q", name, start, key)
+		}
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			// Quoted values may span multiple lines.
+			q, body := value[0], value[1:]
+			for {
+				if end := closingQuote(body, q); end >= 0 {
+					rest := strings.TrimSpace(body[end+1:])
+					if rest != "" && rest[0] != '#' {
+						return nil, fmt.Errorf("%s:%d: unexpected %q after quoted value", name, n, rest)
+					}
+					body = body[:end]
+					break
+				}
+				if data == "" {
+					return nil, fmt.Errorf("%s:%d: unterminated quoted value", name, start)
+				}
+				body += "\n" + next()
+				n++
+			}
+
+			// Single quoted values are literal, double quoted values
+			// are expanded like unquoted values.
+			if q == '\'' {
+				value = strings.ReplaceAll(body, "$", "$$")
+			} else {
+				value = unescapeDotenv(body)
+			}
+		} else {
+			// Comments must be preceded by whitespace, "a#b" is a value.
+			for j := 0; j < len(value); j++ {
+				if value[j] == '#' && (j == 0 || value[j-1] == ' ' || value[j-1] == '\t') {
+					value = value[:j]
+					break
+				}
+			}
+			value = strings.TrimSpace(value)
+		}
+
+		if seen[key] && noDuplicates {
+			return nil, fmt.Errorf("%s:%d: duplicate variable %s", name, start, key)
+		}
+		seen[key] = true
+		vars = append(vars, envVar{key, value})
+	}
+	return vars, nil
+}
+
+// loadDotenv parses the dotenv file at path.
+func loadDotenv(path string, noDuplicates bool) ([]envVar, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseDotenv(string(data), path, noDuplicates)
+}
+
+// LoadDefaults reads variables from the dotenv file at path and adds them
+// as defaults, see Default, so that inherited variables take precedence, as
+// with docker-compose's .env file.  The file holds KEY=VALUE lines, which
+// may be prefixed with "export", and "#" comments.  Values may be single
+// quoted, in which case they're used literally, or double quoted, in which
+// case backslash escapes such as "\n" are replaced.  Both kinds of quoted
+// values may span multiple lines.  Unquoted and double quoted values may
+// reference other variables, e.g. "${HOME}/bin".  If a variable is set more
+// than once, the last value wins, or an error is returned if noDuplicates is
+// true.
+func (e *Env) LoadDefaults(path string, noDuplicates bool) error {
+	vars, err := loadDotenv(path, noDuplicates)
+	if err != nil {
+		return err
+	}
+	e.defaults = append(e.defaults, vars...)
+	return nil
+}
+
+// LoadOverrides reads variables from the dotenv file at path and adds them
+// as overrides, see Set, so that they take precedence over inherited and
+// default variables, as with docker-compose's env_file.  See LoadDefaults
+// for the file format.
+func (e *Env) LoadOverrides(path string, noDuplicates bool) error {
+	vars, err := loadDotenv(path, noDuplicates)
+	if err != nil {
+		return err
+	}
+	e.overrides = append(e.overrides, vars...)
+	return nil
+}
@@ -0,0 +1,105 @@
+package pipes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeDotenv writes data to a dotenv file in a temporary directory and
+// returns its path.
+func writeDotenv(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := ioutil.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDotenv(t *testing.T) {
+	path := writeDotenv(t, `# comment
+A=1
+export B = two words # comment
+C=a#b
+D='literal $A \n'
+E="escaped\t\"$A\" \$A"
+F="multi
+line"
+G=${A}${B}
+H=
+I='x' # comment
+`)
+	e := NewEnv()
+	if err := e.LoadDefaults(path, true); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"A=1",
+		"B=two words",
+		"C=a#b",
+		`D=literal $A \n`,
+		"E=escaped\t\"1\" $A",
+		"F=multi\nline",
+		"G=1two words",
+		"H=",
+		"I=x",
+	}
+	if got := e.Environ(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Environ() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadDotenvErrors(t *testing.T) {
+	for data, want := range map[string]string{
+		"A=1\nB":            ":2: missing '='",
+		"1A=1":              ":1: invalid variable name",
+		"A=\"x\" y":         ":1: unexpected \"y\"",
+		"A=1\nB='x\ny\n":    ":2: unterminated quoted value",
+		"A=1\nB=2\nA=3\n":   ":3: duplicate variable A",
+		"A=\"x\ny\"\nA=2\n": ":3: duplicate variable A",
+		"export A=1\nA=2\n": ":2: duplicate variable A",
+	} {
+		err := NewEnv().LoadDefaults(writeDotenv(t, data), true)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadDefaults(%q) error = %v, want %q", data, err, want)
+		}
+	}
+	if err := NewEnv().LoadDefaults(filepath.Join(t.TempDir(), "missing"), false); !os.IsNotExist(err) {
+		t.Errorf("LoadDefaults(missing) error = %v, want not exist", err)
+	}
+}
+
+func TestLoadDotenvDuplicates(t *testing.T) {
+	path := writeDotenv(t, "A=1\nB=$A\nA=2\n")
+
+	// The last value wins for both defaults and overrides, and references
+	// see the value set before them.
+	for name, load := range map[string]func(*Env) error{
+		"LoadDefaults":  func(e *Env) error { return e.LoadDefaults(path, false) },
+		"LoadOverrides": func(e *Env) error { return e.LoadOverrides(path, false) },
+	} {
+		e := NewEnv()
+		if err := load(e); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := e.Environ(), []string{"A=2", "B=1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Environ() = %q, want %q", name, got, want)
+		}
+	}
+
+	// Inherited variables take precedence over all the defaults.
+	t.Setenv("PIPES_TEST_DOTENV", "inherited")
+	e := InheritEnv()
+	if err := e.LoadDefaults(writeDotenv(t, "PIPES_TEST_DOTENV=1\nPIPES_TEST_DOTENV=2\n"), false); err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range e.Environ() {
+		if strings.HasPrefix(kv, "PIPES_TEST_DOTENV=") && kv != "PIPES_TEST_DOTENV=inherited" {
+			t.Errorf("Environ() has %q, want the inherited value", kv)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package pipes
+
+import (
+	"errors"
+	"os"
+)
+
+// dupFile fails, as duplicating file descriptors is only supported on Unix.
+func dupFile(f *os.File) (*os.File, error) {
+	return nil, errors.New("duplicating files not supported on this platform")
+}
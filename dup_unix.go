@@ -0,0 +1,33 @@
+//go:build unix
+
+package pipes
+
+import (
+	"os"
+	"syscall"
+)
+
+// dupFile returns a new file descriptor for f's open file, closed on exec,
+// which stays open when f is closed.
+func dupFile(f *os.File) (*os.File, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var fd int
+	var dupErr error
+	// Use Control rather than Fd, which would make f blocking.
+	if err = rc.Control(func(oldfd uintptr) {
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+		if fd, dupErr = syscall.Dup(int(oldfd)); dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, os.NewSyscallError("dup", dupErr)
+	}
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
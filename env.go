@@ -0,0 +1,140 @@
+package pipes
+
+import (
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// envVar is a variable set by a layer of an Env.
+type envVar struct {
+	key   string
+	value string
+}
+
+// Env builds a command environment from layers, applied in order of
+// precedence regardless of the order in which they are configured: the
+// inherited environment, if any, then defaults, then overrides, and finally
+// unset variables.  The zero value is an empty environment.
+type Env struct {
+	inherit   bool
+	except    map[string]bool
+	defaults  []envVar
+	overrides []envVar
+	unset     []string
+}
+
+// NewEnv returns an empty Env, which doesn't inherit this process's
+// environment.
+func NewEnv() *Env {
+	return &Env{}
+}
+
+// InheritEnv returns an Env that inherits this process's environment, except
+// for the named variables.
+func InheritEnv(except ...string) *Env {
+	e := &Env{inherit: true, except: make(map[string]bool)}
+	for _, key := range except {
+		e.except[key] = true
+	}
+	return e
+}
+
+// Default sets key to value unless key is inherited, replacing any earlier
+// default for key.  References to other variables in value, e.g.
+// "$HOME/bin", are expanded as by os.Expand using the inherited variables
+// and the defaults set before this one.  Use "$$" for a literal dollar
+// sign.
+func (e *Env) Default(key string, value string) *Env {
+	e.defaults = append(e.defaults, envVar{key, value})
+	return e
+}
+
+// Set sets key to value, overriding both inherited and default values.
+// References to other variables in value, e.g. "/opt/bin:$PATH", are
+// expanded as by os.Expand using the inherited variables, the defaults and
+// the overrides set before this one.  Use "$$" for a literal dollar sign.
+func (e *Env) Set(key string, value string) *Env {
+	e.overrides = append(e.overrides, envVar{key, value})
+	return e
+}
+
+// Unset removes the named variables, whichever layer they were set by.
+func (e *Env) Unset(keys ...string) *Env {
+	e.unset = append(e.unset, keys...)
+	return e
+}
+
+// Environ returns the environment as "key=value" strings sorted by key, so
+// that the same Env always produces the same environment.
+func (e *Env) Environ() []string {
+	vars := make(map[string]string)
+	if e.inherit {
+		for _, kv := range os.Environ() {
+			i := strings.IndexByte(kv, '=')
+			// Skip Windows' per-drive "=C:=C:\" pseudo variables.
+			if i <= 0 {
+				continue
+			}
+			if key := kv[:i]; !e.except[key] {
+				vars[key] = kv[i+1:]
+			}
+		}
+	}
+
+	lookup := func(key string) string {
+		if key == "$" {
+			return "$"
+		}
+		return vars[key]
+	}
+	// A default set more than once replaces the earlier one, unless
+	// the variable is inherited.
+	defaulted := make(map[string]bool)
+	for _, v := range e.defaults {
+		if _, ok := vars[v.key]; !ok || defaulted[v.key] {
+			vars[v.key] = os.Expand(v.value, lookup)
+			defaulted[v.key] = true
+		}
+	}
+	for _, v := range e.overrides {
+		vars[v.key] = os.Expand(v.value, lookup)
+	}
+	for _, key := range e.unset {
+		delete(vars, key)
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := make([]string, len(keys))
+	for i, key := range keys {
+		env[i] = key + "=" + vars[key]
+	}
+	return env
+}
+
+// Apply sets the environment of each of cmds, e.g. a single stage of a
+// pipeline.
+func (e *Env) Apply(cmds ...*exec.Cmd) {
+	env := e.Environ()
+	for _, cmd := range cmds {
+		cmd.Env = append([]string(nil), env...)
+	}
+}
+
+// WithEnv sets the environment of every command in the pipeline, computed
+// when the execution is set up.  Use Env.Apply to set the environment of
+// individual stages.
+func WithEnv(env *Env) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			env.Apply(c.cmds...)
+			return nil
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnv(t *testing.T) {
+	e := NewEnv().
+		Set("PATH", "/opt/bin:$PATH").
+		Default("PATH", "/bin").
+		Default("GREETING", "hello $USER").
+		Set("PRICE", "$$5").
+		Set("DROPPED", "x").
+		Unset("DROPPED", "MISSING")
+	want := []string{"GREETING=hello ", "PATH=/opt/bin:/bin", "PRICE=$5"}
+	if got := e.Environ(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Environ() = %q, want %q", got, want)
+	}
+
+	// Inherited variables take precedence over defaults, but not over
+	// overrides, and excepted variables aren't inherited.
+	t.Setenv("PIPES_TEST_A", "inherited")
+	t.Setenv("PIPES_TEST_B", "inherited")
+	t.Setenv("PIPES_TEST_C", "inherited")
+	e = InheritEnv("PIPES_TEST_C").
+		Default("PIPES_TEST_A", "default").
+		Set("PIPES_TEST_B", "$PIPES_TEST_A $PIPES_TEST_B").
+		Default("PIPES_TEST_C", "default")
+	var got []string
+	for _, kv := range e.Environ() {
+		if strings.HasPrefix(kv, "PIPES_TEST_") {
+			got = append(got, kv)
+		}
+	}
+	want = []string{"PIPES_TEST_A=inherited", "PIPES_TEST_B=inherited inherited", "PIPES_TEST_C=default"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Environ() = %q, want %q", got, want)
+	}
+}
+
+func TestWithEnv(t *testing.T) {
+	var out bytes.Buffer
+	cmds := []*exec.Cmd{exec.Command("sh", "-c", `echo "$A"`), exec.Command("sh", "-c", `cat; echo "$A"`)}
+	if _, err := (&Runner{}).ExecPipeline(context.Background(), cmds, WithEnv(NewEnv().Set("A", "a")), WithStdout(&out)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a\na\n" {
+		t.Errorf("output = %q, want the variable set for both stages", out.String())
+	}
+
+	// Each command gets its own copy.
+	a, b := exec.Command("true"), exec.Command("true")
+	NewEnv().Set("A", "a").Apply(a, b)
+	a.Env[0] = "A=changed"
+	if b.Env[0] != "A=a" {
+		t.Errorf("Env = %q, want a copy", b.Env)
+	}
+}
@@ -0,0 +1,73 @@
+package pipes
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultErrorTailSize is the maximum number of bytes of captured Stderr
+// included in the message of an Error by default, keeping error strings
+// loggable.  The full capture is available via Error.Stderr.
+const DefaultErrorTailSize = 4096
+
+// Error is returned by executions that capture the output of the failed
+// commands, holding the captured output alongside the underlying error.
+type Error struct {
+	// Err is the underlying error, containing the command that failed as
+	// well as the system error string.
+	Err error
+	// Stdout and Stderr hold the output captured from the commands, which
+	// may be only the tail of the output.
+	Stdout []byte
+	Stderr []byte
+	// TailSize is the maximum number of bytes of Stderr included in the
+	// error string, DefaultErrorTailSize if zero, or no limit if negative,
+	// see WithErrorTail.
+	TailSize int
+}
+
+// Error returns the underlying error string followed by a sanitized tail of
+// the captured Stderr, bounded by TailSize.  Binary Stderr output is
+// summarized rather than included.
+func (e *Error) Error() string {
+	if isBinary(e.Stderr, true, false) {
+		return fmt.Sprintf("%s - [%d bytes of binary output]", e.Err.Error(), len(e.Stderr))
+	}
+	max := e.TailSize
+	if max == 0 {
+		max = DefaultErrorTailSize
+	}
+	return e.Err.Error() + " - " + sanitizeTail(e.Stderr, max)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// sanitizeTail returns the last max bytes of b, prefixed with "..." if b was
+// truncated, with invalid UTF-8 and control characters other than newlines
+// and tabs replaced so that the result is safe to log.
+func sanitizeTail(b []byte, max int) string {
+	prefix := ""
+	if max > 0 && len(b) > max {
+		b = b[len(b)-max:]
+		// Don't start in the middle of a multi-byte character.
+		for len(b) > 0 && !utf8.RuneStart(b[0]) {
+			b = b[1:]
+		}
+		prefix = "..."
+	}
+
+	return prefix + strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, string(b))
+}
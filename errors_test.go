@@ -0,0 +1,42 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestErrorTailSize(t *testing.T) {
+	stderr := []byte(strings.Repeat("x", DefaultErrorTailSize) + "tail\x1b\n")
+	for _, test := range []struct {
+		tailSize int
+		want     string
+	}{
+		{0, "failed - ..." + strings.Repeat("x", DefaultErrorTailSize-6) + "tail?\n"},
+		{5, "failed - ...ail?\n"},
+		{-1, "failed - " + strings.Repeat("x", DefaultErrorTailSize) + "tail?\n"},
+	} {
+		e := &Error{Err: errors.New("failed"), Stderr: stderr, TailSize: test.tailSize}
+		if got := e.Error(); got != test.want {
+			t.Errorf("TailSize %d: Error() = %q, want %q", test.tailSize, got, test.want)
+		}
+	}
+}
+
+func TestWithErrorTail(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "echo 0123456789 >&2; exit 1")
+	_, err := (&Runner{}).Exec(context.Background(), cmd, WithTail(0, 0), WithErrorTail(4))
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Exec() error = %v, want *Error", err)
+	}
+	if !strings.HasSuffix(err.Error(), " - ...789\n") {
+		t.Errorf("Exec() error = %q, want tail of 4 bytes", err.Error())
+	}
+	if got := string(e.Stderr); got != "0123456789\n" {
+		t.Errorf("Error.Stderr = %q, want full capture", got)
+	}
+}
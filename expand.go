@@ -0,0 +1,129 @@
+package pipes
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandTilde expands a leading "~" or "~user" in path to the home directory
+// of the current or named user, like a shell would.  Returns path as is if
+// it doesn't start with a tilde.
+func ExpandTilde(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+
+	name, rest := path[1:], ""
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+
+	var home string
+	if name == "" {
+		var err error
+		if home, err = os.UserHomeDir(); err != nil {
+			return "", err
+		}
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		home = u.HomeDir
+	}
+	return home + rest, nil
+}
+
+// hasMeta returns true if path contains glob metacharacters.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// isHidden returns true if match, which matched pattern, contains a hidden
+// path element that pattern didn't explicitly ask for, as shells don't match
+// a leading dot with a wildcard.
+func isHidden(pattern string, match string) bool {
+	patterns := strings.Split(filepath.ToSlash(pattern), "/")
+	elems := strings.Split(filepath.ToSlash(match), "/")
+	if len(patterns) != len(elems) {
+		return false
+	}
+	for i, elem := range elems {
+		if strings.HasPrefix(elem, ".") && !strings.HasPrefix(patterns[i], ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// expandArgs implements ExpandArgs, resolving relative patterns against dir
+// if dir is non-empty.
+func expandArgs(dir string, strict bool, args []string) ([]string, error) {
+	var expanded []string
+
+	for _, arg := range args {
+		arg, err := ExpandTilde(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !hasMeta(arg) {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		pattern := arg
+		if dir != "" && !filepath.IsAbs(arg) {
+			pattern = filepath.Join(dir, arg)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s", arg, err.Error())
+		}
+
+		n := len(expanded)
+		for _, match := range matches {
+			if isHidden(pattern, match) {
+				continue
+			}
+			if pattern != arg {
+				match, _ = filepath.Rel(dir, match)
+			}
+			expanded = append(expanded, match)
+		}
+
+		// Like a shell, keep patterns that match nothing as is unless
+		// strict, i.e. bash's failglob.
+		if len(expanded) == n {
+			if strict {
+				return nil, fmt.Errorf("%s no matches found", arg)
+			}
+			expanded = append(expanded, arg)
+		}
+	}
+	return expanded, nil
+}
+
+// ExpandArgs expands tilde prefixes and glob patterns in args, like a shell
+// would, but without involving one.  Each pattern is replaced by its matches,
+// in lexical order, with hidden files only matched by patterns that start
+// with a dot.  Patterns that match nothing are kept as is, or result in an
+// error if strict is true.
+func ExpandArgs(strict bool, args ...string) ([]string, error) {
+	return expandArgs("", strict, args)
+}
+
+// ExpandCmd expands tilde prefixes and glob patterns in cmd's arguments, not
+// including the command name, see ExpandArgs.  Relative patterns are resolved
+// against cmd.Dir, if set.
+func ExpandCmd(cmd *exec.Cmd, strict bool) error {
+	args, err := expandArgs(cmd.Dir, strict, cmd.Args[1:])
+	if err != nil {
+		return fmt.Errorf("%s %s", cmd.Path, err.Error())
+	}
+	cmd.Args = append(cmd.Args[:1], args...)
+	return nil
+}
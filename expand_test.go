@@ -0,0 +1,72 @@
+package pipes
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandTilde(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+	for path, want := range map[string]string{
+		"~":      "/home/test",
+		"~/a/b":  "/home/test/a/b",
+		"a/~":    "a/~",
+		"/a/~/b": "/a/~/b",
+		"":       "",
+	} {
+		if got, err := ExpandTilde(path); err != nil || got != want {
+			t.Errorf("ExpandTilde(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+	if got, err := ExpandTilde("~no such user/x"); err == nil {
+		t.Errorf("ExpandTilde of unknown user = %q, want an error", got)
+	}
+
+	if u, err := user.Current(); err == nil && u.HomeDir != "" {
+		if got, err := ExpandTilde("~" + u.Username + "/x"); err != nil || got != u.HomeDir+"/x" {
+			t.Errorf("ExpandTilde(~%s/x) = %q, %v, want %q", u.Username, got, err, u.HomeDir+"/x")
+		}
+	}
+}
+
+func TestExpandCmd(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", ".hidden.go", "sub/c.go", "sub/.d.go"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := ioutil.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", dir)
+
+	// Relative patterns are resolved against Dir, hidden files are only
+	// matched by patterns starting with a dot, and patterns matching
+	// nothing are kept.
+	cmd := exec.Command("ls", "*.go", ".*.go", "*/*.go", "*.txt", "~/sub/*")
+	cmd.Dir = dir
+	if err := ExpandCmd(cmd, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ls", "a.go", "b.go", ".hidden.go", "sub/c.go", "*.txt", filepath.Join(dir, "sub/c.go")}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Args = %q, want %q", cmd.Args, want)
+	}
+
+	if err := ExpandCmd(exec.Command("ls", "*.txt"), true); err == nil {
+		t.Error("no error for strict pattern matching nothing")
+	}
+	if err := ExpandCmd(exec.Command("ls", "[a"), false); err == nil {
+		t.Error("no error for malformed pattern")
+	}
+
+	args, err := ExpandArgs(true, filepath.Join(dir, "*.go"), "plain")
+	if want := []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), "plain"}; err != nil || !reflect.DeepEqual(args, want) {
+		t.Errorf("ExpandArgs = %q, %v, want %q", args, err, want)
+	}
+}
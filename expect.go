@@ -0,0 +1,136 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ErrExpectTimeout is returned, wrapped, by Expect if the output doesn't
+// match before the timeout.
+var ErrExpectTimeout = errors.New("expect timed out")
+
+// Expecter drives an interactive session, like expect(1): Expect waits for
+// output matching a pattern and Send types input.  Sessions are either live,
+// see Runner.Spawn, or replayed from a recording, see ReplaySession, so that
+// the same automation can be tested against captured output.
+type Expecter struct {
+	send  func(p []byte) error
+	close func() error
+
+	mu      sync.Mutex
+	buf     []byte
+	eof     bool
+	changed chan struct{}
+}
+
+func newExpecter() *Expecter {
+	return &Expecter{changed: make(chan struct{})}
+}
+
+// Write appends the session's output to the unmatched output.
+func (e *Expecter) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.buf = append(e.buf, p...)
+	close(e.changed)
+	e.changed = make(chan struct{})
+	return len(p), nil
+}
+
+// closeOutput notes that the session's output has ended.
+func (e *Expecter) closeOutput() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.eof = true
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// Expect waits up to timeout for the session's unmatched output to match
+// re, consumes the output through the end of the match and returns the
+// match and its submatches.  Returns an error wrapping ErrExpectTimeout, or
+// io.EOF if the output ended without matching.
+func (e *Expecter) Expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		e.mu.Lock()
+		if m := re.FindSubmatchIndex(e.buf); m != nil {
+			match := make([]string, len(m)/2)
+			for i := range match {
+				if m[2*i] >= 0 {
+					match[i] = string(e.buf[m[2*i]:m[2*i+1]])
+				}
+			}
+			e.buf = e.buf[m[1]:]
+			e.mu.Unlock()
+			return match, nil
+		}
+		eof, changed, unmatched := e.eof, e.changed, string(e.buf)
+		e.mu.Unlock()
+
+		if eof {
+			return nil, fmt.Errorf("expect %q, got %q: %w", re, unmatched, io.EOF)
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, fmt.Errorf("expect %q, got %q: %w", re, unmatched, ErrExpectTimeout)
+		}
+	}
+}
+
+// ExpectString waits up to timeout for the session's output to contain s,
+// see Expect.
+func (e *Expecter) ExpectString(s string, timeout time.Duration) error {
+	_, err := e.Expect(regexp.MustCompile(regexp.QuoteMeta(s)), timeout)
+	return err
+}
+
+// Send types s as the session's input.
+func (e *Expecter) Send(s string) error {
+	return e.send([]byte(s))
+}
+
+// Close ends the session's input and returns once the session has ended,
+// with its error, if any.
+func (e *Expecter) Close() error {
+	return e.close()
+}
+
+// Spawn starts executing a pipeline under a pty, see WithPTY, as a live
+// session driven by the returned Expecter.  If transcript is non-nil, the
+// session is recorded, e.g. for ReplaySession.  The session's input and
+// output are the Expecter's, so options mustn't redirect stdin or stdout.
+func (r *Runner) Spawn(ctx context.Context, cmds []*exec.Cmd, rows int, cols int, transcript *Transcript, opts ...Option) *Expecter {
+	e := newExpecter()
+	pr, pw := io.Pipe()
+
+	opts = append(opts[:len(opts):len(opts)], WithPTY(rows, cols, transcript), WithStdin(pr), WithStdout(e))
+	h := r.Start(ctx, cmds, opts...)
+	go func() {
+		h.Wait()
+		pr.Close()
+		e.closeOutput()
+	}()
+
+	e.send = func(p []byte) error {
+		_, err := pw.Write(p)
+		return err
+	}
+	e.close = func() error {
+		pw.Close()
+		_, err := h.Wait()
+		return err
+	}
+	return e
+}
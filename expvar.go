@@ -0,0 +1,79 @@
+package pipes
+
+import (
+	"expvar"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Package-level counters published via expvar, and so served by
+// /debug/vars once net/http and expvar are in use.
+var (
+	// processesStarted counts the commands started by this package.
+	processesStarted = expvar.NewInt("pipes.processes_started")
+	// failuresByExitCode counts the commands that exited unsuccessfully,
+	// keyed by exit code, -1 for commands killed by a signal.
+	failuresByExitCode = expvar.NewMap("pipes.failures_by_exit_code")
+	// bytesPiped counts the bytes copied by this process to and from the
+	// commands, i.e. for readers and writers that aren't files.
+	bytesPiped = expvar.NewInt("pipes.bytes_piped")
+)
+
+func init() {
+	// The number of commands started by this package that haven't been
+	// waited on yet.
+	expvar.Publish("pipes.active_children", expvar.Func(func() interface{} {
+		procs.mu.Lock()
+		defer procs.mu.Unlock()
+		return len(procs.cmds)
+	}))
+}
+
+// recordExit counts cmd's failure, if any, once it has been waited on.
+func recordExit(cmd *exec.Cmd) {
+	if ps := cmd.ProcessState; ps != nil && !ps.Success() {
+		failuresByExitCode.Add(strconv.Itoa(ps.ExitCode()), 1)
+	}
+}
+
+// pipedWriter and pipedReader count the bytes copied through them in
+// bytesPiped.
+type pipedWriter struct {
+	w io.Writer
+}
+
+func (w pipedWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	bytesPiped.Add(int64(n))
+	return n, err
+}
+
+type pipedReader struct {
+	r io.Reader
+}
+
+func (r pipedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	bytesPiped.Add(int64(n))
+	return n, err
+}
+
+// countPiped wraps w to count the bytes copied to it unless it's a file,
+// which the commands write to directly.
+func countPiped(w io.Writer) io.Writer {
+	if _, ok := w.(*os.File); ok || w == nil {
+		return w
+	}
+	return pipedWriter{w}
+}
+
+// countPipedReader wraps r to count the bytes copied from it unless it's a
+// file, which the commands read from directly.
+func countPipedReader(r io.Reader) io.Reader {
+	if _, ok := r.(*os.File); ok || r == nil {
+		return r
+	}
+	return pipedReader{r}
+}
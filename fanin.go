@@ -0,0 +1,166 @@
+package pipes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"sync"
+)
+
+// FanIn merges the output of executions run concurrently, e.g. by ExecAll,
+// into a single writer deterministically, regardless of the order in which
+// the commands happen to write, e.g. so that snapshots of the merged output
+// are stable.  See WithFanIn.
+type FanIn struct {
+	w    io.Writer
+	cmds []*exec.Cmd
+	key  func(line []byte) string
+
+	mu      sync.Mutex
+	sources []fanInSource
+	next    int
+	err     error
+}
+
+type fanInSource struct {
+	buf  bytes.Buffer
+	done bool
+}
+
+// NewFanIn returns a FanIn writing to w the output of the executions of
+// cmds.  If key is nil, each execution's output is written in the order of
+// cmds, streaming the output of the first execution not yet completed and
+// buffering that of the later ones.  Otherwise, all output is buffered
+// until every execution completes, and then written as lines stably sorted
+// by the key returned for each, e.g. a timestamp or record ID, ties being
+// broken by the order of cmds.
+func NewFanIn(w io.Writer, cmds []*exec.Cmd, key func(line []byte) string) *FanIn {
+	return &FanIn{w: w, cmds: cmds, key: key, sources: make([]fanInSource, len(cmds))}
+}
+
+// WithFanIn writes the output from the last command to f, as the output of
+// whichever of f's commands the execution runs.  Fails the execution if it
+// runs none of them.  Output following that of an execution that never
+// runs, e.g. because its context is done, is never written.
+func WithFanIn(f *FanIn) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			for _, cmd := range c.cmds {
+				if i := stageIndex(f.cmds, cmd); i >= 0 {
+					c.stdout = &fanInWriter{f: f, i: i}
+					c.onFinish(func(err error) error {
+						f.finish(i)
+						return err
+					})
+					return nil
+				}
+			}
+			return fmt.Errorf("Execution runs none of the fan-in's commands")
+		})
+	}
+}
+
+// fanInWriter writes the output of the i'th execution of a FanIn.
+type fanInWriter struct {
+	f *FanIn
+	i int
+}
+
+func (w *fanInWriter) Write(p []byte) (int, error) {
+	return w.f.write(w.i, p)
+}
+
+func (f *FanIn) write(i int, p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.key == nil && i == f.next {
+		if _, f.err = f.w.Write(p); f.err != nil {
+			return 0, f.err
+		}
+		return len(p), nil
+	}
+	return f.sources[i].buf.Write(p)
+}
+
+// finish records the i'th execution as completed, writing the buffered
+// output that no longer depends on the others.
+func (f *FanIn) finish(i int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sources[i].done = true
+	if f.key != nil {
+		f.flushSorted()
+		return
+	}
+	for f.next < len(f.sources) && f.sources[f.next].done {
+		f.next++
+		if f.next < len(f.sources) {
+			f.flush(&f.sources[f.next].buf)
+		}
+	}
+}
+
+func (f *FanIn) flush(buf *bytes.Buffer) {
+	if f.err == nil {
+		_, f.err = buf.WriteTo(f.w)
+	}
+	buf.Reset()
+}
+
+// flushSorted writes all lines sorted by key once all executions completed.
+func (f *FanIn) flushSorted() {
+	var lines [][]byte
+	for i := range f.sources {
+		if !f.sources[i].done {
+			return
+		}
+		data := f.sources[i].buf.Bytes()
+		for len(data) > 0 {
+			n := bytes.IndexByte(data, '\n') + 1
+			if n == 0 {
+				// Terminate the last line so it isn't joined to
+				// the next one.
+				lines = append(lines, append(data[:len(data):len(data)], '\n'))
+				break
+			}
+			lines = append(lines, data[:n])
+			data = data[n:]
+		}
+	}
+
+	keys := make([]string, len(lines))
+	for i, line := range lines {
+		keys[i] = f.key(bytes.TrimSuffix(line, []byte("\n")))
+	}
+	order := make([]int, len(lines))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return keys[order[a]] < keys[order[b]]
+	})
+
+	var out bytes.Buffer
+	for _, i := range order {
+		out.Write(lines[i])
+	}
+	f.flush(&out)
+	for i := range f.sources {
+		f.sources[i].buf.Reset()
+	}
+}
+
+// Err returns the first error writing the merged output, if any.
+func (f *FanIn) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
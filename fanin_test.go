@@ -0,0 +1,44 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestFanIn(t *testing.T) {
+	commands := func() []*exec.Cmd {
+		return []*exec.Cmd{
+			exec.Command("sh", "-c", "sleep 0.1; echo '2 a'; echo '4 a'"),
+			exec.Command("sh", "-c", "echo '3 b'; sleep 0.05; printf '1 b'"),
+			exec.Command("echo", "2 c"),
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		key  func(line []byte) string
+		want string
+	}{
+		{"ordered", nil, "2 a\n4 a\n3 b\n1 b2 c\n"},
+		{"sorted", func(line []byte) string { return string(line[:1]) }, "1 b\n2 a\n2 c\n3 b\n4 a\n"},
+	} {
+		var out bytes.Buffer
+		cmds := commands()
+		f := NewFanIn(&out, cmds, tt.key)
+		if _, err := (&Runner{}).ExecAll(context.Background(), cmds, 0, WithFanIn(f)); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if out.String() != tt.want || f.Err() != nil {
+			t.Errorf("%s: output = %q, %v, want %q", tt.name, out.String(), f.Err(), tt.want)
+		}
+	}
+
+	// Executions must run one of the fan-in's commands.
+	f := NewFanIn(&bytes.Buffer{}, commands(), nil)
+	_, err := (&Runner{}).Exec(context.Background(), exec.Command("true"), WithFanIn(f))
+	if err == nil || !strings.Contains(err.Error(), "none of the fan-in's commands") {
+		t.Errorf("error = %v, want none of the fan-in's commands", err)
+	}
+}
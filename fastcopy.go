@@ -0,0 +1,185 @@
+package pipes
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// DefaultCopyBuffer is the size of the buffers used by WithFastCopy by
+// default, a multiple of the page size.
+const DefaultCopyBuffer = 256 << 10
+
+// copyBuffers pools buffers of DefaultCopyBuffer bytes.
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		return make([]byte, DefaultCopyBuffer)
+	},
+}
+
+// coalescingCopy copies from src to dst until src ends.  After each read
+// that doesn't fill buf, data that is already available from src is read as
+// well, so that many small writes to src are forwarded to dst as fewer,
+// larger writes.
+func coalescingCopy(dst io.Writer, src *os.File, buf []byte) (int64, error) {
+	var written int64
+	for {
+		n, err := src.Read(buf)
+		for err == nil && n < len(buf) {
+			m, ok, rerr := readAvailable(src, buf[n:])
+			if !ok {
+				break
+			}
+			n, err = n+m, rerr
+		}
+
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		} else if err != nil {
+			return written, err
+		}
+	}
+}
+
+// fastCopy forwards a command's output from a pipe to a writer.
+type fastCopy struct {
+	w      io.Writer
+	pr, pw *os.File
+	done   chan struct{}
+	err    error
+	once   sync.Once
+}
+
+// newFastCopy returns a fastCopy forwarding output to w with copy.
+func newFastCopy(w io.Writer, copy func(dst io.Writer, src *os.File) error) (*fastCopy, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	fc := &fastCopy{w: w, pr: pr, pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(fc.done)
+
+		if fc.err = copy(w, pr); fc.err != nil {
+			// Keep draining, lest the commands block.
+			io.Copy(ioutil.Discard, pr)
+		}
+		pr.Close()
+	}()
+	return fc, nil
+}
+
+// closeWriter closes this process's end of the pipe, once the commands
+// have been started.
+func (fc *fastCopy) closeWriter() {
+	fc.once.Do(func() { fc.pw.Close() })
+}
+
+// wait waits for the commands' output to be forwarded.
+func (fc *fastCopy) wait() error {
+	fc.closeWriter()
+	<-fc.done
+	return fc.err
+}
+
+// isFile returns true if w is passed to commands directly, without copying.
+func isFile(w io.Writer) bool {
+	_, ok := w.(*os.File)
+	return ok
+}
+
+// WithFastCopy copies the commands' output to writers that aren't files,
+// which the commands can't write to directly, via this package's copy loop
+// rather than os/exec's.  It reads with buffers of size bytes,
+// DefaultCopyBuffer if size is zero, and coalesces many small writes by the
+// commands into fewer, larger writes to the writers, e.g. to reduce system
+// calls when the writer is a socket.  See bench.Compare to measure the
+// effect on a pipeline.
+func WithFastCopy(size int) Option {
+	if size <= 0 {
+		size = DefaultCopyBuffer
+	}
+	return withCopy(func(dst io.Writer, src *os.File) error {
+		var buf []byte
+		if size == DefaultCopyBuffer {
+			buf = copyBuffers.Get().([]byte)
+			defer copyBuffers.Put(buf)
+		} else {
+			buf = make([]byte, size)
+		}
+		_, err := coalescingCopy(dst, src, buf)
+		return err
+	})
+}
+
+// withCopy copies the commands' output to writers that aren't files with
+// copy, from pipes passed to the commands.
+func withCopy(copy func(dst io.Writer, src *os.File) error) Option {
+	return func(c *config) {
+		var stdout, stderr *fastCopy
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			i, last := stageIndex(c.cmds, cmd), len(c.cmds)-1
+			var err error
+			if i == last && cmd.Stdout != nil && !isFile(cmd.Stdout) {
+				if stdout, err = newFastCopy(cmd.Stdout, copy); err != nil {
+					return err
+				}
+				cmd.Stdout = stdout.pw
+			}
+			if cmd.Stderr != nil && !isFile(cmd.Stderr) {
+				if stderr == nil {
+					if stderr, err = newFastCopy(cmd.Stderr, copy); err != nil {
+						return err
+					}
+				}
+				cmd.Stderr = stderr.pw
+			}
+
+			err = start()
+			if i == last {
+				for _, fc := range []*fastCopy{stdout, stderr} {
+					if fc != nil {
+						fc.closeWriter()
+					}
+				}
+			}
+			return err
+		}, nil)
+
+		// Wait for the output once the commands have exited, before the
+		// execution's output is complete.
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			err := wait()
+			if stageIndex(c.cmds, cmd) != len(c.cmds)-1 {
+				return err
+			}
+			for _, fc := range []*fastCopy{stdout, stderr} {
+				if fc == nil {
+					continue
+				}
+				if ferr := fc.wait(); err == nil {
+					err = ferr
+				}
+			}
+			return err
+		}, nil)
+
+		c.onRelease(func() {
+			for _, fc := range []*fastCopy{stdout, stderr} {
+				if fc != nil {
+					fc.wait()
+				}
+			}
+		})
+	}
+}
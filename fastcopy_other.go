@@ -0,0 +1,11 @@
+//go:build !unix
+
+package pipes
+
+import "os"
+
+// readAvailable reads from f without blocking, which isn't supported on
+// this platform, so reads aren't coalesced.
+func readAvailable(f *os.File, buf []byte) (n int, ok bool, err error) {
+	return 0, false, nil
+}
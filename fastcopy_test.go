@@ -0,0 +1,112 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// countingWriter counts the bytes and writes made to it.
+type countingWriter struct {
+	n, writes int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	w.writes++
+	return len(b), nil
+}
+
+// copyFunc copies from a pipe to dst, like coalescingCopy.
+type copyFunc func(dst io.Writer, src *os.File) (int64, error)
+
+// benchmarkCopy benchmarks copy forwarding size bytes to dst, or a
+// countingWriter if nil, written to a pipe in messages of msg bytes by
+// another goroutine.  The number of writes to the countingWriter per op is
+// reported as "writes/op".
+func benchmarkCopy(b *testing.B, copy copyFunc, dst io.Writer, msg int, size int) {
+	data := make([]byte, msg)
+	b.SetBytes(int64(size))
+	var writes int64
+	for i := 0; i < b.N; i++ {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			b.Fatal(err)
+		}
+		go func() {
+			for n := 0; n < size; n += msg {
+				pw.Write(data)
+			}
+			pw.Close()
+		}()
+		out, w := dst, &countingWriter{}
+		if out == nil {
+			out = w
+		}
+		n, err := copy(out, pr)
+		pr.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n != int64(size) {
+			b.Fatalf("copied %d bytes, want %d", n, size)
+		}
+		writes += w.writes
+	}
+	b.ReportMetric(float64(writes)/float64(b.N), "writes/op")
+}
+
+// copyLoops are the ways of copying a command's output to a writer: os/exec
+// uses io.Copy, and WithFastCopy coalescingCopy.
+var copyLoops = []struct {
+	name string
+	copy copyFunc
+}{
+	{"io.Copy", func(dst io.Writer, src *os.File) (int64, error) {
+		return io.Copy(dst, src)
+	}},
+	{"fastcopy", func(dst io.Writer, src *os.File) (int64, error) {
+		buf := copyBuffers.Get().([]byte)
+		defer copyBuffers.Put(buf)
+		return coalescingCopy(dst, src, buf)
+	}},
+}
+
+func BenchmarkCopySmallWrites(b *testing.B) {
+	for _, msg := range []int{16, 256, 4096} {
+		for _, loop := range copyLoops {
+			b.Run(fmt.Sprintf("%s/%d", loop.name, msg), func(b *testing.B) {
+				benchmarkCopy(b, loop.copy, nil, msg, 1<<20)
+			})
+		}
+	}
+}
+
+// BenchmarkFastCopy benchmarks a command writing many short lines, with and
+// without WithFastCopy.
+func BenchmarkFastCopy(b *testing.B) {
+	script := "i=0; while [ $i -lt 2000 ]; do echo line; i=$((i+1)); done"
+	for _, variant := range []struct {
+		name string
+		opts []Option
+	}{
+		{"exec", nil},
+		{"fastcopy", []Option{WithFastCopy(0)}},
+	} {
+		b.Run(variant.name, func(b *testing.B) {
+			var writes int64
+			for i := 0; i < b.N; i++ {
+				w := &countingWriter{}
+				cmd := exec.Command("sh", "-c", script)
+				if _, err := (&Runner{}).Exec(context.Background(), cmd, append(variant.opts, WithStdout(w))...); err != nil {
+					b.Fatal(err)
+				}
+				writes += w.writes
+			}
+			b.ReportMetric(float64(writes)/float64(b.N), "writes/op")
+		})
+	}
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package pipes
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// readAvailable reads from f, a pipe, without blocking.  ok is false if no
+// data is available.
+func readAvailable(f *os.File, buf []byte) (n int, ok bool, err error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+	var rerr error
+	// Returning true from the callback reads once instead of waiting for
+	// the pipe to become readable.
+	if err = rc.Read(func(fd uintptr) bool {
+		n, rerr = syscall.Read(int(fd), buf)
+		return true
+	}); err != nil {
+		return 0, false, nil
+	}
+	switch {
+	case rerr == syscall.EAGAIN || rerr == syscall.EINTR:
+		return 0, false, nil
+	case rerr != nil:
+		return 0, true, rerr
+	case n == 0:
+		return 0, true, io.EOF
+	}
+	return n, true, nil
+}
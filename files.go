@@ -0,0 +1,124 @@
+package pipes
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WithStdinFile reads the first command's stdin from the file name in fsys,
+// e.g. os.DirFS("/"), which is opened before any command is started and
+// closed once the execution completes.
+func WithStdinFile(fsys fs.FS, name string) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			f, err := fsys.Open(name)
+			if err != nil {
+				return err
+			}
+			c.stdin = f
+			c.onFinish(func(err error) error {
+				f.Close()
+				return err
+			})
+			return nil
+		})
+	}
+}
+
+// WithStdoutFile writes the output from the last command to the file at
+// path, which is created with permissions perm if it doesn't exist, and is
+// truncated unless appendMode is true.  The file is synced to stable storage
+// if the execution succeeds, and failing to sync or close the file fails the
+// execution.
+func WithStdoutFile(path string, perm os.FileMode, appendMode bool) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			f, err := openOutput(c, path, perm, appendMode)
+			if err != nil {
+				return err
+			}
+			c.stdout = f
+			return nil
+		})
+	}
+}
+
+// WithStderrFile writes all commands' Stderr output to the file at path,
+// like WithStdoutFile.
+func WithStderrFile(path string, perm os.FileMode, appendMode bool) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			f, err := openOutput(c, path, perm, appendMode)
+			if err != nil {
+				return err
+			}
+			c.stderr = f
+			return nil
+		})
+	}
+}
+
+// openOutput opens the file at path for output of the execution, as
+// described by WithStdoutFile.
+func openOutput(c *config, path string, perm os.FileMode, appendMode bool) (*os.File, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	c.onFinish(func(err error) error {
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+	return f, nil
+}
+
+// WithAtomicStdoutFile writes the output from the last command to the file
+// at path atomically: output is written to a temporary file in the same
+// directory, which is synced and renamed to path, with permissions perm, if
+// the execution succeeds, and deleted if it fails, so that readers of path
+// never observe partial output from a failed pipeline.
+func WithAtomicStdoutFile(path string, perm os.FileMode) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			dir, base := filepath.Split(path)
+			if dir == "" {
+				dir = "."
+			}
+			f, err := ioutil.TempFile(dir, "."+base+".tmp-")
+			if err != nil {
+				return err
+			}
+			c.stdout = f
+			c.onFinish(func(err error) error {
+				if err == nil {
+					err = f.Chmod(perm)
+				}
+				if err == nil {
+					err = f.Sync()
+				}
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+				if err == nil {
+					err = os.Rename(f.Name(), path)
+				}
+				if err != nil {
+					os.Remove(f.Name())
+				}
+				return err
+			})
+			return nil
+		})
+	}
+}
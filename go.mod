@@ -0,0 +1,3 @@
+module github.com/sean-jc/pipes
+
+go 1.20
@@ -0,0 +1,325 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Group is a list of pipelines run one after another, each depending on the
+// success of the previous ones, like a shell's "(make && make test)", e.g.
+// as a stage of a Pipeline, see Pipeline.Groups and Runner.ExecNested.
+type Group struct {
+	Pipelines []*Pipeline
+	// Ops holds the operators between the pipelines: "&&" runs the next
+	// pipeline only if the last one run succeeded, "||" only if it failed,
+	// and ";" regardless.  "&" runs the pipelines since the previous ";" or
+	// "&" as a background job, see Runner.Background, and may also follow
+	// the last pipeline.  As in a shell, a group fails if the last pipeline
+	// run in the foreground fails.
+	Ops []string
+}
+
+// String renders the group as a command line, see Pipeline.String.
+func (g *Group) String() string {
+	line, body := g.render(argsScript, false)
+	return line + body
+}
+
+// render renders the group like Pipeline.render.
+func (g *Group) render(cmdScript func(cmd *exec.Cmd) string, bash bool) (line, body string) {
+	for i, p := range g.Pipelines {
+		pipeline, pipelineBody := p.render(cmdScript, bash)
+		line, body = line+pipeline, body+pipelineBody
+		if i < len(g.Ops) {
+			if g.Ops[i] != ";" {
+				line += " "
+			}
+			line += g.Ops[i]
+			if i+1 < len(g.Pipelines) {
+				line += " "
+			}
+		}
+	}
+	return line, body
+}
+
+// check returns an error if g is malformed.
+func (g *Group) check() error {
+	if len(g.Pipelines) == 0 {
+		return fmt.Errorf("Empty group")
+	}
+	n := len(g.Pipelines) - 1
+	if len(g.Ops) != n && (len(g.Ops) != n+1 || g.Ops[n] != "&") {
+		return fmt.Errorf("Group of %d pipelines with %d operators", len(g.Pipelines), len(g.Ops))
+	}
+	for _, op := range g.Ops {
+		if op != "&&" && op != "||" && op != ";" && op != "&" {
+			return fmt.Errorf("Group operator %q isn't \"&&\", \"||\", \";\" or \"&\"", op)
+		}
+	}
+	return nil
+}
+
+// ExecNested executes p, whose stages may be Groups, reading data from stdin
+// for the first stage, and writing the output from the last stage to stdout
+// and all commands' Stderr output to stderr, or to the files named by p's
+// redirections, and those of the pipelines nested in it.  Runs of commands
+// are executed via ExecPipeline with opts, which shouldn't redirect input or
+// output, and a Group's pipelines one after another, sharing the group's
+// input and output, as in a shell.  Background jobs started by a Group's
+// "&" read no input, and write to the group's output until they complete,
+// even after ExecNested returns, see Runner.Jobs.  Fails with the error of
+// the first stage to fail, killing the others, like ExecPipeline.
+func (r *Runner) ExecNested(ctx context.Context, p *Pipeline, stdin io.Reader, stdout io.Writer, stderr io.Writer, opts ...Option) error {
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	// Stages and background jobs run concurrently, and may share the
+	// output.
+	if _, ok := stdout.(*os.File); !ok {
+		stdout = &lockedWriter{w: stdout}
+	}
+	if _, ok := stderr.(*os.File); !ok {
+		stderr = &lockedWriter{w: stderr}
+	}
+	return r.execNested(ctx, ctx, p, stdin, stdout, stderr, opts)
+}
+
+// execNested implements ExecNested, starting background jobs with jobCtx.
+func (r *Runner) execNested(ctx context.Context, jobCtx context.Context, p *Pipeline, stdin io.Reader, stdout io.Writer, stderr io.Writer, opts []Option) (err error) {
+	if len(p.Cmds) == 0 {
+		return fmt.Errorf("No commands provided to ExecNested")
+	}
+	if len(p.Groups) != 0 && len(p.Groups) != len(p.Cmds) {
+		return fmt.Errorf("Pipeline of %d commands with %d groups", len(p.Cmds), len(p.Groups))
+	}
+
+	// Apply the pipeline's redirections.
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if p.Stdin != "" {
+		f, err := os.Open(p.Stdin)
+		if err != nil {
+			return err
+		}
+		files, stdin = append(files, f), f
+	}
+	if p.Input != "" {
+		stdin = strings.NewReader(p.Input)
+	}
+	for _, out := range []struct {
+		name       string
+		w          *io.Writer
+		appendMode bool
+	}{{p.Stdout, &stdout, p.Append}, {p.Stderr, &stderr, false}} {
+		if out.name == "" {
+			continue
+		}
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if out.appendMode {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(out.name, flag, 0666)
+		if err != nil {
+			return err
+		}
+		files, *out.w = append(files, f), f
+	}
+	if p.MergeStderr {
+		if _, ok := stdout.(*os.File); !ok {
+			stdout = &lockedWriter{w: stdout}
+		}
+		stderr = stdout
+	}
+
+	grouped := false
+	for _, g := range p.Groups {
+		if g != nil {
+			if err = g.check(); err != nil {
+				return err
+			}
+			grouped = true
+		}
+	}
+	if !grouped {
+		return r.execRun(ctx, p.Cmds, stdin, stdout, stderr, opts)
+	}
+
+	// Feed groups from a pipe, so that each of their pipelines reads only
+	// what it consumes, as in a shell.
+	if _, ok := stdin.(*os.File); !ok && stdin != nil {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		files = append(files, pr)
+		go func(src io.Reader) {
+			io.Copy(pw, src)
+			pw.Close()
+		}(stdin)
+		stdin = pr
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+
+	// Split the pipeline into runs of commands and groups, connected by
+	// pipes, each closed once the stage reading or writing it is done.
+	in, pr := stdin, (*os.File)(nil)
+	for i := 0; i < len(p.Cmds); {
+		j := i + 1
+		var fn func(in io.Reader, out io.Writer) error
+		if g := p.Groups[i]; g != nil {
+			fn = func(in io.Reader, out io.Writer) error {
+				return r.execGroup(ctx, jobCtx, g, in, out, stderr, opts)
+			}
+		} else {
+			for j < len(p.Cmds) && p.Groups[j] == nil {
+				j++
+			}
+			cmds := p.Cmds[i:j]
+			fn = func(in io.Reader, out io.Writer) error {
+				return r.execRun(ctx, cmds, in, out, stderr, opts)
+			}
+		}
+
+		out, next, pw := stdout, (*os.File)(nil), (*os.File)(nil)
+		if j < len(p.Cmds) {
+			if next, pw, err = os.Pipe(); err != nil {
+				if pr != nil {
+					pr.Close()
+				}
+				cancel()
+				break
+			}
+			out = pw
+		}
+
+		wg.Add(1)
+		go func(in io.Reader, out io.Writer, pr, pw *os.File) {
+			defer wg.Done()
+			err := fn(in, out)
+			if pr != nil {
+				// Let the previous stage fail writing, as in a pipeline.
+				pr.Close()
+			}
+			if pw != nil {
+				pw.Close()
+			}
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(in, out, pr, pw)
+		in, pr, i = next, next, j
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return err
+}
+
+// execRun executes a run of commands of a nested pipeline.
+func (r *Runner) execRun(ctx context.Context, cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io.Writer, opts []Option) error {
+	for _, cmd := range cmds {
+		if cmd == nil {
+			return fmt.Errorf("Pipeline stage without command or group")
+		}
+	}
+	_, err := r.ExecPipeline(ctx, cmds, append(opts[:len(opts):len(opts)], WithStdin(stdin), WithStdout(stdout), WithStderr(stderr))...)
+	return err
+}
+
+// execGroup executes g's pipelines one after another, like a shell.
+func (r *Runner) execGroup(ctx context.Context, jobCtx context.Context, g *Group, stdin io.Reader, stdout io.Writer, stderr io.Writer, opts []Option) error {
+	var err error
+	for start := 0; start < len(g.Pipelines); {
+		// Find the end of the pipelines joined by "&&" or "||".
+		end := start
+		for end < len(g.Ops) && (g.Ops[end] == "&&" || g.Ops[end] == "||") {
+			end++
+		}
+
+		if end < len(g.Ops) && g.Ops[end] == "&" {
+			p := g.Pipelines[start]
+			if end > start {
+				list := &Group{Pipelines: g.Pipelines[start : end+1], Ops: g.Ops[start:end]}
+				p = &Pipeline{Cmds: []*exec.Cmd{nil}, Groups: []*Group{list}}
+			}
+			err = r.startJob(jobCtx, p, stdout, stderr, opts)
+		} else {
+			for i := start; i <= end; i++ {
+				if i > start && (g.Ops[i-1] == "&&" && err != nil || g.Ops[i-1] == "||" && err == nil) {
+					continue
+				}
+				err = r.execNested(ctx, jobCtx, g.Pipelines[i], stdin, stdout, stderr, opts)
+			}
+		}
+		start = end + 1
+	}
+	return err
+}
+
+// startJob starts p as a background job of a group writing to stdout and
+// stderr.  Like a shell's, the job has its own descriptors for any files
+// among them, e.g. a pipe, which stays open until the job completes rather
+// than until the group's pipeline does.
+func (r *Runner) startJob(ctx context.Context, p *Pipeline, stdout io.Writer, stderr io.Writer, opts []Option) error {
+	var dups []*os.File
+	dup := func(w io.Writer) (io.Writer, error) {
+		f, ok := w.(*os.File)
+		if !ok {
+			return w, nil
+		}
+		f, err := dupFile(f)
+		if err != nil {
+			return nil, err
+		}
+		dups = append(dups, f)
+		return f, nil
+	}
+	_, isFile := stdout.(*os.File)
+	merged := isFile && stderr == stdout
+
+	jobOut, err := dup(stdout)
+	jobErr := jobOut
+	if err == nil && !merged {
+		jobErr, err = dup(stderr)
+	}
+	if err != nil {
+		for _, f := range dups {
+			f.Close()
+		}
+		return err
+	}
+
+	j := r.Background(ctx, p, nil, jobOut, jobErr, opts...)
+	if len(dups) > 0 {
+		go func() {
+			<-j.Done()
+			for _, f := range dups {
+				f.Close()
+			}
+		}()
+	}
+	return nil
+}
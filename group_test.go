@@ -0,0 +1,60 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// delayEcho delays starting echo until after the rest of its group has
+// completed.
+func delayEcho(stage int, cmd *exec.Cmd) error {
+	if filepath.Base(cmd.Path) == "echo" {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestBackgroundJobOutput(t *testing.T) {
+	// The job keeps the pipe to cat open after the group completes.
+	p, err := Parse("(echo hi & true) | cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Runner
+	var out bytes.Buffer
+	if err = r.ExecNested(context.Background(), p, nil, &out, nil, WithStartHook(delayEcho)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hi\n" {
+		t.Errorf("output = %q, want %q", out.String(), "hi\n")
+	}
+
+	// The job keeps the redirection's file open after the pipeline
+	// completes.
+	dir, err := ioutil.TempDir("", "pipes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "out")
+	if p, err = Parse("(echo hi & true) &> " + Quote(name)); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.ExecNested(context.Background(), p, nil, nil, nil, WithStartHook(delayEcho)); err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range r.Jobs() {
+		if err = j.Wait(); err != nil {
+			t.Errorf("job error = %v", err)
+		}
+	}
+	if b, err := ioutil.ReadFile(name); err != nil || string(b) != "hi\n" {
+		t.Errorf("file = %q, %v, want %q", b, err, "hi\n")
+	}
+}
@@ -0,0 +1,115 @@
+package pipes
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+)
+
+// Handle is an execution started by Runner.Start.
+type Handle struct {
+	done chan struct{}
+	res  *Result
+	err  error
+
+	mu   sync.Mutex
+	pids []int
+}
+
+// Start starts executing a pipeline, see ExecPipeline, without waiting for
+// it to complete.  The returned Handle's Wait method returns the Result and
+// error of the execution.
+func (r *Runner) Start(ctx context.Context, cmds []*exec.Cmd, opts ...Option) *Handle {
+	h := &Handle{done: make(chan struct{})}
+
+	// Track the commands' pids last, so that they are recorded once
+	// the commands are actually started.
+	opts = append(opts[:len(opts):len(opts)], h.track)
+	go func() {
+		h.res, h.err = r.ExecPipeline(ctx, cmds, opts...)
+		close(h.done)
+	}()
+	return h
+}
+
+func (h *Handle) track(c *config) {
+	c.onStart(func(cmd *exec.Cmd, start func() error) error {
+		if err := start(); err != nil {
+			return err
+		}
+		h.mu.Lock()
+		h.pids = append(h.pids, cmd.Process.Pid)
+		h.mu.Unlock()
+		return nil
+	}, nil)
+}
+
+// Done returns a channel that is closed once the execution completes.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait waits for the execution to complete and returns its Result and
+// error, see ExecPipeline.
+func (h *Handle) Wait() (*Result, error) {
+	<-h.done
+	return h.res, h.err
+}
+
+// running returns the pids of the commands that have been started and not
+// yet waited on, whose pids therefore can't have been reused.
+func (h *Handle) running() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var pids []int
+	for _, pid := range h.pids {
+		if isTracked(pid) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// ProcessInfo describes a process in the tree of an execution.
+type ProcessInfo struct {
+	Pid  int      `json:"pid"`
+	PPid int      `json:"ppid"`
+	Args []string `json:"args"`
+	// RSS is the process's resident set size in bytes.
+	RSS int64 `json:"rss_bytes"`
+}
+
+// Tree returns the execution's running commands and all of their
+// descendants, parents before children, e.g. to show what a pipeline is
+// actually running.  On Linux the tree is read from /proc, on other Unix
+// platforms it is read from ps(1), whose output doesn't preserve argument
+// boundaries.  Not supported on Windows.
+func (h *Handle) Tree() ([]ProcessInfo, error) {
+	roots := h.running()
+	if len(roots) == 0 {
+		return nil, nil
+	}
+	list, err := listProcesses()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]ProcessInfo)
+	byPid := make(map[int]ProcessInfo)
+	for _, p := range list {
+		children[p.PPid] = append(children[p.PPid], p)
+		byPid[p.Pid] = p
+	}
+
+	var tree []ProcessInfo
+	for _, pid := range roots {
+		if p, ok := byPid[pid]; ok {
+			tree = append(tree, p)
+		}
+	}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i].Pid]...)
+	}
+	return tree, nil
+}
@@ -0,0 +1,136 @@
+package pipes
+
+import (
+	"sync"
+	"time"
+)
+
+// HistoryStatus selects executions by outcome in a HistoryQuery.
+type HistoryStatus int
+
+const (
+	// AnyStatus selects all executions.
+	AnyStatus HistoryStatus = iota
+	// Succeeded selects executions that didn't fail.
+	Succeeded
+	// Failed selects executions that failed.
+	Failed
+)
+
+// HistoryQuery selects executions from a HistoryStore.  Zero fields don't
+// restrict the selection.
+type HistoryQuery struct {
+	// RunID selects the execution with the given run ID, see WithRunID.
+	RunID string
+	// Label selects executions with the given label, see WithLabel.
+	Label string
+	// Since and Until select executions recorded at or after Since and
+	// before Until.
+	Since time.Time
+	Until time.Time
+	// Status selects executions by outcome.
+	Status HistoryStatus
+	// Limit is the maximum number of executions to return.
+	Limit int
+}
+
+// Matches reports whether q selects rec, for HistoryStore implementations.
+func (q *HistoryQuery) Matches(rec *AuditRecord) bool {
+	switch {
+	case q.RunID != "" && rec.Result.RunID != q.RunID:
+		return false
+	case q.Label != "" && rec.Result.Label != q.Label:
+		return false
+	case !q.Since.IsZero() && rec.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !rec.Time.Before(q.Until):
+		return false
+	case q.Status == Succeeded && rec.Error != "":
+		return false
+	case q.Status == Failed && rec.Error == "":
+		return false
+	}
+	return true
+}
+
+// HistoryStore records executions and answers queries about them, e.g. for
+// a "recent jobs" admin page.  Set it as a Runner's Audit to record the
+// Runner's executions, see MultiAudit to also keep an audit log.
+type HistoryStore interface {
+	AuditSink
+	// Query returns the recorded executions selected by q, most recent
+	// first.
+	Query(q HistoryQuery) ([]AuditRecord, error)
+}
+
+// RingHistory is a HistoryStore that keeps the most recent executions in
+// memory.
+type RingHistory struct {
+	mu   sync.Mutex
+	recs []AuditRecord
+	// next is the index at which the next record is stored, once recs
+	// is full.
+	next int
+}
+
+// NewRingHistory returns a RingHistory that keeps the size most recent
+// executions.
+func NewRingHistory(size int) *RingHistory {
+	return &RingHistory{recs: make([]AuditRecord, 0, size)}
+}
+
+// Audit records rec, evicting the oldest record if the ring is full.
+func (h *RingHistory) Audit(rec AuditRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if cap(h.recs) == 0 {
+		return nil
+	}
+	if len(h.recs) < cap(h.recs) {
+		h.recs = append(h.recs, rec)
+		return nil
+	}
+	h.recs[h.next] = rec
+	h.next = (h.next + 1) % len(h.recs)
+	return nil
+}
+
+// Query returns the recorded executions selected by q, most recent first.
+// The records are shared with other callers and must not be modified.
+func (h *RingHistory) Query(q HistoryQuery) ([]AuditRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var recs []AuditRecord
+	for i := 1; i <= len(h.recs); i++ {
+		rec := &h.recs[(h.next-i+len(h.recs))%len(h.recs)]
+		if !q.Matches(rec) {
+			continue
+		}
+		recs = append(recs, *rec)
+		if q.Limit > 0 && len(recs) == q.Limit {
+			break
+		}
+	}
+	return recs, nil
+}
+
+type multiAudit []AuditSink
+
+func (m multiAudit) Audit(rec AuditRecord) error {
+	var first error
+	for _, sink := range m {
+		if err := sink.Audit(rec); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// MultiAudit returns an AuditSink that passes each record to all sinks,
+// e.g. to both keep an audit log and a HistoryStore.  Returns the first
+// error returned by a sink, after passing the record to all of them.
+func MultiAudit(sinks ...AuditSink) AuditSink {
+	return multiAudit(sinks)
+}
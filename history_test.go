@@ -0,0 +1,83 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// labels returns the labels of recs.
+func labels(recs []AuditRecord) []string {
+	var l []string
+	for _, rec := range recs {
+		l = append(l, rec.Result.Label)
+	}
+	return l
+}
+
+func TestRingHistory(t *testing.T) {
+	h := NewRingHistory(3)
+	start := time.Unix(1000, 0)
+	for i, label := range []string{"a", "b", "c", "d", "e"} {
+		rec := AuditRecord{Time: start.Add(time.Duration(i) * time.Second), Result: Result{Label: label}}
+		if i%2 == 1 {
+			rec.Error = "failed"
+		}
+		h.Audit(rec)
+	}
+
+	// The oldest records are evicted, and the rest returned most recent
+	// first.
+	for _, tt := range []struct {
+		q    HistoryQuery
+		want string
+	}{
+		{HistoryQuery{}, "e d c"},
+		{HistoryQuery{Limit: 2}, "e d"},
+		{HistoryQuery{Label: "d"}, "d"},
+		{HistoryQuery{Label: "a"}, ""},
+		{HistoryQuery{Status: Succeeded}, "e c"},
+		{HistoryQuery{Status: Failed}, "d"},
+		{HistoryQuery{Since: start.Add(3 * time.Second)}, "e d"},
+		{HistoryQuery{Until: start.Add(3 * time.Second)}, "c"},
+	} {
+		recs, err := h.Query(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(labels(recs), " "); got != tt.want {
+			t.Errorf("Query(%+v) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+
+	if err := NewRingHistory(0).Audit(AuditRecord{}); err != nil {
+		t.Error(err)
+	}
+}
+
+// errorSink is an AuditSink that fails.
+type errorSink struct{ err error }
+
+func (s errorSink) Audit(rec AuditRecord) error {
+	return s.err
+}
+
+func TestMultiAudit(t *testing.T) {
+	h1, h2 := NewRingHistory(10), NewRingHistory(10)
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+	r := &Runner{Audit: MultiAudit(h1, errorSink{errFirst}, errorSink{errSecond}, h2)}
+	if _, err := r.Exec(context.Background(), exec.Command("true"), WithLabel("job")); err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []*RingHistory{h1, h2} {
+		if recs, _ := h.Query(HistoryQuery{}); len(recs) != 1 || recs[0].Result.Label != "job" {
+			t.Errorf("recorded %q, want the execution", labels(recs))
+		}
+	}
+	if err := MultiAudit(h1, errorSink{errFirst}, errorSink{errSecond}).Audit(AuditRecord{}); err != errFirst {
+		t.Errorf("error = %v, want %v", err, errFirst)
+	}
+}
@@ -0,0 +1,73 @@
+package pipes
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// initSignals are the signals forwarded to the payload by Init.
+var initSignals = []os.Signal{
+	syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH,
+}
+
+// Init runs cmd as the payload of a container whose entrypoint is this
+// process, doing the job of init: signals sent to this process, e.g. by
+// "docker stop", are forwarded to cmd, and orphaned processes are reaped,
+// as by EnableSubreaper if this process isn't PID 1.  cmd inherits this
+// process's stdin, stdout and stderr unless they are already set.  Returns
+// once cmd exits, with its exit code, or 128 plus the signal number if it
+// was killed by a signal, like a shell, for this process to exit with.
+// Only supported on Linux.
+func Init(cmd *exec.Cmd) (int, error) {
+	if os.Getpid() == 1 {
+		startReaper()
+	} else if err := EnableSubreaper(); err != nil {
+		return -1, err
+	}
+
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	// Catch signals before starting cmd, lest one arriving in between
+	// kill this process.
+	sigs := make(chan os.Signal, 16)
+	signal.Notify(sigs, initSignals...)
+	defer signal.Stop(sigs)
+
+	if err := forkTracked(cmd); err != nil {
+		return -1, fmt.Errorf("%s %s", cmd.Path, err.Error())
+	}
+	defer untrack(cmd)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	cmd.Wait()
+	close(done)
+
+	status := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return status.ExitStatus(), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Init is only supported on Linux.
+func Init(cmd *exec.Cmd) (int, error) {
+	return -1, errors.New("init not supported on this platform")
+}
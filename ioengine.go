@@ -0,0 +1,120 @@
+package pipes
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// IOEngine forwards the output of many commands to their writers from a
+// single goroutine polling the commands' pipes, instead of os/exec's
+// goroutine per stream, to reduce scheduler pressure when hundreds of
+// pipelines run concurrently, see WithIOEngine.  As writes are made by the
+// engine's goroutine, a writer that blocks delays the output of all
+// executions using the engine.  Only supported on Linux.
+type IOEngine struct {
+	poller
+}
+
+// NewIOEngine returns an IOEngine, which must be closed once it's no
+// longer used.
+func NewIOEngine() (*IOEngine, error) {
+	e := &IOEngine{}
+	if err := e.init(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Close stops the engine once all executions using it have completed.
+func (e *IOEngine) Close() error {
+	return e.close()
+}
+
+// ioStream is a command's output forwarded to a writer by an IOEngine.
+type ioStream struct {
+	w io.Writer
+	// pw is the pipe's write end, passed to the commands.
+	pw   *os.File
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// closeWriter closes this process's end of the pipe, once the commands
+// have been started.
+func (s *ioStream) closeWriter() {
+	s.once.Do(func() { s.pw.Close() })
+}
+
+// wait waits for the commands' output to be forwarded.
+func (s *ioStream) wait() error {
+	s.closeWriter()
+	<-s.done
+	return s.err
+}
+
+// WithIOEngine forwards the commands' output to writers that aren't files,
+// which the commands can't write to directly, via e rather than os/exec's
+// goroutines.
+func WithIOEngine(e *IOEngine) Option {
+	return func(c *config) {
+		var stdout, stderr *ioStream
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			i, last := stageIndex(c.cmds, cmd), len(c.cmds)-1
+			var err error
+			if i == last && cmd.Stdout != nil && !isFile(cmd.Stdout) {
+				if stdout, err = e.stream(cmd.Stdout); err != nil {
+					return err
+				}
+				cmd.Stdout = stdout.pw
+			}
+			if cmd.Stderr != nil && !isFile(cmd.Stderr) {
+				if stderr == nil {
+					if stderr, err = e.stream(cmd.Stderr); err != nil {
+						return err
+					}
+				}
+				cmd.Stderr = stderr.pw
+			}
+
+			err = start()
+			if i == last {
+				for _, s := range []*ioStream{stdout, stderr} {
+					if s != nil {
+						s.closeWriter()
+					}
+				}
+			}
+			return err
+		}, nil)
+
+		// Wait for the output once the commands have exited, before the
+		// execution's output is complete.
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			err := wait()
+			if stageIndex(c.cmds, cmd) != len(c.cmds)-1 {
+				return err
+			}
+			for _, s := range []*ioStream{stdout, stderr} {
+				if s == nil {
+					continue
+				}
+				if serr := s.wait(); err == nil {
+					err = serr
+				}
+			}
+			return err
+		}, nil)
+
+		c.onRelease(func() {
+			for _, s := range []*ioStream{stdout, stderr} {
+				if s != nil {
+					s.wait()
+				}
+			}
+		})
+	}
+}
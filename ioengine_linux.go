@@ -0,0 +1,202 @@
+package pipes
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// poller forwards output from non-blocking pipes registered with an epoll
+// instance.
+type poller struct {
+	epfd int
+	// wake is written to by close to wake the polling goroutine.
+	wakeR, wakeW int
+	done         chan struct{}
+
+	mu      sync.Mutex
+	streams map[int]*ioStream
+	closing bool
+}
+
+func (p *poller) init() error {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("epoll_create1", err)
+	}
+	var wake [2]int
+	if err = syscall.Pipe2(wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		syscall.Close(epfd)
+		return os.NewSyscallError("pipe2", err)
+	}
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(wake[0])}
+	if err = syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, wake[0], &ev); err != nil {
+		syscall.Close(epfd)
+		syscall.Close(wake[0])
+		syscall.Close(wake[1])
+		return os.NewSyscallError("epoll_ctl", err)
+	}
+
+	p.epfd, p.wakeR, p.wakeW = epfd, wake[0], wake[1]
+	p.done = make(chan struct{})
+	p.streams = make(map[int]*ioStream)
+	go p.run()
+	return nil
+}
+
+// stream returns a stream forwarding the output written to its pipe to w.
+func (p *poller) stream(w io.Writer) (*ioStream, error) {
+	// Only the read end is non-blocking, the commands get a regular
+	// blocking pipe.
+	var fds [2]int
+	syscall.ForkLock.RLock()
+	err := syscall.Pipe2(fds[:], syscall.O_CLOEXEC)
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, os.NewSyscallError("pipe2", err)
+	}
+	if err = syscall.SetNonblock(fds[0], true); err != nil {
+		syscall.Close(fds[0])
+		syscall.Close(fds[1])
+		return nil, os.NewSyscallError("fcntl", err)
+	}
+	s := &ioStream{w: w, pw: os.NewFile(uintptr(fds[1]), "|1"), done: make(chan struct{})}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closing {
+		syscall.Close(fds[0])
+		s.pw.Close()
+		return nil, fmt.Errorf("I/O engine is closed")
+	}
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fds[0])}
+	if err = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, fds[0], &ev); err != nil {
+		syscall.Close(fds[0])
+		s.pw.Close()
+		return nil, os.NewSyscallError("epoll_ctl", err)
+	}
+	p.streams[fds[0]] = s
+	return s, nil
+}
+
+func (p *poller) run() {
+	defer close(p.done)
+
+	events := make([]syscall.EpollEvent, 128)
+	buf := make([]byte, DefaultCopyBuffer)
+	for {
+		n, err := syscall.EpollWait(p.epfd, events, -1)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			p.fail(os.NewSyscallError("epoll_wait", err))
+			return
+		}
+
+		for _, ev := range events[:n] {
+			fd := int(ev.Fd)
+			if fd == p.wakeR {
+				p.mu.Lock()
+				stop := p.closing && len(p.streams) == 0
+				p.mu.Unlock()
+				if stop {
+					return
+				}
+				var drain [16]byte
+				syscall.Read(p.wakeR, drain[:])
+				continue
+			}
+
+			p.mu.Lock()
+			s := p.streams[fd]
+			p.mu.Unlock()
+			if s != nil {
+				p.forward(fd, s, buf)
+			}
+		}
+	}
+}
+
+// forward forwards the output available from the stream's pipe, finishing
+// the stream once the pipe is closed by the commands.
+func (p *poller) forward(fd int, s *ioStream, buf []byte) {
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		} else if err == syscall.EAGAIN {
+			return
+		}
+		if n > 0 {
+			w := s.w
+			if s.err != nil {
+				// Keep draining, lest the commands block.
+				w = ioutil.Discard
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				s.err = werr
+			}
+			continue
+		}
+		if err != nil && s.err == nil {
+			s.err = os.NewSyscallError("read", err)
+		}
+		p.finish(fd, s)
+		return
+	}
+}
+
+// finish stops polling the stream's pipe.
+func (p *poller) finish(fd int, s *ioStream) {
+	syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, fd, nil)
+	syscall.Close(fd)
+
+	p.mu.Lock()
+	delete(p.streams, fd)
+	if p.closing && len(p.streams) == 0 {
+		p.wake()
+	}
+	p.mu.Unlock()
+	close(s.done)
+}
+
+// fail finishes all streams with err, e.g. if polling fails.
+func (p *poller) fail(err error) {
+	p.mu.Lock()
+	streams := p.streams
+	p.streams = make(map[int]*ioStream)
+	p.closing = true
+	p.mu.Unlock()
+
+	for fd, s := range streams {
+		syscall.Close(fd)
+		if s.err == nil {
+			s.err = err
+		}
+		close(s.done)
+	}
+}
+
+func (p *poller) wake() {
+	syscall.Write(p.wakeW, []byte{0})
+}
+
+func (p *poller) close() error {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		<-p.done
+		return nil
+	}
+	p.closing = true
+	p.wake()
+	p.mu.Unlock()
+
+	<-p.done
+	syscall.Close(p.wakeR)
+	syscall.Close(p.wakeW)
+	return syscall.Close(p.epfd)
+}
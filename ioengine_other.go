@@ -0,0 +1,22 @@
+//go:build !linux
+
+package pipes
+
+import (
+	"errors"
+	"io"
+)
+
+type poller struct{}
+
+func (p *poller) init() error {
+	return errors.New("I/O engine not supported on this platform")
+}
+
+func (p *poller) close() error {
+	return nil
+}
+
+func (p *poller) stream(w io.Writer) (*ioStream, error) {
+	return nil, errors.New("I/O engine not supported on this platform")
+}
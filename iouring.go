@@ -0,0 +1,100 @@
+package pipes
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// IOUringSupported returns true if WithIOUring can be used, i.e. if this
+// package was built for Linux with the pipes_iouring build tag and the
+// kernel permits io_uring.
+func IOUringSupported() bool {
+	return checkIOUring() == nil
+}
+
+// WithIOUring moves data between the commands via an io_uring, rather than
+// plain pipes: each command's output is spliced into the next command's
+// input, and output to writers that aren't files, which the commands can't
+// write to directly, is read via the ring.  It's experimental, and only
+// available on Linux when built with the pipes_iouring build tag, e.g.
+// `go build -tags pipes_iouring`; otherwise every execution fails.  See
+// bench.CopyVariants to measure whether it helps a pipeline.
+func WithIOUring() Option {
+	copyOutput := withCopy(func(dst io.Writer, src *os.File) error {
+		_, err := uringCopy(dst, src)
+		return err
+	})
+	return func(c *config) {
+		// Splice each command's output into a pipe to the next command,
+		// which is waited for before the previous command's output is
+		// closed by os/exec.
+		var splices []sync.WaitGroup
+
+		c.onSetup(func(c *config) error {
+			if err := checkIOUring(); err != nil {
+				return fmt.Errorf("io_uring: %w", err)
+			}
+			splices = make([]sync.WaitGroup, len(c.cmds))
+			return nil
+		})
+		copyOutput(c)
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			i := stageIndex(c.cmds, cmd)
+			prev, ok := cmd.Stdin.(*os.File)
+			if i == 0 || !ok {
+				return start()
+			}
+
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			cmd.Stdin = pr
+			err = start()
+			pr.Close()
+			if err != nil {
+				pw.Close()
+				return err
+			}
+
+			splices[i].Add(1)
+			go func() {
+				defer splices[i].Done()
+
+				_, err := uringCopy(pw, prev)
+				pw.Close()
+				if err != nil {
+					// The command exited early, let the previous
+					// command fail writing, as in a pipeline.
+					if isWriteError(err) {
+						prev.Close()
+					} else {
+						io.Copy(ioutil.Discard, prev)
+					}
+				}
+			}()
+			return nil
+		}, nil)
+
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			i := stageIndex(c.cmds, cmd)
+			if i+1 < len(splices) {
+				done := make(chan struct{})
+				go func() {
+					splices[i+1].Wait()
+					close(done)
+				}()
+				select {
+				case <-done:
+				case <-c.runCtx.Done():
+				}
+			}
+			return wait()
+		}, nil)
+	}
+}
@@ -0,0 +1,234 @@
+//go:build linux && pipes_iouring
+
+package pipes
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sysIOUringSetup = 425
+	sysIOUringEnter = 426
+
+	iouringOffSQRing = 0
+	iouringOffCQRing = 0x8000000
+	iouringOffSQEs   = 0x10000000
+
+	iouringEnterGetEvents = 1
+
+	iouringOpRead   = 22
+	iouringOpSplice = 30
+
+	// iouringChunk is the most read or spliced by a single operation.
+	iouringChunk = 1 << 20
+)
+
+type iouringSQOffsets struct {
+	Head, Tail, RingMask, RingEntries, Flags, Dropped, Array, Resv1 uint32
+	UserAddr                                                        uint64
+}
+
+type iouringCQOffsets struct {
+	Head, Tail, RingMask, RingEntries, Overflow, CQEs, Flags, Resv1 uint32
+	UserAddr                                                        uint64
+}
+
+type iouringParams struct {
+	SQEntries, CQEntries, Flags, SQThreadCPU, SQThreadIdle, Features, WQFd uint32
+	Resv                                                                   [3]uint32
+	SQOff                                                                  iouringSQOffsets
+	CQOff                                                                  iouringCQOffsets
+}
+
+type iouringSQE struct {
+	Opcode      uint8
+	Flags       uint8
+	Ioprio      uint16
+	Fd          int32
+	Off         uint64
+	Addr        uint64
+	Len         uint32
+	OpFlags     uint32
+	UserData    uint64
+	BufIndex    uint16
+	Personality uint16
+	SpliceFdIn  int32
+	Addr3       uint64
+	_           uint64
+}
+
+type iouringCQE struct {
+	UserData uint64
+	Res      int32
+	Flags    uint32
+}
+
+// ring is a minimal io_uring, performing one operation at a time for a
+// single goroutine.
+type ring struct {
+	fd           int
+	sq, cq, sqes []byte
+	p            iouringParams
+}
+
+func newRing() (*ring, error) {
+	r := &ring{fd: -1}
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, 2, uintptr(unsafe.Pointer(&r.p)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", errno)
+	}
+	r.fd = int(fd)
+
+	var err error
+	mmap := func(off int64, size uint32) []byte {
+		if err != nil {
+			return nil
+		}
+		var b []byte
+		if b, err = syscall.Mmap(r.fd, off, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+			err = os.NewSyscallError("mmap", err)
+		}
+		return b
+	}
+	r.sq = mmap(iouringOffSQRing, r.p.SQOff.Array+r.p.SQEntries*4)
+	r.cq = mmap(iouringOffCQRing, r.p.CQOff.CQEs+r.p.CQEntries*uint32(unsafe.Sizeof(iouringCQE{})))
+	r.sqes = mmap(iouringOffSQEs, r.p.SQEntries*uint32(unsafe.Sizeof(iouringSQE{})))
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *ring) close() {
+	for _, b := range [][]byte{r.sq, r.cq, r.sqes} {
+		if b != nil {
+			syscall.Munmap(b)
+		}
+	}
+	if r.fd >= 0 {
+		syscall.Close(r.fd)
+	}
+}
+
+func u32(b []byte, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&b[off]))
+}
+
+// do submits sqe and waits for its completion, returning its result.
+func (r *ring) do(sqe iouringSQE) (int32, error) {
+	tail := atomic.LoadUint32(u32(r.sq, r.p.SQOff.Tail))
+	idx := tail & *u32(r.sq, r.p.SQOff.RingMask)
+	*(*iouringSQE)(unsafe.Pointer(&r.sqes[uintptr(idx)*unsafe.Sizeof(sqe)])) = sqe
+	*u32(r.sq, r.p.SQOff.Array+idx*4) = idx
+	atomic.StoreUint32(u32(r.sq, r.p.SQOff.Tail), tail+1)
+
+	submit := uintptr(1)
+	for {
+		head := atomic.LoadUint32(u32(r.cq, r.p.CQOff.Head))
+		if head != atomic.LoadUint32(u32(r.cq, r.p.CQOff.Tail)) {
+			idx := head & *u32(r.cq, r.p.CQOff.RingMask)
+			cqe := *(*iouringCQE)(unsafe.Pointer(&r.cq[uintptr(r.p.CQOff.CQEs)+uintptr(idx)*unsafe.Sizeof(iouringCQE{})]))
+			atomic.StoreUint32(u32(r.cq, r.p.CQOff.Head), head+1)
+			if cqe.Res < 0 {
+				return 0, syscall.Errno(-cqe.Res)
+			}
+			return cqe.Res, nil
+		}
+
+		_, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.fd), submit, 1, iouringEnterGetEvents, 0, 0)
+		if errno != 0 && errno != syscall.EINTR {
+			return 0, os.NewSyscallError("io_uring_enter", errno)
+		}
+		if errno == 0 {
+			submit = 0
+		}
+	}
+}
+
+// read reads from fd at its current position into buf.
+func (r *ring) read(fd uintptr, buf []byte) (int, error) {
+	n, err := r.do(iouringSQE{
+		Opcode: iouringOpRead,
+		Fd:     int32(fd),
+		Off:    ^uint64(0),
+		Addr:   uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		Len:    uint32(len(buf)),
+	})
+	runtime.KeepAlive(buf)
+	return int(n), err
+}
+
+// splice moves up to n bytes from in to out, one of which is a pipe.
+func (r *ring) splice(in, out uintptr, n int) (int, error) {
+	m, err := r.do(iouringSQE{
+		Opcode:     iouringOpSplice,
+		Fd:         int32(out),
+		Off:        ^uint64(0),
+		Addr:       ^uint64(0),
+		Len:        uint32(n),
+		SpliceFdIn: int32(in),
+	})
+	return int(m), err
+}
+
+func checkIOUring() error {
+	r, err := newRing()
+	if err != nil {
+		return err
+	}
+	r.close()
+	return nil
+}
+
+// uringCopy copies from src, a pipe, to dst until src ends, splicing if dst
+// is a file.  Both files are switched to blocking mode, so that the ring's
+// operations wait for data rather than fail.
+func uringCopy(dst io.Writer, src *os.File) (int64, error) {
+	r, err := newRing()
+	if err != nil {
+		return 0, err
+	}
+	defer r.close()
+
+	var written int64
+	in := src.Fd()
+	if f, ok := dst.(*os.File); ok {
+		out := f.Fd()
+		for {
+			n, err := r.splice(in, out, iouringChunk)
+			written += int64(n)
+			if err == syscall.EINVAL && written == 0 {
+				// Not spliceable, e.g. appending.
+				break
+			} else if err == syscall.EPIPE {
+				return written, &os.PathError{Op: "write", Path: f.Name(), Err: err}
+			} else if err != nil {
+				return written, os.NewSyscallError("splice", err)
+			} else if n == 0 {
+				return written, nil
+			}
+		}
+	}
+
+	buf := copyBuffers.Get().([]byte)
+	defer copyBuffers.Put(buf)
+	for {
+		n, err := r.read(in, buf)
+		if err != nil {
+			return written, &os.PathError{Op: "read", Path: src.Name(), Err: err}
+		} else if n == 0 {
+			return written, nil
+		}
+		m, err := dst.Write(buf[:n])
+		written += int64(m)
+		if err != nil {
+			return written, err
+		}
+	}
+}
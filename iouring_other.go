@@ -0,0 +1,19 @@
+//go:build !linux || !pipes_iouring
+
+package pipes
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var errNoIOUring = errors.New("not supported, build with the pipes_iouring tag on Linux")
+
+func checkIOUring() error {
+	return errNoIOUring
+}
+
+func uringCopy(dst io.Writer, src *os.File) (int64, error) {
+	return 0, errNoIOUring
+}
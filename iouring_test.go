@@ -0,0 +1,80 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// benchCopyLoops are copyLoops and, if supported, uringCopy.
+func benchCopyLoops() []struct {
+	name string
+	copy copyFunc
+} {
+	loops := copyLoops
+	if IOUringSupported() {
+		loops = append(loops[:len(loops):len(loops)], struct {
+			name string
+			copy copyFunc
+		}{"iouring", uringCopy})
+	}
+	return loops
+}
+
+func BenchmarkCopyLargeWrites(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+
+	// Copying to a file splices via io_uring.
+	for _, dst := range []struct {
+		name string
+		w    io.Writer
+	}{{"writer", nil}, {"file", devNull}} {
+		for _, loop := range benchCopyLoops() {
+			b.Run(fmt.Sprintf("%s/%s", loop.name, dst.name), func(b *testing.B) {
+				benchmarkCopy(b, loop.copy, dst.w, 64<<10, 16<<20)
+			})
+		}
+	}
+}
+
+// BenchmarkIOUring benchmarks streaming through a pipeline with and without
+// WithIOUring, which is skipped unless it's supported.
+func BenchmarkIOUring(b *testing.B) {
+	for _, variant := range []struct {
+		name string
+		opts []Option
+	}{
+		{"exec", nil},
+		{"fastcopy", []Option{WithFastCopy(0)}},
+		{"iouring", []Option{WithIOUring()}},
+	} {
+		b.Run(variant.name, func(b *testing.B) {
+			if variant.name == "iouring" && !IOUringSupported() {
+				b.Skip("io_uring not supported, build with the pipes_iouring tag on Linux")
+			}
+			const size = 16 << 20
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				w := &countingWriter{}
+				cmds := []*exec.Cmd{
+					exec.Command("head", "-c", fmt.Sprint(size), "/dev/zero"),
+					exec.Command("cat"),
+					exec.Command("cat"),
+				}
+				if _, err := (&Runner{}).ExecPipeline(context.Background(), cmds, append(variant.opts, WithStdout(w))...); err != nil {
+					b.Fatal(err)
+				}
+				if w.n != size {
+					b.Fatalf("copied %d bytes, want %d", w.n, size)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package pipes
+
+import (
+	"context"
+	"io"
+)
+
+// Job is a pipeline running in the background, like one started by a
+// shell's "&", see Runner.Background.
+type Job struct {
+	// ID identifies the job among the Runner's jobs, numbered from 1 like
+	// a shell's.
+	ID int
+	// Cmdline describes the pipeline, see Pipeline.String.
+	Cmdline string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Background starts executing p in the background via ExecNested, which is
+// listed by Jobs until it completes, e.g. to start concurrent workers and
+// wait for them later, as a shell script would with "&" and "wait".  The
+// job is killed if ctx is done before it completes.
+func (r *Runner) Background(ctx context.Context, p *Pipeline, stdin io.Reader, stdout io.Writer, stderr io.Writer, opts ...Option) *Job {
+	ctx, cancel := context.WithCancel(ctx)
+	j := &Job{Cmdline: p.String(), cancel: cancel, done: make(chan struct{})}
+
+	r.jobsMu.Lock()
+	r.lastJob++
+	j.ID = r.lastJob
+	r.jobs = append(r.jobs, j)
+	r.jobsMu.Unlock()
+
+	go func() {
+		j.err = r.ExecNested(ctx, p, stdin, stdout, stderr, opts...)
+		cancel()
+
+		r.jobsMu.Lock()
+		for i, job := range r.jobs {
+			if job == j {
+				r.jobs = append(r.jobs[:i], r.jobs[i+1:]...)
+				break
+			}
+		}
+		r.jobsMu.Unlock()
+		close(j.done)
+	}()
+	return j
+}
+
+// Jobs returns the Runner's background jobs that haven't completed yet, in
+// the order they were started.
+func (r *Runner) Jobs() []*Job {
+	r.jobsMu.Lock()
+	defer r.jobsMu.Unlock()
+	return append([]*Job(nil), r.jobs...)
+}
+
+// Done returns a channel that is closed once the job completes.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait waits for the job to complete and returns its error, see
+// ExecNested.
+func (j *Job) Wait() error {
+	<-j.done
+	return j.err
+}
+
+// Kill kills the job's commands, unless it has completed, and waits for it
+// to complete.
+func (j *Job) Kill() {
+	j.cancel()
+	<-j.done
+}
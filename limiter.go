@@ -0,0 +1,140 @@
+package pipes
+
+import (
+	"container/heap"
+	"context"
+	"os/exec"
+	"sync"
+)
+
+// Limiter bounds the total weight of child processes run concurrently by
+// one or more Runners.  Executions that would exceed the limit are queued
+// and started as running executions complete, highest priority first and
+// in FIFO order among executions of equal priority, see WithPriority.
+type Limiter struct {
+	// Weight, if non-nil, returns the weight of cmd, e.g. to account for
+	// classes of commands that are more expensive than others.  Commands
+	// have a weight of one by default.
+	Weight func(cmd *exec.Cmd) int64
+
+	mu      sync.Mutex
+	max     int64
+	used    int64
+	seq     uint64
+	waiters waitQueue
+}
+
+type waiter struct {
+	n        int64
+	priority int
+	seq      uint64
+	index    int
+	ready    chan struct{}
+}
+
+// waitQueue is a heap of waiters ordered by priority, then by arrival.
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *waitQueue) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return w
+}
+
+// NewLimiter returns a Limiter that allows up to max units of weight, i.e.
+// max child processes by default, to run concurrently.
+func NewLimiter(max int64) *Limiter {
+	return &Limiter{max: max}
+}
+
+// weight returns the total weight of cmds, clamped to the Limiter's maximum
+// so that an oversized pipeline can still run, albeit on its own.
+func (l *Limiter) weight(cmds []*exec.Cmd) int64 {
+	var n int64
+	for _, cmd := range cmds {
+		if l.Weight != nil {
+			n += l.Weight(cmd)
+		} else {
+			n++
+		}
+	}
+	if n > l.max {
+		n = l.max
+	}
+	return n
+}
+
+// acquire blocks until n units of weight are available to an execution of
+// the given priority, or ctx is done, in which case the execution is removed
+// from the queue and the context's error is returned.
+func (l *Limiter) acquire(ctx context.Context, n int64, priority int) error {
+	w := &waiter{n: n, priority: priority, ready: make(chan struct{})}
+
+	l.mu.Lock()
+	w.seq = l.seq
+	l.seq++
+	heap.Push(&l.waiters, w)
+	l.grant()
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		select {
+		case <-w.ready:
+			// Acquired after the context was done, give it back.
+			l.used -= n
+		default:
+			heap.Remove(&l.waiters, w.index)
+		}
+		l.grant()
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// release returns n units of weight to the Limiter.
+func (l *Limiter) release(n int64) {
+	l.mu.Lock()
+	l.used -= n
+	l.grant()
+	l.mu.Unlock()
+}
+
+// grant wakes queued waiters, in order, for as long as their weight fits.
+// Must be called with mu held.
+func (l *Limiter) grant() {
+	for l.waiters.Len() > 0 {
+		w := l.waiters[0]
+		if l.used+w.n > l.max {
+			break
+		}
+		l.used += w.n
+		heap.Pop(&l.waiters)
+		close(w.ready)
+	}
+}
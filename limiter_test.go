@@ -0,0 +1,125 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n executions are queued by l.
+func waitQueued(l *Limiter, n int) {
+	for {
+		l.mu.Lock()
+		queued := l.waiters.Len()
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterOrder(t *testing.T) {
+	l := NewLimiter(2)
+	if err := l.acquire(context.Background(), 2, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	granted := make(chan struct{})
+	for i, w := range []struct {
+		name     string
+		priority int
+	}{{"a", 0}, {"b", 1}, {"c", 0}, {"d", 1}} {
+		go func(name string, priority int) {
+			l.acquire(context.Background(), 1, priority)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			granted <- struct{}{}
+		}(w.name, w.priority)
+		waitQueued(l, i+1)
+	}
+
+	// Releasing one unit at a time admits one execution at a time,
+	// highest priority first, then in arrival order.
+	for i := 0; i < 4; i++ {
+		l.release(1)
+		<-granted
+	}
+	if got := order; len(got) != 4 || got[0] != "b" || got[1] != "d" || got[2] != "a" || got[3] != "c" {
+		t.Errorf("executions admitted in order %q, want [b d a c]", got)
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	l := NewLimiter(1)
+	if err := l.acquire(context.Background(), 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.acquire(ctx, 1, 0)
+	}()
+	waitQueued(l, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("acquire() error = %v, want %v", err, context.Canceled)
+	}
+	waitQueued(l, 0)
+
+	l.release(1)
+	if l.used != 0 {
+		t.Errorf("%d units used after release, want 0", l.used)
+	}
+}
+
+func TestLimiterWeight(t *testing.T) {
+	cmds := []*exec.Cmd{exec.Command("a"), exec.Command("b")}
+	if n := NewLimiter(5).weight(cmds); n != 2 {
+		t.Errorf("weight() = %d, want one per command", n)
+	}
+	l := NewLimiter(5)
+	l.Weight = func(cmd *exec.Cmd) int64 { return 3 }
+	if n := l.weight(cmds); n != 5 {
+		t.Errorf("weight() = %d, want the maximum", n)
+	}
+}
+
+func TestRunnerLimiter(t *testing.T) {
+	r := &Runner{Limiter: NewLimiter(1)}
+	if err := r.Limiter.acquire(context.Background(), 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The execution isn't started while the Limiter is full.
+	cmd := exec.Command("true")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.Exec(ctx, cmd); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exec() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if cmd.Process != nil {
+		t.Error("command started while the Limiter was full")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		r.Limiter.release(1)
+	}()
+	res, err := r.Exec(context.Background(), exec.Command("true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.QueueWait <= 0 {
+		t.Errorf("QueueWait = %v, want the time spent queued", res.QueueWait)
+	}
+	if r.Limiter.used != 0 {
+		t.Errorf("%d units used after the execution, want 0", r.Limiter.used)
+	}
+}
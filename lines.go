@@ -0,0 +1,127 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// lineWriter is an io.Writer that splits its input into lines, without the
+// trailing newline, and passes each complete line to fn.  A trailing partial
+// line is held until more data is written or the writer is flushed.
+type lineWriter struct {
+	mu    sync.Mutex
+	fn    func(line []byte)
+	buf   []byte
+	delim byte
+}
+
+func newLineWriter(fn func(line []byte)) *lineWriter {
+	return &lineWriter{fn: fn, delim: '\n'}
+}
+
+// newRecordWriter returns a lineWriter splitting its input into records
+// terminated by delim, e.g. NUL for `find -print0`.
+func newRecordWriter(delim byte, fn func(record []byte)) *lineWriter {
+	return &lineWriter{fn: fn, delim: delim}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	for {
+		i := bytes.IndexByte(p, w.delim)
+		if i < 0 {
+			break
+		}
+		if len(w.buf) > 0 {
+			w.buf = append(w.buf, p[:i]...)
+			w.fn(w.buf)
+			w.buf = w.buf[:0]
+		} else {
+			w.fn(p[:i])
+		}
+		p = p[i+1:]
+	}
+	w.buf = append(w.buf, p...)
+	return n, nil
+}
+
+// flush passes any trailing partial line to fn.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.fn(w.buf)
+		w.buf = w.buf[:0]
+	}
+}
+
+// lineReader is an io.Reader that reads lines, terminated by delim, from a
+// channel.
+type lineReader struct {
+	ctx     context.Context
+	ch      <-chan string
+	delim   byte
+	pending []byte
+}
+
+// WriteLines returns a stdin source, e.g. for WithStdin, that writes each
+// string received from ch to the command as a line, appending a newline if
+// it lacks one.  Lines are received only as the command consumes its input,
+// so an unbuffered ch blocks the producer until the command is ready for
+// more, and each line is written, i.e. flushed, to the command as soon as
+// it's received.  The command's stdin is closed once ch is closed, or ends
+// with ctx's error, failing the execution, once ctx is done.
+func WriteLines(ctx context.Context, ch <-chan string) io.Reader {
+	return WriteRecords(ctx, ch, '\n')
+}
+
+// WriteRecords is like WriteLines, but terminates each string with delim,
+// e.g. NUL for commands following the -0 convention like `xargs -0`, so
+// that file names containing newlines survive.
+func WriteRecords(ctx context.Context, ch <-chan string, delim byte) io.Reader {
+	return &lineReader{ctx: ctx, ch: ch, delim: delim}
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		select {
+		case line, ok := <-r.ch:
+			if !ok {
+				return 0, io.EOF
+			}
+			r.pending = append(r.pending[:0], line...)
+			if len(line) == 0 || line[len(line)-1] != r.delim {
+				r.pending = append(r.pending, r.delim)
+			}
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Records splits data, e.g. the captured output of `find -print0`, into
+// records terminated by delim.  A trailing unterminated record is included,
+// an empty one isn't.
+func Records(data []byte, delim byte) []string {
+	var records []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, delim)
+		if i < 0 {
+			records = append(records, string(data))
+			break
+		}
+		records = append(records, string(data[:i]))
+		data = data[i+1:]
+	}
+	return records
+}
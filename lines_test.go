@@ -0,0 +1,65 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestRecords(t *testing.T) {
+	for data, want := range map[string][]string{
+		"":             nil,
+		"a\x00":        {"a"},
+		"a\nb\x00\x00": {"a\nb", ""},
+		"a\x00b":       {"a", "b"},
+	} {
+		if got := Records([]byte(data), 0); !reflect.DeepEqual(got, want) {
+			t.Errorf("Records(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
+
+func TestWriteRecords(t *testing.T) {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for _, name := range []string{"a b", "c\nd", "e\x00"} {
+			ch <- name
+		}
+	}()
+
+	// Each string is a single argument to `xargs -0`.
+	out, err := ExecO(exec.Command("xargs", "-0", "printf", "[%s]"), WriteRecords(context.Background(), ch, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "[a b][c\nd][e]" {
+		t.Errorf("output = %q, want one argument per record", out)
+	}
+}
+
+func TestReadRecord(t *testing.T) {
+	c, err := StartCoprocess(exec.Command("cat"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if resp, err := c.Do([]byte("a\nb\x00"), ReadRecord(0)); err != nil || string(resp) != "a\nb" {
+		t.Errorf("Do = %q, %v, want the record", resp, err)
+	}
+}
+
+func TestSamplerNUL(t *testing.T) {
+	var out bytes.Buffer
+	sm := NewSampler(&out, Sampling{Every: 2, NUL: true})
+	sm.Write([]byte("a\nb\x00c\x00d\x00e"))
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a\nb\x00d\x00" {
+		t.Errorf("output = %q, want every other record", out.String())
+	}
+}
@@ -0,0 +1,125 @@
+package pipes
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// StdinFeed describes how the first command's stdin was fed, see
+// WithMmapStdin.
+type StdinFeed string
+
+const (
+	// StdinDirect means the command read a file passed as its stdin
+	// itself.
+	StdinDirect StdinFeed = "direct"
+	// StdinMmap means a file was mapped into memory and written to the
+	// command via a pipe in large chunks.
+	StdinMmap StdinFeed = "mmap"
+	// StdinCopy means a reader other than a file was copied to the
+	// command via a pipe.
+	StdinCopy StdinFeed = "copy"
+)
+
+// DefaultMmapChunk is the size of the writes made by WithMmapStdin by
+// default.
+const DefaultMmapChunk = 1 << 20
+
+// WithMmapStdin maps stdin into memory, if it's a regular file, and writes
+// it to the first command via a pipe in chunks of chunk bytes,
+// DefaultMmapChunk if chunk is zero, rather than letting the command read
+// the file with its own, typically small, buffered reads.  Whether it
+// helps depends on the command, so the choice is reported by
+// Result.StdinFeed for analysis; stdin is passed directly if it can't be
+// mapped, e.g. on platforms without mmap.  The file must not be truncated
+// while it's fed.
+func WithMmapStdin(chunk int) Option {
+	if chunk <= 0 {
+		chunk = DefaultMmapChunk
+	}
+	return func(c *config) {
+		var feed StdinFeed
+		var data []byte
+		var pr, pw *os.File
+		var wg sync.WaitGroup
+
+		c.onSetup(func(c *config) error {
+			f, ok := c.stdin.(*os.File)
+			if !ok {
+				if c.stdin != nil {
+					feed = StdinCopy
+				}
+				return nil
+			}
+			feed = StdinDirect
+
+			info, err := f.Stat()
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			pos, err := f.Seek(0, io.SeekCurrent)
+			if err != nil || pos >= info.Size() {
+				return nil
+			}
+			if data, err = mmapFile(f, info.Size()); err != nil {
+				return nil
+			}
+			if pr, pw, err = os.Pipe(); err != nil {
+				munmap(data)
+				data = nil
+				return err
+			}
+
+			feed = StdinMmap
+			remaining := data[pos:]
+			c.stdin = pr
+			c.onStart(func(cmd *exec.Cmd, start func() error) error {
+				err := start()
+				pr.Close()
+				if err != nil {
+					return err
+				}
+				// Leave the file where the command would have.
+				f.Seek(0, io.SeekEnd)
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer pw.Close()
+
+					// The command exiting before reading all of
+					// its stdin isn't an error, as in a pipeline.
+					for len(remaining) > 0 {
+						n := chunk
+						if n > len(remaining) {
+							n = len(remaining)
+						}
+						if _, err := pw.Write(remaining[:n]); err != nil {
+							return
+						}
+						remaining = remaining[n:]
+					}
+				}()
+				return nil
+			}, []int{0})
+			return nil
+		})
+
+		c.onRelease(func() {
+			if data == nil {
+				return
+			}
+			// Fail the writes if the command was never started.
+			pr.Close()
+			wg.Wait()
+			pw.Close()
+			munmap(data)
+		})
+
+		c.onResult(func(res *Result) {
+			res.StdinFeed = feed
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package pipes
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile maps f into memory, which isn't supported on this platform.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap not supported on this platform")
+}
+
+func munmap(b []byte) error {
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package pipes
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of f into memory, read-only.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	if int64(int(size)) != size {
+		return nil, syscall.EFBIG
+	}
+	// Avoid f.Fd, which would switch f to blocking mode.
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	var merr error
+	if err = rc.Control(func(fd uintptr) {
+		b, merr = syscall.Mmap(int(fd), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	}); err != nil {
+		return nil, err
+	}
+	if merr != nil {
+		return nil, os.NewSyscallError("mmap", merr)
+	}
+	return b, nil
+}
+
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
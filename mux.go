@@ -0,0 +1,140 @@
+package pipes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Streams of a Frame.
+const (
+	FrameStdout = 1
+	FrameStderr = 2
+)
+
+// frameHeaderSize is the size of a frame's header: the stream, a reserved
+// byte, the stage as a big endian uint16, the time as big endian Unix
+// nanoseconds and the length of the data as a big endian uint32.
+const frameHeaderSize = 16
+
+// Frame is a chunk of output from a single stage of a pipeline, see WithMux.
+type Frame struct {
+	// Stream is FrameStdout or FrameStderr.
+	Stream int
+	Stage  int
+	Time   time.Time
+	Data   []byte
+}
+
+// mux writes frames to a single writer.
+type mux struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (m *mux) writeFrame(stream int, stage int, p []byte) error {
+	frame := make([]byte, frameHeaderSize+len(p))
+	frame[0] = byte(stream)
+	binary.BigEndian.PutUint16(frame[2:], uint16(stage))
+	binary.BigEndian.PutUint64(frame[4:], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint32(frame[12:], uint32(len(p)))
+	copy(frame[frameHeaderSize:], p)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.w.Write(frame)
+	return err
+}
+
+// muxWriter writes its input as frames of a stream of a stage.
+type muxWriter struct {
+	m      *mux
+	stream int
+	stage  int
+}
+
+func (w *muxWriter) Write(p []byte) (int, error) {
+	if err := w.m.writeFrame(w.stream, w.stage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WithMux additionally writes the output from the last command and each
+// command's Stderr output to w as a single stream of frames, tagged with
+// the stage that wrote them and when, like Docker's multiplexed attach
+// stream, e.g. to ship all of a pipeline's output over one connection.
+// Use ReadFrame or Demux to reconstruct the output.  Frames are written
+// atomically, so w may be shared by concurrent executions.
+func WithMux(w io.Writer) Option {
+	return func(c *config) {
+		m := &mux{w: w}
+		c.onSetup(func(c *config) error {
+			c.stdout = teeWriter(c.stdout, &muxWriter{m, FrameStdout, len(c.cmds) - 1})
+			return nil
+		})
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			cmd.Stderr = teeWriter(cmd.Stderr, &muxWriter{m, FrameStderr, stageIndex(c.cmds, cmd)})
+			return start()
+		}, nil)
+	}
+}
+
+// ReadFrame reads the next frame written by WithMux from r.  Returns io.EOF
+// at the end of the stream.
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated frame header")
+		}
+		return nil, err
+	}
+
+	f := &Frame{
+		Stream: int(header[0]),
+		Stage:  int(binary.BigEndian.Uint16(header[2:])),
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(header[4:]))),
+	}
+	if f.Stream != FrameStdout && f.Stream != FrameStderr {
+		return nil, fmt.Errorf("invalid frame stream %d", f.Stream)
+	}
+	f.Data = make([]byte, binary.BigEndian.Uint32(header[12:]))
+	if _, err := io.ReadFull(r, f.Data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated frame")
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Demux reads frames written by WithMux from r until the end of the stream,
+// writing stdout frames to stdout and stderr frames to stderr, either of
+// which may be nil to discard the stream.
+func Demux(r io.Reader, stdout io.Writer, stderr io.Writer) error {
+	for {
+		f, err := ReadFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		w := stdout
+		if f.Stream == FrameStderr {
+			w = stderr
+		}
+		if w == nil {
+			continue
+		}
+		if _, err = w.Write(f.Data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithMux(t *testing.T) {
+	var stream bytes.Buffer
+	cmds := []*exec.Cmd{
+		exec.Command("sh", "-c", "echo e0 >&2; echo out"),
+		exec.Command("sh", "-c", "cat; echo e1 >&2"),
+	}
+	start := time.Now()
+	if _, err := (&Runner{}).ExecPipeline(context.Background(), cmds, WithMux(&stream)); err != nil {
+		t.Fatal(err)
+	}
+	data := stream.Bytes()
+
+	// Each frame is tagged with the stage and stream that wrote it.
+	got := make(map[string]string)
+	r := bytes.NewReader(data)
+	for {
+		f, err := ReadFrame(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if f.Time.Before(start) || f.Time.After(time.Now()) {
+			t.Errorf("frame time %s outside the execution", f.Time)
+		}
+		got[fmt.Sprintf("%d:%d", f.Stage, f.Stream)] += string(f.Data)
+	}
+	want := map[string]string{"0:2": "e0\n", "1:1": "out\n", "1:2": "e1\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := Demux(bytes.NewReader(data), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out\n" || !strings.Contains(stderr.String(), "e0\n") || !strings.Contains(stderr.String(), "e1\n") {
+		t.Errorf("Demux = %q, %q", stdout.String(), stderr.String())
+	}
+	if err := Demux(bytes.NewReader(data), nil, nil); err != nil {
+		t.Errorf("Demux discarding the streams: %v", err)
+	}
+
+	// Truncated and corrupt streams are rejected.
+	if err := Demux(bytes.NewReader(data[:len(data)-1]), nil, nil); err == nil || err.Error() != "truncated frame" {
+		t.Errorf("Demux of truncated frame error = %v", err)
+	}
+	if err := Demux(bytes.NewReader(data[:frameHeaderSize-1]), nil, nil); err == nil || err.Error() != "truncated frame header" {
+		t.Errorf("Demux of truncated header error = %v", err)
+	}
+	corrupt := append([]byte{3}, data[1:]...)
+	if err := Demux(bytes.NewReader(corrupt), nil, nil); err == nil {
+		t.Error("no error for invalid stream")
+	}
+}
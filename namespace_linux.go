@@ -0,0 +1,23 @@
+package pipes
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// unshare runs cmd in new namespaces of the given kinds, e.g.
+// syscall.CLONE_NEWNET, and, unless this process is root, a new user
+// namespace mapping only this process's user and group, which lets an
+// unprivileged process create the others.
+func unshare(cmd *exec.Cmd, flags uintptr) {
+	attr := sysProcAttr(cmd)
+	attr.Cloneflags |= flags
+	if os.Geteuid() == 0 || attr.Cloneflags&syscall.CLONE_NEWUSER != 0 {
+		return
+	}
+	attr.Cloneflags |= syscall.CLONE_NEWUSER
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+}
@@ -0,0 +1,10 @@
+package pipes
+
+import (
+	"os/exec"
+)
+
+// startNoNetwork starts cmd in a sandbox denying all network access.
+func startNoNetwork(cmd *exec.Cmd, start func() error) error {
+	return startSandboxed(cmd, "(deny network*)", start)
+}
@@ -0,0 +1,13 @@
+package pipes
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startNoNetwork starts cmd in a new network namespace, which has only an
+// unconfigured loopback interface.
+func startNoNetwork(cmd *exec.Cmd, start func() error) error {
+	unshare(cmd, syscall.CLONE_NEWNET)
+	return start()
+}
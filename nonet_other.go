@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func startNoNetwork(cmd *exec.Cmd, start func() error) error {
+	return errors.New("network isolation not supported on this platform")
+}
@@ -0,0 +1,22 @@
+package pipes
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+const prSetNoNewPrivs = 38
+
+// startNoNewPrivs calls start on a thread with the no_new_privs attribute,
+// which is per-thread, can't be cleared and is inherited by the child, see
+// startOnThread.
+func startNoNewPrivs(cmd *exec.Cmd, start func() error) (func(), error) {
+	return startOnThread(cmd, func() error {
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("setting no_new_privs: %s", errno.Error())
+		}
+		return nil
+	}, start)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func startNoNewPrivs(cmd *exec.Cmd, start func() error) (func(), error) {
+	return nil, errors.New("no_new_privs not supported on this platform")
+}
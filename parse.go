@@ -0,0 +1,550 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// token is a word or, if op is non-empty, an operator of a command line.
+type token struct {
+	op   string
+	word string
+	// assign is set if word looks like a shell variable assignment.
+	assign bool
+}
+
+// tokenize splits a command line into words and the "|", "<", ">", ">>",
+// "2>", "2>&1", "&>", "&>>", "<<<", "<<", "&&", "||", ";", "&", "(" and
+// ")" operators, following POSIX shell quoting.  The word of a "<<" token holds
+// the body of its here-document.  Anything a shell would expand or interpret
+// otherwise is rejected rather than passed on literally.
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	var word strings.Builder
+	inWord, quoted, assign := false, false, false
+	// heredocs are waiting for their bodies, on the next line.
+	var heredocs []heredoc
+
+	end := func() {
+		if inWord {
+			tokens = append(tokens, token{word: word.String(), assign: assign})
+		}
+		word.Reset()
+		inWord, quoted, assign = false, false, false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 0:
+			return nil, fmt.Errorf("NUL byte at offset %d", i)
+		case c == '\n':
+			end()
+			// Here-documents start on the line after their operator.
+			for _, h := range heredocs {
+				body, next, err := readHeredoc(s, i+1, h)
+				if err != nil {
+					return nil, err
+				}
+				tokens[h.token].word, i = body, next-1
+			}
+			heredocs = nil
+		case c == ' ' || c == '\t':
+			end()
+		case c == '<' && strings.HasPrefix(s[i:], "<<<"):
+			end()
+			tokens = append(tokens, token{op: "<<<"})
+			i += 2
+		case c == '<' && strings.HasPrefix(s[i:], "<<"):
+			end()
+			h := heredoc{token: len(tokens), offset: i}
+			i += 2
+			if i < len(s) && s[i] == '-' {
+				h.stripTabs = true
+				i++
+			}
+			var err error
+			if h.delim, h.quoted, i, err = readDelim(s, i); err != nil {
+				return nil, err
+			}
+			i--
+			tokens = append(tokens, token{op: "<<"})
+			heredocs = append(heredocs, h)
+		case c == '|' && strings.HasPrefix(s[i:], "||"),
+			c == '&' && strings.HasPrefix(s[i:], "&&"):
+			end()
+			tokens = append(tokens, token{op: s[i : i+2]})
+			i++
+		case c == '|' || c == '<' || c == ';' || c == '(' || c == ')',
+			c == '&' && !strings.HasPrefix(s[i:], "&>"):
+			end()
+			tokens = append(tokens, token{op: string(c)})
+		case c == '>':
+			op := ">"
+			if inWord && !quoted && word.String() == "2" {
+				word.Reset()
+				inWord, op = false, "2>"
+			}
+			end()
+			if i+1 < len(s) && s[i+1] == '>' {
+				if op == "2>" {
+					return nil, fmt.Errorf("unsupported \"2>>\" at offset %d", i-1)
+				}
+				i++
+				op = ">>"
+			}
+			if op == "2>" && strings.HasPrefix(s[i+1:], "&") {
+				if !strings.HasPrefix(s[i+1:], "&1") || (i+3 < len(s) && strings.IndexByte(" \t\n|&;<>()", s[i+3]) < 0) {
+					return nil, fmt.Errorf("unsupported \"2>&\" at offset %d, only \"2>&1\" is", i-1)
+				}
+				i += 2
+				op = "2>&1"
+			}
+			tokens = append(tokens, token{op: op})
+		case c == '&' && strings.HasPrefix(s[i:], "&>"):
+			end()
+			op := "&>"
+			if strings.HasPrefix(s[i:], "&>>") {
+				op = "&>>"
+			}
+			tokens = append(tokens, token{op: op})
+			i += len(op) - 1
+		case c == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated single quote at offset %d", i)
+			}
+			word.WriteString(s[i+1 : i+1+j])
+			inWord, quoted = true, true
+			i += j + 1
+		case c == '"':
+			start := i
+			for i++; ; i++ {
+				if i == len(s) {
+					return nil, fmt.Errorf("unterminated double quote at offset %d", start)
+				}
+				c = s[i]
+				if c == '"' {
+					break
+				}
+				if c == 0 {
+					return nil, fmt.Errorf("NUL byte at offset %d", i)
+				}
+				if c == '$' || c == '`' {
+					return nil, fmt.Errorf("unsupported %q at offset %d, escape it", c, i)
+				}
+				if c == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					if i++; s[i] == '\n' {
+						continue
+					}
+					c = s[i]
+				}
+				word.WriteByte(c)
+			}
+			inWord, quoted = true, true
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			// A backslash-newline is a line continuation.
+			if i++; s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord, quoted = true, true
+			}
+		case strings.IndexByte("$`*?[]{}!", c) >= 0,
+			!inWord && (c == '#' || c == '~'):
+			return nil, fmt.Errorf("unsupported %q at offset %d, quote it", c, i)
+		default:
+			if c == '=' && !quoted && !assign && isEnvKey(word.String()) {
+				assign = true
+			}
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	end()
+	if len(heredocs) > 0 {
+		return nil, fmt.Errorf("unterminated here-document at offset %d", heredocs[0].offset)
+	}
+	return tokens, nil
+}
+
+// heredoc is a here-document whose body is yet to be read.
+type heredoc struct {
+	// token is the index of the here-document's token.
+	token  int
+	offset int
+	delim  string
+	// quoted is set if any part of the delimiter is quoted, in which case
+	// the body is taken literally.
+	quoted bool
+	// stripTabs is set for "<<-", which strips leading tabs.
+	stripTabs bool
+}
+
+// readDelim reads the delimiter of a here-document from s at offset i,
+// removing any quotes.  Returns the offset following the delimiter.
+func readDelim(s string, i int) (delim string, quoted bool, next int, err error) {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	start := i
+	var sb strings.Builder
+	for ; i < len(s) && strings.IndexByte(" \t\n|<>&;()", s[i]) < 0; i++ {
+		switch c := s[i]; c {
+		case '\'', '"':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return "", false, 0, fmt.Errorf("unterminated quote in here-document delimiter at offset %d", i)
+			}
+			sb.WriteString(s[i+1 : i+1+j])
+			i, quoted = i+1+j, true
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			}
+			quoted = true
+		case '$', '`':
+			return "", false, 0, fmt.Errorf("unsupported %q in here-document delimiter at offset %d", c, i)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if sb.Len() == 0 {
+		return "", false, 0, fmt.Errorf("missing here-document delimiter at offset %d", start)
+	}
+	return sb.String(), quoted, i, nil
+}
+
+// readHeredoc reads the body of h from s, starting at offset i, up to the
+// line holding only its delimiter.  Returns the body and the offset
+// following the delimiter's line.
+func readHeredoc(s string, i int, h heredoc) (string, int, error) {
+	var body strings.Builder
+	for i < len(s) {
+		line := s[i:]
+		next := len(s)
+		if j := strings.IndexByte(line, '\n'); j >= 0 {
+			line, next = line[:j], i+j+1
+		}
+		if h.stripTabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == h.delim {
+			if h.quoted {
+				return body.String(), next, nil
+			}
+			text, err := unescapeHeredoc(body.String(), h)
+			return text, next, err
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+		i = next
+	}
+	return "", 0, fmt.Errorf("unterminated here-document at offset %d, missing %q", h.offset, h.delim)
+}
+
+// unescapeHeredoc processes the backslashes in the body of a here-document
+// with an unquoted delimiter, in which a shell would expand "$" and "`",
+// which are rejected.
+func unescapeHeredoc(body string, h heredoc) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '$' || c == '`':
+			return "", fmt.Errorf("unsupported %q in here-document at offset %d, quote the delimiter %q", c, h.offset, h.delim)
+		case c == '\\' && i+1 < len(body) && strings.IndexByte("$`\\\n", body[i+1]) >= 0:
+			if i++; body[i] == '\n' {
+				continue
+			}
+			c = body[i]
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String(), nil
+}
+
+// Split splits s into words as a POSIX shell would, honoring single quotes,
+// double quotes and backslash escapes, such that Split(Quote(args...))
+// returns args.  Returns an error if s contains anything that a shell would
+// interpret rather than pass on literally, e.g. operators, variable
+// references, globs or unterminated quotes.  Split does no I/O and
+// doesn't panic, whatever the input, so it's a suitable fuzzing target.
+func Split(s string) ([]string, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		if t.op != "" {
+			return nil, fmt.Errorf("unsupported %q", t.op)
+		}
+		words[i] = t.word
+	}
+	return words, nil
+}
+
+// Parse parses a pipeline from a shell command line such as
+//
+//	grep -v '^#' < in.txt | sort -u > out.txt
+//
+// with the quoting rules of Split.  Stages are separated by "|".  The first
+// stage may redirect its stdin with "<", or feed it a here-string with "<<<"
+// or a here-document with "<<", and the last its stdout with ">" or ">>".
+// Here-documents with an unquoted delimiter may escape "$", "`" and "\\"
+// with a backslash but may not use expansions.  "2>" redirects the Stderr
+// output of every command, unlike a shell, and "2>&1" at the end of the last
+// command merges it into the pipeline's output, as does "&>" or "&>>" in
+// place of ">" or ">>".  A stage may be a Group of pipelines separated by
+// "&&", "||", ";" or "&" in parentheses, e.g. "(make && make test) | tail",
+// as may the whole command line, without them.  Variable assignments, e.g.
+// "LC_ALL=C sort", aren't supported.  For any Pipeline p without
+// environments or working directories, Parse(p.String()) returns the same
+// commands, groups and redirections, provided any Input ends with a
+// newline.
+func Parse(s string) (*Pipeline, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &parser{tokens: tokens}
+	g, err := ps.group()
+	if err != nil {
+		return nil, err
+	}
+	if ps.i < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q", tokens[ps.i].op)
+	}
+	if len(g.Pipelines) == 1 && len(g.Ops) == 0 {
+		return g.Pipelines[0], nil
+	}
+	return &Pipeline{Cmds: []*exec.Cmd{nil}, Groups: []*Group{g}}, nil
+}
+
+// parser parses tokens from the token at index i on.
+type parser struct {
+	tokens []token
+	i      int
+}
+
+// group parses pipelines separated by "&&", "||", ";" or "&", up to a ")"
+// or the end.
+func (ps *parser) group() (*Group, error) {
+	g := &Group{}
+	for {
+		p, err := ps.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		g.Pipelines = append(g.Pipelines, p)
+		if ps.i == len(ps.tokens) || ps.tokens[ps.i].op == ")" {
+			return g, nil
+		}
+
+		op := ps.tokens[ps.i].op
+		ps.i++
+		end := ps.i == len(ps.tokens) || ps.tokens[ps.i].op == ")"
+		// Allow a trailing ";", as a shell does.
+		if op == ";" && end {
+			return g, nil
+		}
+		g.Ops = append(g.Ops, op)
+		if op == "&" && end {
+			return g, nil
+		}
+	}
+}
+
+// pipeline parses a pipeline, up to a "&&", "||", ";", "&", ")" or the end.
+func (ps *parser) pipeline() (*Pipeline, error) {
+	p := &Pipeline{}
+	var args []string
+	// group is the current stage's group, if any.
+	var group *Group
+	var groups []*Group
+	grouped := false
+	stage := func() error {
+		switch {
+		case group != nil:
+			p.Cmds, groups = append(p.Cmds, nil), append(groups, group)
+			grouped = true
+		case len(args) == 0:
+			return fmt.Errorf("empty command in pipeline")
+		default:
+			p.Cmds, groups = append(p.Cmds, exec.Command(args[0], args[1:]...)), append(groups, nil)
+		}
+		args, group = nil, nil
+		return nil
+	}
+
+	var err error
+	for ; ps.i < len(ps.tokens); ps.i++ {
+		t := ps.tokens[ps.i]
+		switch t.op {
+		case "":
+			if group != nil {
+				return nil, fmt.Errorf("unexpected %q after \")\"", t.word)
+			}
+			if len(args) == 0 && t.assign {
+				return nil, fmt.Errorf("unsupported variable assignment %q", t.word)
+			}
+			args = append(args, t.word)
+			continue
+		case "|":
+			if p.Stdout != "" {
+				return nil, fmt.Errorf("stdout redirected before \"|\"")
+			}
+			if p.MergeStderr {
+				return nil, fmt.Errorf("unsupported \"2>&1\" before \"|\"")
+			}
+			if err = stage(); err != nil {
+				return nil, err
+			}
+			continue
+		case "&&", "||", ";", "&", ")":
+			if err = stage(); err != nil {
+				return nil, err
+			}
+			if grouped {
+				p.Groups = groups
+			}
+			return p, nil
+		case "(":
+			if len(args) > 0 || group != nil {
+				return nil, fmt.Errorf("unexpected \"(\"")
+			}
+			ps.i++
+			if group, err = ps.group(); err != nil {
+				return nil, err
+			}
+			if ps.i == len(ps.tokens) {
+				return nil, fmt.Errorf("unterminated \"(\"")
+			}
+			continue
+		case "<<":
+			if err = setInput(p, t.word); err != nil {
+				return nil, err
+			}
+			continue
+		case "2>&1":
+			if p.Stderr != "" || p.MergeStderr {
+				return nil, errStderrRedirect
+			}
+			p.MergeStderr = true
+			continue
+		}
+
+		if ps.i+1 == len(ps.tokens) || ps.tokens[ps.i+1].op != "" {
+			return nil, fmt.Errorf("missing file name after %q", t.op)
+		}
+		ps.i++
+		name := ps.tokens[ps.i].word
+		if name == "" && t.op != "<<<" {
+			return nil, fmt.Errorf("empty file name after %q", t.op)
+		}
+
+		switch t.op {
+		case "<":
+			if len(p.Cmds) > 0 || p.Stdin != "" || p.Input != "" {
+				return nil, errStdinRedirect
+			}
+			p.Stdin = name
+		case "<<<":
+			if err = setInput(p, name+"\n"); err != nil {
+				return nil, err
+			}
+		case ">", ">>", "&>", "&>>":
+			if p.Stdout != "" {
+				return nil, fmt.Errorf("stdout redirected more than once")
+			}
+			if p.MergeStderr {
+				// A shell would redirect stderr to the previous stdout.
+				return nil, fmt.Errorf("unsupported \"2>&1\" before %q, move it after", t.op)
+			}
+			p.Stdout, p.Append = name, t.op == ">>" || t.op == "&>>"
+			if t.op[0] == '&' {
+				if p.Stderr != "" {
+					return nil, errStderrRedirect
+				}
+				p.MergeStderr = true
+			}
+		case "2>":
+			if p.Stderr != "" || p.MergeStderr {
+				return nil, errStderrRedirect
+			}
+			p.Stderr = name
+		}
+	}
+	if err = stage(); err != nil {
+		return nil, err
+	}
+	if grouped {
+		p.Groups = groups
+	}
+	return p, nil
+}
+
+var (
+	errStdinRedirect  = errors.New("stdin redirected other than once in the first command")
+	errStderrRedirect = errors.New("stderr redirected more than once")
+)
+
+// setInput sets the input of p, which is being parsed, from a here-document
+// or here-string.
+func setInput(p *Pipeline, input string) error {
+	if len(p.Cmds) > 0 || p.Stdin != "" || p.Input != "" {
+		return errStdinRedirect
+	}
+	p.Input = input
+	return nil
+}
+
+// heredocDelim returns a delimiter for a here-document with body that
+// doesn't occur as a line of body.
+func heredocDelim(body string) string {
+	delim := "EOF"
+	for i := 1; strings.HasPrefix(body, delim+"\n") || strings.Contains(body, "\n"+delim+"\n"); i++ {
+		delim = fmt.Sprintf("EOF%d", i)
+	}
+	return delim
+}
+
+// inputRedirect renders input as a here-string if it's a single line, or
+// else as a here-document, returning the redirection and the text to follow
+// the command line.  An input without a trailing newline gets one.
+func inputRedirect(input string) (redirect, body string) {
+	if !strings.HasSuffix(input, "\n") {
+		input += "\n"
+	}
+	if strings.IndexByte(input, '\n') == len(input)-1 {
+		return " <<< " + quote(input[:len(input)-1]), ""
+	}
+	delim := heredocDelim(input)
+	return " <<'" + delim + "'", "\n" + input + delim
+}
+
+// String renders the pipeline's commands, groups and redirections as a
+// command line that Parse, or a POSIX shell, parses back into the same
+// pipeline.  Unlike BashScript, commands are named by their arguments
+// rather than their resolved paths, and environments and working
+// directories are omitted.
+func (p *Pipeline) String() string {
+	line, body := p.render(argsScript, false)
+	return line + body
+}
+
+// argsScript renders cmd's arguments as a shell command.
+func argsScript(cmd *exec.Cmd) string {
+	script := Quote(cmd.Args...)
+	// Quote the command name if it would be taken for an assignment.
+	if len(cmd.Args) > 0 && isShellSafe(cmd.Args[0]) && strings.IndexByte(cmd.Args[0], '=') >= 0 {
+		script = "'" + cmd.Args[0] + "'" + script[len(cmd.Args[0]):]
+	}
+	return script
+}
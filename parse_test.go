@@ -0,0 +1,199 @@
+package pipes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pipelineShape returns the commands, groups and redirections of p, which
+// Parse(p.String()) preserves, in a form that can be compared.
+func pipelineShape(p *Pipeline) interface{} {
+	type stage struct {
+		Args  []string
+		Group []interface{}
+		Ops   []string
+	}
+	var stages []stage
+	for i, cmd := range p.Cmds {
+		if i < len(p.Groups) && p.Groups[i] != nil {
+			g := p.Groups[i]
+			s := stage{Ops: g.Ops}
+			for _, gp := range g.Pipelines {
+				s.Group = append(s.Group, pipelineShape(gp))
+			}
+			stages = append(stages, s)
+			continue
+		}
+		stages = append(stages, stage{Args: cmd.Args})
+	}
+	return struct {
+		Stages               []stage
+		Stdin, Input, Stdout string
+		Append, MergeStderr  bool
+		Stderr               string
+	}{stages, p.Stdin, p.Input, p.Stdout, p.Append, p.MergeStderr, p.Stderr}
+}
+
+// checkRoundTrip fails t unless p.String() parses back to p.
+func checkRoundTrip(t *testing.T, p *Pipeline) {
+	t.Helper()
+	s := p.String()
+	q, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", s, err)
+	}
+	if got, want := pipelineShape(q), pipelineShape(p); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Parse(%q) = %+v, want %+v", s, got, want)
+	}
+}
+
+func TestParseMergeStderr(t *testing.T) {
+	for _, s := range []string{
+		"a 2>&1",
+		"a | b 2>&1",
+		"(a 2>&1) | cat",
+		"(a 2>&1)|cat",
+		"a 2>&1; b",
+		"a 2>&1;b",
+		"a 2>&1&& b",
+		"a 2>&1||b",
+		"a 2>&1 &",
+		"a 2>&1&",
+		"0&0&>0",
+	} {
+		p, err := Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", s, err)
+			continue
+		}
+		checkRoundTrip(t, p)
+	}
+
+	// Only the last command may merge its Stderr output, and only into
+	// the output.
+	for _, s := range []string{"a 2>&1x", "a 2>&2", "a 2>&1 | b", "(a 2>&1)(b)"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
+
+func TestParseEmptyFileName(t *testing.T) {
+	for _, s := range []string{"a < ''", "a > ''", "a >> \"\"", "a 2> ''", "a &> ''"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+	p, err := Parse("cat <<< ''")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Input != "\n" {
+		t.Errorf("Input = %q, want a newline", p.Input)
+	}
+}
+
+// parseSeeds are command lines that Parse accepts.
+var parseSeeds = []string{
+	"true",
+	"grep -v '^#' < in.txt | sort -u > out.txt",
+	"echo 'it'\\''s' \"a b\" | tr a-z A-Z >> log",
+	"cat <<< hello | wc -c",
+	"cat <<'EOF'\nline 1\nline 2\nEOF\n",
+	"make 2> errors.txt",
+	"make &> all.txt",
+	"make &>> all.txt",
+	"(make && make test) | tail",
+	"(a || b; c) > out",
+	"a; b & c && d",
+	"(a & b > c 2>&1)",
+	"a | (b | (c; d)) | e",
+	"sleep 1 &",
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	for _, s := range parseSeeds {
+		p, err := Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", s, err)
+			continue
+		}
+		checkRoundTrip(t, p)
+	}
+}
+
+func FuzzSplit(f *testing.F) {
+	for _, s := range parseSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		words, err := Split(s)
+		if err != nil {
+			return
+		}
+		q := Quote(words...)
+		again, err := Split(q)
+		if err != nil {
+			t.Fatalf("Split(%q) error = %v", q, err)
+		}
+		if len(words) != 0 || len(again) != 0 {
+			if !reflect.DeepEqual(again, words) {
+				t.Fatalf("Split(%q) = %q, want %q", q, again, words)
+			}
+		}
+	})
+}
+
+func FuzzQuote(f *testing.F) {
+	f.Add("a", "b c")
+	f.Add("it's", "$HOME")
+	f.Add("", "#!\\n")
+	f.Fuzz(func(t *testing.T, a string, b string) {
+		q := Quote(a, b)
+		words, err := Split(q)
+		if err != nil {
+			// Arguments can't contain NUL bytes.
+			if strings.IndexByte(a+b, 0) >= 0 {
+				return
+			}
+			t.Fatalf("Split(%q) error = %v", q, err)
+		}
+		if want := []string{a, b}; !reflect.DeepEqual(words, want) {
+			t.Fatalf("Split(%q) = %q, want %q", q, words, want)
+		}
+	})
+}
+
+// unterminatedInput returns true if p or any pipeline nested in it has
+// Input that doesn't end with a newline, which Parse(p.String()) doesn't
+// preserve.
+func unterminatedInput(p *Pipeline) bool {
+	if p.Input != "" && !strings.HasSuffix(p.Input, "\n") {
+		return true
+	}
+	for _, g := range p.Groups {
+		if g == nil {
+			continue
+		}
+		for _, gp := range g.Pipelines {
+			if unterminatedInput(gp) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func FuzzParse(f *testing.F) {
+	for _, s := range parseSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := Parse(s)
+		if err != nil || unterminatedInput(p) {
+			return
+		}
+		checkRoundTrip(t, p)
+	})
+}
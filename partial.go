@@ -0,0 +1,60 @@
+package pipes
+
+import "sync"
+
+// headBuffer retains the first max bytes written to it, or everything if
+// max is zero, discarding the rest.
+type headBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keep := p
+	if h.max > 0 && len(h.buf)+len(keep) > h.max {
+		keep = keep[:h.max-len(h.buf)]
+		h.truncated = true
+	}
+	h.buf = append(h.buf, keep...)
+	return len(p), nil
+}
+
+// WithPartialOutput collects the first maxBytes bytes of the pipeline's
+// Stdout, or all of it if maxBytes is zero, in addition to writing it to
+// any writer configured for the execution, so that the output written
+// before a failure isn't lost, e.g. for log-scraping pipelines for which
+// partial data is still valuable.  If the execution fails, the collected
+// output is available via Result.PartialStdout, and Result.PartialTruncated
+// is set if it exceeded maxBytes.  Nothing is kept if the execution
+// succeeds.
+func WithPartialOutput(maxBytes int) Option {
+	return func(c *config) {
+		h := &headBuffer{max: maxBytes}
+		var failed bool
+
+		c.onSetup(func(c *config) error {
+			c.stdout = teeWriter(c.stdout, h)
+			return nil
+		})
+		c.onFinish(func(err error) error {
+			failed = err != nil
+			return err
+		})
+		c.onResult(func(res *Result) {
+			if !failed {
+				return
+			}
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			res.PartialStdout, res.PartialTruncated = h.buf, h.truncated
+			if res.PartialStdout == nil {
+				res.PartialStdout = []byte{}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package pipes
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PathCache caches the resolution of command names to executables by
+// exec.LookPath, see Runner.Command, so that hot loops don't search PATH
+// for every execution.  Cached resolutions, including failures, are
+// discarded when PATH changes and, if TTL is non-zero, once they're older
+// than TTL, e.g. to pick up newly installed executables.
+type PathCache struct {
+	TTL time.Duration
+	// Clock, if non-nil, is used instead of the real clock, e.g. by
+	// tests.
+	Clock Clock
+
+	mu      sync.Mutex
+	path    string
+	entries map[string]pathEntry
+	stats   PathCacheStats
+}
+
+type pathEntry struct {
+	path     string
+	err      error
+	resolved time.Time
+}
+
+// PathCacheStats counts a PathCache's lookups.
+type PathCacheStats struct {
+	// Hits and Misses count lookups answered from the cache and by
+	// searching PATH, respectively.
+	Hits   int64
+	Misses int64
+	// Invalidations counts the times the cache was cleared as PATH
+	// changed.
+	Invalidations int64
+	// Entries is the number of cached resolutions.
+	Entries int
+}
+
+// NewPathCache returns a PathCache whose resolutions expire after ttl, or
+// only when PATH changes if ttl is zero.
+func NewPathCache(ttl time.Duration) *PathCache {
+	return &PathCache{TTL: ttl}
+}
+
+// LookPath returns the result of exec.LookPath(name), from the cache if
+// possible.
+func (pc *PathCache) LookPath(name string) (string, error) {
+	path := os.Getenv("PATH")
+	now := clockOrReal(pc.Clock).Now()
+
+	pc.mu.Lock()
+	if pc.entries == nil || path != pc.path {
+		if pc.entries != nil {
+			pc.stats.Invalidations++
+		}
+		pc.path, pc.entries = path, make(map[string]pathEntry)
+	}
+	if e, ok := pc.entries[name]; ok && (pc.TTL <= 0 || now.Sub(e.resolved) < pc.TTL) {
+		pc.stats.Hits++
+		pc.mu.Unlock()
+		return e.path, e.err
+	}
+	pc.stats.Misses++
+	pc.mu.Unlock()
+
+	// Search without holding the lock, as it hits the filesystem.
+	lp, err := exec.LookPath(name)
+
+	pc.mu.Lock()
+	if path == pc.path {
+		pc.entries[name] = pathEntry{path: lp, err: err, resolved: now}
+	}
+	pc.mu.Unlock()
+	return lp, err
+}
+
+// Stats returns the cache's statistics so far.
+func (pc *PathCache) Stats() PathCacheStats {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	stats := pc.stats
+	stats.Entries = len(pc.entries)
+	return stats
+}
+
+// Command returns an exec.Cmd to execute the named program with the given
+// arguments, like exec.Command, resolving name via the Runner's Paths, if
+// any.
+func (r *Runner) Command(name string, args ...string) *exec.Cmd {
+	if r.Paths == nil || filepath.Base(name) != name {
+		return exec.Command(name, args...)
+	}
+
+	cmd := &exec.Cmd{Path: name, Args: append([]string{name}, args...)}
+	lp, err := r.Paths.LookPath(name)
+	if lp != "" {
+		cmd.Path = lp
+	}
+	if err != nil {
+		cmd.Err = err
+	}
+	return cmd
+}
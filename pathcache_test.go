@@ -0,0 +1,85 @@
+package pipes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTool writes an executable script printing out to dir/name.
+func writeTool(t *testing.T, dir string, name string, out string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho "+out+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPathCache(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	tool1 := writeTool(t, dir1, "tool", "1")
+	tool2 := writeTool(t, dir2, "tool", "2")
+	t.Setenv("PATH", dir1)
+
+	clock := &manualClock{now: time.Unix(0, 0)}
+	pc := NewPathCache(time.Minute)
+	pc.Clock = clock
+	lookPath := func(name string, want string) {
+		t.Helper()
+		if got, err := pc.LookPath(name); got != want || (err == nil) != (want != "") {
+			t.Errorf("LookPath(%s) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	lookPath("tool", tool1)
+	lookPath("tool", tool1)
+	lookPath("new", "")
+	lookPath("new", "")
+	if s := pc.Stats(); s != (PathCacheStats{Hits: 2, Misses: 2, Entries: 2}) {
+		t.Errorf("Stats() = %+v", s)
+	}
+
+	// Failures are cached too, until they expire.
+	newTool := writeTool(t, dir1, "new", "new")
+	lookPath("new", "")
+	clock.now = clock.now.Add(time.Minute)
+	lookPath("new", newTool)
+
+	// Changing PATH invalidates the cache.
+	t.Setenv("PATH", dir2+string(os.PathListSeparator)+dir1)
+	lookPath("tool", tool2)
+	if s := pc.Stats(); s != (PathCacheStats{Hits: 3, Misses: 4, Invalidations: 1, Entries: 1}) {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func TestRunnerCommand(t *testing.T) {
+	dir := t.TempDir()
+	tool := writeTool(t, dir, "tool", "cached")
+	t.Setenv("PATH", dir)
+
+	r := &Runner{Paths: NewPathCache(0)}
+	for i := 0; i < 2; i++ {
+		cmd := r.Command("tool", "arg")
+		if cmd.Path != tool || len(cmd.Args) != 2 || cmd.Args[0] != "tool" {
+			t.Errorf("Command = %s %q, want %s", cmd.Path, cmd.Args, tool)
+		}
+		if out, err := ExecO(cmd, nil); err != nil || string(out) != "cached\n" {
+			t.Errorf("ExecO = %q, %v", out, err)
+		}
+	}
+	if s := r.Paths.Stats(); s.Hits != 1 || s.Misses != 1 {
+		t.Errorf("Stats() = %+v, want the second lookup cached", s)
+	}
+
+	if err := Exec(r.Command("missing"), nil, nil, nil); err == nil {
+		t.Error("no error executing missing command")
+	}
+	// Paths aren't resolved via the cache.
+	if cmd := r.Command("./tool"); cmd.Path != "./tool" || r.Paths.Stats().Misses != 2 {
+		t.Errorf("Command(./tool) = %s, stats %+v", cmd.Path, r.Paths.Stats())
+	}
+}
@@ -0,0 +1,21 @@
+//go:build linux || freebsd
+
+package pipes
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startWithPdeathsig calls start with cmd's parent death signal set to sig,
+// which the kernel sends when the thread that started cmd exits.
+func startWithPdeathsig(cmd *exec.Cmd, sig os.Signal, start func() error) (func(), error) {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return nil, fmt.Errorf("unsupported signal %v", sig)
+	}
+	sysProcAttr(cmd).Pdeathsig = s
+	return func() {}, start()
+}
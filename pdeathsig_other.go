@@ -0,0 +1,13 @@
+//go:build !unix
+
+package pipes
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func startWithPdeathsig(cmd *exec.Cmd, sig os.Signal, start func() error) (func(), error) {
+	return nil, errors.New("parent death signals not supported on this platform")
+}
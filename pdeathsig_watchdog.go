@@ -0,0 +1,56 @@
+//go:build unix && !linux && !freebsd
+
+package pipes
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// watchdogScript waits for its stdin, the read end of a pipe whose write
+// end is held by this process, to be closed without first being written
+// to, i.e. for this process to die, and then signals the watched process.
+const watchdogScript = `if ! read -r _ <&3; then kill -$1 $2 2>/dev/null; fi`
+
+// startWithPdeathsig emulates a parent death signal on platforms without
+// one by starting cmd and a watchdog process that sends sig to cmd if this
+// process dies, which it detects when the kernel closes a pipe held by this
+// process.  release disarms the watchdog.
+func startWithPdeathsig(cmd *exec.Cmd, sig os.Signal, start func() error) (func(), error) {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return nil, fmt.Errorf("unsupported signal %v", sig)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err = start(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	// Run the watchdog in its own session so that it survives signals
+	// sent to this process's process group, e.g. by the terminal.
+	watchdog := exec.Command("/bin/sh", "-c", watchdogScript, "sh", strconv.Itoa(int(s)), strconv.Itoa(cmd.Process.Pid))
+	watchdog.ExtraFiles = []*os.File{r}
+	watchdog.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err = watchdog.Start(); err != nil {
+		w.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+
+	return func() {
+		w.Write([]byte("\n"))
+		w.Close()
+		watchdog.Wait()
+	}, nil
+}
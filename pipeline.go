@@ -0,0 +1,139 @@
+package pipes
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Pipeline describes a pipeline of commands along with the redirections of
+// its input and output.
+type Pipeline struct {
+	Cmds []*exec.Cmd
+	// Groups, if non-nil, holds a Group for each stage that runs one in
+	// place of a command, whose entry in Cmds is nil, or else nil, e.g.
+	// for "(make && make test) | tail", see Runner.ExecNested.
+	Groups []*Group
+
+	// Stdin, if non-empty, names the file from which the first command
+	// reads its stdin.
+	Stdin string
+	// Input, if non-empty, is fed to the first command's stdin, e.g. the
+	// body of a here-document or here-string.  It's exclusive with Stdin.
+	Input string
+	// Stdout, if non-empty, names the file to which the output from the
+	// last command is written, or appended to if Append is set.
+	Stdout string
+	Append bool
+	// Stderr, if non-empty, names the file to which all commands' Stderr
+	// output is written.
+	Stderr string
+	// MergeStderr, if set, writes all commands' Stderr output along with
+	// the output from the last command, like "2>&1".  It's exclusive with
+	// Stderr.
+	MergeStderr bool
+}
+
+// osFS opens files in the file system of the OS, like os.Open.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// redirectPath returns the path of the file name redirected to or from,
+// resolved against dir, if non-empty.
+func redirectPath(dir, name string) (string, error) {
+	if dir == "" {
+		return name, nil
+	}
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || clean == ".." ||
+		strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Redirection of %q outside %s", name, dir)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// Options returns the options implementing p's redirections, to execute p
+// with Runner.ExecPipeline, e.g.
+//
+//	opts, err := p.Options(dir)
+//	...
+//	res, err := r.ExecPipeline(ctx, p.Cmds, opts...)
+//
+// If dir is non-empty, file names are resolved against dir and must be
+// local to it, lexically, e.g. so that a pipeline parsed from a user's
+// command line can't write files elsewhere.  Files written are created
+// with permissions 0666, before the umask.  Stdout and Stderr naming the
+// same file are written like "2>&1", rather than clobbering each other.
+// Returns an error if a file is both read and written, which would be
+// truncated before it's read.
+func (p *Pipeline) Options(dir string) ([]Option, error) {
+	for _, g := range p.Groups {
+		if g != nil {
+			return nil, fmt.Errorf("Pipeline with groups, see ExecNested")
+		}
+	}
+	if p.Stdin != "" && p.Input != "" {
+		return nil, fmt.Errorf("Stdin %q and Input are exclusive", p.Stdin)
+	}
+	if p.Stderr != "" && p.MergeStderr {
+		return nil, fmt.Errorf("Stderr %q and MergeStderr are exclusive", p.Stderr)
+	}
+
+	var stdin, stdout, stderr string
+	var err error
+	for _, path := range []struct {
+		name string
+		path *string
+	}{{p.Stdin, &stdin}, {p.Stdout, &stdout}, {p.Stderr, &stderr}} {
+		if path.name == "" {
+			continue
+		}
+		if *path.path, err = redirectPath(dir, path.name); err != nil {
+			return nil, err
+		}
+	}
+
+	var opts []Option
+	if stdin != "" {
+		if sameFile(stdin, stdout) || sameFile(stdin, stderr) {
+			return nil, fmt.Errorf("Redirection reads and writes %q", p.Stdin)
+		}
+		opts = append(opts, WithStdinFile(osFS{}, stdin))
+	}
+	if p.Input != "" {
+		opts = append(opts, WithStdin(strings.NewReader(p.Input)))
+	}
+	if stdout != "" {
+		opts = append(opts, WithStdoutFile(stdout, 0666, p.Append))
+	}
+	switch {
+	case p.MergeStderr || (stderr != "" && sameFile(stdout, stderr)):
+		opts = append(opts, WithStderrToStdout())
+	case stderr != "":
+		opts = append(opts, WithStderrFile(stderr, 0666, false))
+	}
+	return opts, nil
+}
+
+// sameFile returns true if the paths a and b name the same file, lexically
+// or, if both exist, per os.SameFile.
+func sameFile(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	return err == nil && os.SameFile(fa, fb)
+}
@@ -2,6 +2,7 @@ package pipes
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,7 +16,7 @@ import (
 // containing the command that failed as well as the system error string.
 func Exec(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
 	if stdin != nil {
-		cmd.Stdin = stdin
+		cmd.Stdin = countPipedReader(stdin)
 	}
 	if stdout == nil {
 		stdout = ioutil.Discard
@@ -23,13 +24,14 @@ func Exec(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io.Writer) er
 	if stderr == nil {
 		stderr = ioutil.Discard
 	}
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+	cmd.Stdout = countPiped(stdout)
+	cmd.Stderr = countPiped(stderr)
 
-	err := cmd.Start()
+	err := forkTracked(cmd)
 	if err != nil {
 		return fmt.Errorf("%s %s", cmd.Path, err.Error())
 	}
+	defer untrack(cmd)
 
 	err = cmd.Wait()
 	if err != nil {
@@ -40,13 +42,13 @@ func Exec(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io.Writer) er
 
 // ExecE runs a single command together, optionally reading data from
 // stdin and writing the output to stdout.  Stdout is discarded if
-// stdout is nil.  Returns an error containing the command that failed,
+// stdout is nil.  Returns an *Error containing the command that failed,
 // the system error string and any information captured from Stderr.
 func ExecE(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer) error {
 	var stderr bytes.Buffer
 
 	if err := Exec(cmd, stdin, stdout, &stderr); err != nil {
-		return fmt.Errorf("%s - %s", err.Error(), stderr.String())
+		return &Error{Err: err, Stderr: stderr.Bytes()}
 	}
 	return nil
 }
@@ -84,6 +86,15 @@ func ExecStdout(cmd *exec.Cmd, stdout io.Writer) error {
 // are discarded if stdout or stderr are nil, respectively.  Returns an error
 // containing the command that failed as well as the system error string.
 func ExecPipeline(cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	return execPipeline(context.Background(), cmds, stdin, stdout, stderr, nil, nil)
+}
+
+// execPipeline implements ExecPipeline, additionally killing all commands
+// if ctx is done before the pipeline completes and failing with ErrDeadlock
+// if the pipeline's output is fed back as its input.  Each command is started by
+// start and waited for by wait, which are passed the command's index in the
+// pipeline, if non-nil.
+func execPipeline(ctx context.Context, cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io.Writer, start func(i int, cmd *exec.Cmd) error, wait func(i int, cmd *exec.Cmd) error) error {
 	var err error
 
 	// Require at least one command
@@ -91,10 +102,6 @@ func ExecPipeline(cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io
 		return fmt.Errorf("No commands provided to ExecPipeline")
 	}
 
-	// Connect the optional input to the first command's stdin if necessary
-	if stdin != nil {
-		cmds[0].Stdin = stdin
-	}
 	if stdout == nil {
 		stdout = ioutil.Discard
 	}
@@ -102,6 +109,17 @@ func ExecPipeline(cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io
 		stderr = ioutil.Discard
 	}
 
+	// Refuse configurations that would hang forever
+	if err = checkDeadlock(stdin, stdout, stderr); err != nil {
+		return fmt.Errorf("%s %w", cmds[0].Path, err)
+	}
+
+	// Connect the optional input to the first command's stdin if necessary
+	if stdin != nil {
+		cmds[0].Stdin = countPipedReader(stdin)
+	}
+	stdout, stderr = countPiped(stdout), countPiped(stderr)
+
 	last := len(cmds) - 1
 	for i, cmd := range cmds[:last] {
 		// Connect each command's stdin to the previous command's stdout
@@ -115,12 +133,28 @@ func ExecPipeline(cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io
 	// Connect the output and error for the last command
 	cmds[last].Stdout, cmds[last].Stderr = stdout, stderr
 
+	// Don't bother starting anything if the context is already done
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("%s %s", cmds[0].Path, err.Error())
+	}
+
 	// Start each command; defer a function to conditionally kill
 	// each started process if any process in the pipeline fails.
-	for _, cmd := range cmds {
-		if err = cmd.Start(); err != nil {
-			return fmt.Errorf("%s %s", cmd.Path, err.Error())
+	if start == nil {
+		start = func(i int, cmd *exec.Cmd) error {
+			return forkTracked(cmd)
+		}
+	}
+	if wait == nil {
+		wait = func(i int, cmd *exec.Cmd) error {
+			return cmd.Wait()
+		}
+	}
+	for i, cmd := range cmds {
+		if err = start(i, cmd); err != nil {
+			return fmt.Errorf("%s %w", cmd.Path, err)
 		}
+		defer untrack(cmd)
 
 		kill := cmd
 		defer func() {
@@ -131,9 +165,29 @@ func ExecPipeline(cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io
 		}()
 	}
 
+	// Kill all commands if the context is done before the pipeline
+	// completes, in which case the context's error is reported.
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			select {
+			case <-done:
+				for _, cmd := range cmds {
+					cmd.Process.Signal(syscall.SIGKILL)
+				}
+			case <-stop:
+			}
+		}()
+	}
+
 	// Wait for each command to complete
-	for _, cmd := range cmds {
-		if err = cmd.Wait(); err != nil {
+	for i, cmd := range cmds {
+		if err = wait(i, cmd); err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
 			return fmt.Errorf("%s %s", cmd.Path, err.Error())
 		}
 	}
@@ -145,13 +199,13 @@ func ExecPipeline(cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io
 // ExecPipelineE pipes several commands together, optionally reading data from
 // stdin for the first command and writing the output from the last command
 // to stdout.  Output from Stdout is discarded if stdout is nil.  Returns an
-// error containing the command that failed, the system error string, and any
+// *Error containing the command that failed, the system error string, and any
 // information captured from Stderr.
 func ExecPipelineE(cmds []*exec.Cmd, stdin io.Reader, stdout io.Writer) error {
 	var stderr bytes.Buffer
 
 	if err := ExecPipeline(cmds, stdin, stdout, &stderr); err != nil {
-		return fmt.Errorf("%s - %s", err.Error(), stderr.String())
+		return &Error{Err: err, Stderr: stderr.Bytes()}
 	}
 	return nil
 }
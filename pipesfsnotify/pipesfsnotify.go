@@ -0,0 +1,93 @@
+// Package pipesfsnotify adapts fsnotify to a pipes.ChangeSource, so that
+// Runner.Watch re-executes pipelines on file system events rather than by
+// polling.
+package pipesfsnotify
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Source is a pipes.ChangeSource backed by an fsnotify.Watcher.
+type Source struct {
+	w       *fsnotify.Watcher
+	changes chan string
+	done    chan struct{}
+}
+
+// New returns a Source watching the given files and directory trees.
+// Directories created in a watched tree are watched as well.
+func New(paths ...string) (*Source, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	s := &Source{w: w, changes: make(chan string, 64), done: make(chan struct{})}
+
+	for _, path := range paths {
+		if err = s.add(path); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	go s.run()
+	return s, nil
+}
+
+// add watches path and, if it's a directory, all directories below it, as
+// fsnotify doesn't watch recursively.
+func (s *Source) add(path string) error {
+	return filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == path || fi.IsDir() {
+			return s.w.Add(p)
+		}
+		return nil
+	})
+}
+
+func (s *Source) run() {
+	defer close(s.changes)
+
+	for {
+		select {
+		case ev, ok := <-s.w.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					s.add(ev.Name)
+				}
+			}
+			// Drop changes if the consumer is far behind, as a
+			// single change triggers a re-execution.
+			select {
+			case s.changes <- ev.Name:
+			default:
+			}
+		case _, ok := <-s.w.Errors:
+			if !ok {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Changes returns a channel that receives the paths of changed files and is
+// closed once the Source is closed.
+func (s *Source) Changes() <-chan string {
+	return s.changes
+}
+
+// Close stops watching.
+func (s *Source) Close() error {
+	close(s.done)
+	return s.w.Close()
+}
@@ -0,0 +1,301 @@
+// Package pipesgrpc provides a gRPC service for executing commands remotely,
+// streaming stdin to and Stdout/Stderr from the remote command, backed by a
+// pipes.Runner.  Messages are encoded as JSON via a codec registered by this
+// package, so no generated protobuf code is required; clients created by
+// NewClient select the codec automatically.
+package pipesgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/sean-jc/pipes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// chunkSize is the maximum amount of stdin sent in a single Request.
+const chunkSize = 32 << 10
+
+// Request is sent by the client.  The first Request of a stream describes
+// the command to execute, subsequent Requests carry its stdin.  The command's
+// stdin is closed when the client closes its side of the stream or sends a
+// Request with CloseStdin set.
+type Request struct {
+	Args       []string `json:"args,omitempty"`
+	Env        []string `json:"env,omitempty"`
+	Dir        string   `json:"dir,omitempty"`
+	Stdin      []byte   `json:"stdin,omitempty"`
+	CloseStdin bool     `json:"close_stdin,omitempty"`
+}
+
+// Response is sent by the server, carrying chunks of the command's Stdout
+// and Stderr.  The last Response of a stream has Exited set and holds the
+// command's exit code, and its error string if it failed.
+type Response struct {
+	Stdout   []byte `json:"stdout,omitempty"`
+	Stderr   []byte `json:"stderr,omitempty"`
+	Exited   bool   `json:"exited,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// jsonCodec encodes messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "pipes-json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// ExecServer is the interface implemented by the Exec service.
+type ExecServer interface {
+	Exec(stream grpc.ServerStream) error
+}
+
+// ServiceDesc describes the Exec service, which has a single bidirectional
+// streaming method, Exec.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pipes.Exec",
+	HandlerType: (*ExecServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Exec",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(ExecServer).Exec(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
+
+const execMethod = "/pipes.Exec/Exec"
+
+// Server implements the Exec service.
+type Server struct {
+	// Runner executes the requested commands.  The zero Runner is used if
+	// Runner is nil.
+	Runner *pipes.Runner
+
+	// Authorize is called with the first Request of each stream and must
+	// return nil for the command to be executed.  All requests are denied
+	// if Authorize is nil, as executing arbitrary commands on behalf of
+	// remote clients is rarely a good idea.
+	Authorize func(ctx context.Context, req *Request) error
+
+	// Env is the environment of every command, to which each Request's Env
+	// is added.  Commands don't inherit this process's environment, lest
+	// its secrets be exposed to remote clients.
+	Env []string
+}
+
+// Register registers the Exec service implemented by s with r.
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	r.RegisterService(&ServiceDesc, s)
+}
+
+// streamWriter sends everything written to it as Stdout or Stderr chunks.
+type streamWriter struct {
+	mu     *sync.Mutex
+	stream grpc.ServerStream
+	stderr bool
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	resp := &Response{Stdout: p}
+	if w.stderr {
+		resp = &Response{Stderr: p}
+	}
+	if err := w.stream.SendMsg(resp); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Exec executes the command described by the stream's first Request.
+func (s *Server) Exec(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+
+	var req Request
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	if len(req.Args) == 0 {
+		return status.Error(codes.InvalidArgument, "no command provided")
+	}
+	if s.Authorize == nil {
+		return status.Error(codes.PermissionDenied, "command execution is not authorized")
+	}
+	if err := s.Authorize(ctx, &req); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	cmd := exec.Command(req.Args[0], req.Args[1:]...)
+	cmd.Env = append(append([]string{}, s.Env...), req.Env...)
+	cmd.Dir = req.Dir
+
+	// Feed stdin from subsequent Requests until the client is done, via an
+	// OS pipe rather than an io.Pipe, so that waiting for the command
+	// doesn't wait for stdin the command never reads.
+	stdin, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	go func() {
+		in := req
+		for {
+			if _, err := stdinWriter.Write(in.Stdin); err != nil {
+				// The command exited.
+				stdinWriter.Close()
+				return
+			}
+			if in.CloseStdin {
+				stdinWriter.Close()
+				return
+			}
+
+			in = Request{}
+			if err := stream.RecvMsg(&in); err == io.EOF {
+				stdinWriter.Close()
+				return
+			} else if err != nil {
+				stdinWriter.Close()
+				return
+			}
+		}
+	}()
+
+	runner := s.Runner
+	if runner == nil {
+		runner = &pipes.Runner{}
+	}
+
+	var mu sync.Mutex
+	res, err := runner.Exec(ctx, cmd,
+		pipes.WithStdin(stdin),
+		pipes.WithStdout(&streamWriter{mu: &mu, stream: stream}),
+		pipes.WithStderr(&streamWriter{mu: &mu, stream: stream, stderr: true}))
+	// Fail further writes of stdin.
+	stdin.Close()
+
+	resp := &Response{Exited: true, ExitCode: -1}
+	if len(res.Stages) > 0 {
+		resp.ExitCode = res.Stages[0].ExitCode
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return stream.SendMsg(resp)
+}
+
+// Client is a client of the Exec service.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client for the Exec service available via cc.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// Exec executes the command described by req remotely, optionally reading
+// data from stdin and writing the command's output to stdout and its Stderr
+// output to stderr.  Stdout and Stderr are discarded if stdout or stderr are
+// nil, respectively.  stdin is no longer read once Exec returns, though a
+// read in progress can't be interrupted, and its data is discarded.
+// Returns the command's exit code, or -1 if it didn't exit, and an error
+// containing the command that failed as well as the remote error string.
+func (c *Client) Exec(ctx context.Context, req *Request, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	if len(req.Args) == 0 {
+		return -1, fmt.Errorf("No command provided to Exec")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.cc.NewStream(ctx, &ServiceDesc.Streams[0], execMethod,
+		grpc.CallContentSubtype(jsonCodec{}.Name()))
+	if err != nil {
+		return -1, fmt.Errorf("%s %s", req.Args[0], err.Error())
+	}
+
+	first := *req
+	first.Stdin, first.CloseStdin = nil, stdin == nil
+	if err = stream.SendMsg(&first); err != nil {
+		return -1, fmt.Errorf("%s %s", req.Args[0], err.Error())
+	}
+
+	// Stream stdin concurrently with receiving output, gRPC allows one
+	// goroutine to send while another receives.
+	if stdin != nil {
+		done := make(chan struct{})
+		defer close(done)
+		stopped := func() bool {
+			select {
+			case <-done:
+				return true
+			default:
+				return false
+			}
+		}
+		go func() {
+			buf := make([]byte, chunkSize)
+			for !stopped() {
+				n, err := stdin.Read(buf)
+				if stopped() {
+					return
+				}
+				if n > 0 {
+					// The message must not be modified once sent.
+					chunk := append([]byte(nil), buf[:n]...)
+					if stream.SendMsg(&Request{Stdin: chunk}) != nil {
+						return
+					}
+				}
+				if err != nil {
+					stream.CloseSend()
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		var resp Response
+		if err = stream.RecvMsg(&resp); err != nil {
+			return -1, fmt.Errorf("%s %s", req.Args[0], err.Error())
+		}
+		if len(resp.Stdout) > 0 && stdout != nil {
+			if _, err = stdout.Write(resp.Stdout); err != nil {
+				return -1, err
+			}
+		}
+		if len(resp.Stderr) > 0 && stderr != nil {
+			if _, err = stderr.Write(resp.Stderr); err != nil {
+				return -1, err
+			}
+		}
+		if resp.Exited {
+			if resp.Error != "" {
+				return resp.ExitCode, errors.New(resp.Error)
+			}
+			return resp.ExitCode, nil
+		}
+	}
+}
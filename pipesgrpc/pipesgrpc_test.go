@@ -0,0 +1,147 @@
+package pipesgrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves s over an in-memory connection.
+func newTestClient(t *testing.T, s *Server) *Client {
+	l := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	s.Register(srv)
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return NewClient(cc)
+}
+
+func allowAll(ctx context.Context, req *Request) error {
+	return nil
+}
+
+func TestExec(t *testing.T) {
+	c := newTestClient(t, &Server{Authorize: allowAll})
+
+	var stdout bytes.Buffer
+	code, err := c.Exec(context.Background(), &Request{Args: []string{"tr", "a-z", "A-Z"}}, strings.NewReader("hello\n"), &stdout, nil)
+	if err != nil || code != 0 {
+		t.Fatalf("Exec = %d, %v", code, err)
+	}
+	if got := stdout.String(); got != "HELLO\n" {
+		t.Errorf("stdout = %q, want %q", got, "HELLO\n")
+	}
+}
+
+func TestExecDenied(t *testing.T) {
+	c := newTestClient(t, &Server{})
+
+	if _, err := c.Exec(context.Background(), &Request{Args: []string{"true"}}, nil, nil, nil); err == nil {
+		t.Error("Exec without Authorize succeeded")
+	}
+}
+
+func TestExecEnv(t *testing.T) {
+	os.Setenv("PIPESGRPC_SECRET", "hunter2")
+	defer os.Unsetenv("PIPESGRPC_SECRET")
+	c := newTestClient(t, &Server{Authorize: allowAll, Env: []string{"BASE=1"}})
+
+	for _, test := range []struct {
+		env  []string
+		want string
+	}{
+		{nil, "/1/\n"},
+		{[]string{"REQ=2"}, "/1/2\n"},
+	} {
+		var stdout bytes.Buffer
+		req := &Request{Args: []string{"/bin/sh", "-c", "echo $PIPESGRPC_SECRET/$BASE/$REQ"}, Env: test.env}
+		if _, err := c.Exec(context.Background(), req, nil, &stdout, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := stdout.String(); got != test.want {
+			t.Errorf("Env %q: stdout = %q, want %q", test.env, got, test.want)
+		}
+	}
+}
+
+// blockingReader blocks reads until unblocked, counting them.
+type blockingReader struct {
+	reads   int32
+	unblock chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	atomic.AddInt32(&r.reads, 1)
+	<-r.unblock
+	return copy(p, "data\n"), nil
+}
+
+func TestExecUnreadStdin(t *testing.T) {
+	c := newTestClient(t, &Server{Authorize: allowAll})
+
+	// The command exits without reading stdin, which the client never
+	// closes, so Exec must not wait for it.
+	stdin := &blockingReader{unblock: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Exec(context.Background(), &Request{Args: []string{"true"}}, stdin, nil, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Exec waited for unread stdin")
+	}
+
+	// The read in progress completes, but stdin isn't read again.
+	close(stdin.unblock)
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&stdin.reads); n != 1 {
+		t.Errorf("stdin read %d times, want 1", n)
+	}
+}
+
+func TestExecStdinEOF(t *testing.T) {
+	c := newTestClient(t, &Server{Authorize: allowAll})
+
+	var stdout bytes.Buffer
+	code, err := c.Exec(context.Background(), &Request{Args: []string{"wc", "-c"}}, io.LimitReader(zeros{}, 100000), &stdout, nil)
+	if err != nil || code != 0 {
+		t.Fatalf("Exec = %d, %v", code, err)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "100000" {
+		t.Errorf("stdout = %q, want 100000", got)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,72 @@
+package pipestest
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClock(t *testing.T) {
+	c := NewFakeClock(epoch)
+	if got := c.Now(); !got.Equal(epoch) {
+		t.Fatalf("Now() = %v, want %v", got, epoch)
+	}
+
+	select {
+	case now := <-c.After(0):
+		if !now.Equal(epoch) {
+			t.Errorf("After(0) sent %v, want %v", now, epoch)
+		}
+	default:
+		t.Error("After(0) didn't fire immediately")
+	}
+
+	short, long := c.After(time.Second), c.After(time.Minute)
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-short:
+		t.Fatal("After(1s) fired after 999ms")
+	default:
+	}
+	c.Advance(time.Millisecond)
+	select {
+	case now := <-short:
+		if want := epoch.Add(time.Second); !now.Equal(want) {
+			t.Errorf("After(1s) sent %v, want %v", now, want)
+		}
+	default:
+		t.Fatal("After(1s) didn't fire after 1s")
+	}
+	select {
+	case <-long:
+		t.Fatal("After(1m) fired after 1s")
+	default:
+	}
+	c.Advance(time.Hour)
+	<-long
+	if got, want := c.Now(), epoch.Add(time.Hour+time.Second); !got.Equal(want) {
+		t.Errorf("Now() = %v, want %v", got, want)
+	}
+}
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	c := NewFakeClock(epoch)
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			<-c.After(time.Second)
+			done <- struct{}{}
+		}()
+	}
+
+	c.BlockUntil(2)
+	select {
+	case <-done:
+		t.Fatal("sleeper woke up before the clock was advanced")
+	default:
+	}
+	c.Advance(time.Second)
+	<-done
+	<-done
+}
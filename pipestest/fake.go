@@ -0,0 +1,95 @@
+package pipestest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Fake describes the behavior of a fake command as a sequence of steps,
+// executed in order by a shell script, see FakePath.  If no Exit step is
+// given, the fake command exits successfully.
+type Fake struct {
+	steps []string
+}
+
+// NewFake returns a Fake that does nothing and exits successfully.
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// quote quotes s for the shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Stdout writes s to stdout.
+func (f *Fake) Stdout(s string) *Fake {
+	f.steps = append(f.steps, "printf '%s' "+quote(s))
+	return f
+}
+
+// Stderr writes s to stderr.
+func (f *Fake) Stderr(s string) *Fake {
+	f.steps = append(f.steps, "printf '%s' "+quote(s)+" >&2")
+	return f
+}
+
+// Sleep sleeps for d.
+func (f *Fake) Sleep(d time.Duration) *Fake {
+	f.steps = append(f.steps, fmt.Sprintf("sleep %g", d.Seconds()))
+	return f
+}
+
+// ConsumeStdin reads and discards stdin until EOF.
+func (f *Fake) ConsumeStdin() *Fake {
+	f.steps = append(f.steps, "cat >/dev/null")
+	return f
+}
+
+// CopyStdin copies stdin to stdout until EOF, like cat.
+func (f *Fake) CopyStdin() *Fake {
+	f.steps = append(f.steps, "cat")
+	return f
+}
+
+// Exit exits with code, skipping any later steps.
+func (f *Fake) Exit(code int) *Fake {
+	f.steps = append(f.steps, fmt.Sprintf("exit %d", code))
+	return f
+}
+
+func (f *Fake) script() string {
+	return "#!/bin/sh\n" + strings.Join(f.steps, "\n") + "\n"
+}
+
+// FakePath writes the fakes as executables, named by the map's keys, into a
+// temporary directory that is prepended to PATH until the test completes.
+// Commands must be created, e.g. by exec.Command, after FakePath is called
+// as their paths are looked up on creation.  The fakes are shell scripts, so
+// FakePath doesn't support Windows.  The directory is returned.
+func FakePath(t testing.TB, fakes map[string]*Fake) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, f := range fakes {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(f.script()), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, ok := os.LookupEnv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("PATH", path)
+		} else {
+			os.Unsetenv("PATH")
+		}
+	})
+	return dir
+}
@@ -0,0 +1,38 @@
+package pipestest
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sean-jc/pipes"
+)
+
+func TestFakePath(t *testing.T) {
+	FakePath(t, map[string]*Fake{
+		"produce": NewFake().Stdout("it's\n").Stderr("warning\n").Exit(3).Stdout("unreachable"),
+		"consume": NewFake().Sleep(10 * time.Millisecond).ConsumeStdin().Stdout("done\n"),
+		"copy":    NewFake().CopyStdin(),
+	})
+
+	var stdout, stderr bytes.Buffer
+	res, err := (&pipes.Runner{}).Exec(context.Background(), exec.Command("produce"), pipes.WithStdout(&stdout), pipes.WithStderr(&stderr))
+	if err == nil || res.Stages[0].ExitCode != 3 {
+		t.Errorf("Exec() error = %v, exit code %d, want 3", err, res.Stages[0].ExitCode)
+	}
+	if stdout.String() != "it's\n" || stderr.String() != "warning\n" {
+		t.Errorf("stdout = %q, stderr = %q", stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	cmds := []*exec.Cmd{exec.Command("copy"), exec.Command("consume")}
+	if err := pipes.ExecPipeline(cmds, strings.NewReader("ignored"), &stdout, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "done\n" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "done\n")
+	}
+}
@@ -0,0 +1,89 @@
+package pipestest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/sean-jc/pipes"
+)
+
+// filterEnv names the filter a re-executed test binary runs, see Main.
+const filterEnv = "PIPESTEST_FILTER"
+
+// Filter implements a pure filter command in Go: it reads stdin, writes
+// stdout and stderr, and returns the command's exit code.  Args excludes the
+// command's name.
+type Filter func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int
+
+var (
+	filtersMu sync.RWMutex
+	filters   = make(map[string]Filter)
+)
+
+// RegisterFilter registers fn to stand in for commands named name, e.g.
+// "gzip", in executions with WithFilters.  Filters must be registered in
+// both the test and the re-executed test binary, i.e. by an init function or
+// by TestMain before it calls Main.
+func RegisterFilter(name string, fn Filter) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	filters[name] = fn
+}
+
+func lookupFilter(name string) Filter {
+	filtersMu.RLock()
+	defer filtersMu.RUnlock()
+
+	return filters[name]
+}
+
+// Main runs the registered filter and exits if the test binary was
+// executed to stand in for a command, see WithFilters, and otherwise
+// returns.  Call it first thing in TestMain.
+func Main() {
+	name, ok := os.LookupEnv(filterEnv)
+	if !ok {
+		return
+	}
+	fn := lookupFilter(name)
+	if fn == nil {
+		fmt.Fprintf(os.Stderr, "pipestest: no filter registered for %s\n", name)
+		os.Exit(127)
+	}
+	os.Exit(fn(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// WithFilters swaps the commands for which a Filter is registered, matched
+// by the base name of their first argument, for the test binary itself,
+// which runs the filter from Main.  The rest of the execution, e.g. pipes,
+// timeouts and retries, is unchanged, so pipeline logic can be exercised
+// hermetically, without the real commands installed.  Errors name the test
+// binary rather than the swapped command.
+func WithFilters() pipes.Option {
+	return pipes.WithStartHook(func(stage int, cmd *exec.Cmd) error {
+		if len(cmd.Args) == 0 {
+			return nil
+		}
+		name := filepath.Base(cmd.Args[0])
+		if lookupFilter(name) == nil {
+			return nil
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		// The command needn't exist, so ignore any failure to find it.
+		cmd.Path, cmd.Err = exe, nil
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, filterEnv+"="+name)
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package pipestest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/sean-jc/pipes"
+)
+
+func init() {
+	RegisterFilter("upper", func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+		s := bufio.NewScanner(stdin)
+		for s.Scan() {
+			fmt.Fprintln(stdout, strings.ToUpper(s.Text()))
+		}
+		return 0
+	})
+	RegisterFilter("fail", func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+		fmt.Fprintln(stderr, strings.Join(args, " "))
+		return 2
+	})
+}
+
+func TestMain(m *testing.M) {
+	Main()
+	os.Exit(m.Run())
+}
+
+func TestWithFilters(t *testing.T) {
+	// Neither command is installed, and sort is a real command.
+	cmds := []*exec.Cmd{exec.Command("upper"), exec.Command("sort")}
+	var stdout, stderr bytes.Buffer
+	_, err := (&pipes.Runner{}).ExecPipeline(context.Background(), cmds, WithFilters(), pipes.WithStdin(strings.NewReader("b\na\n")), pipes.WithStdout(&stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "A\nB\n" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "A\nB\n")
+	}
+
+	res, err := (&pipes.Runner{}).Exec(context.Background(), exec.Command("fail", "x", "y"), WithFilters(), pipes.WithStderr(&stderr))
+	if err == nil || res.Stages[0].ExitCode != 2 {
+		t.Errorf("Exec() error = %v, exit code %d, want 2", err, res.Stages[0].ExitCode)
+	}
+	if stderr.String() != "x y\n" {
+		t.Errorf("stderr = %q, want the arguments", stderr.String())
+	}
+}
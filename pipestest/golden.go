@@ -0,0 +1,116 @@
+package pipestest
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/sean-jc/pipes"
+)
+
+// update is the -update flag, which rewrites golden files with the actual
+// output instead of comparing against them.  Tests that import pipestest
+// must not define their own -update flag.
+var update = flag.Bool("update", false, "update golden files")
+
+// Normalizer rewrites output before it's compared with or written to a
+// golden file, e.g. to mask timestamps or temporary paths.
+type Normalizer func(b []byte) []byte
+
+// ReplaceString returns a Normalizer that replaces every occurrence of old
+// with new, e.g. a test's temporary directory with "$TMPDIR".
+func ReplaceString(old string, new string) Normalizer {
+	return func(b []byte) []byte {
+		if old == "" {
+			return b
+		}
+		return bytes.ReplaceAll(b, []byte(old), []byte(new))
+	}
+}
+
+// ReplaceRegexp returns a Normalizer that replaces matches of re with repl,
+// which may reference submatches as by Regexp.ReplaceAll.
+func ReplaceRegexp(re *regexp.Regexp, repl string) Normalizer {
+	return func(b []byte) []byte {
+		return re.ReplaceAll(b, []byte(repl))
+	}
+}
+
+var timestampRe = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+
+// Timestamps is a Normalizer that replaces RFC 3339 and similar
+// "2006-01-02 15:04:05" timestamps with "<TIME>".
+var Timestamps = ReplaceRegexp(timestampRe, "<TIME>")
+
+func normalize(b []byte, normalizers []Normalizer) []byte {
+	for _, n := range normalizers {
+		b = n(b)
+	}
+	return b
+}
+
+// CompareGolden compares got, once normalized, with the contents of the
+// golden file at path, failing t if they differ.  A missing golden file is
+// compared as empty.  With -update, the file is written instead, or removed
+// if got is empty.
+func CompareGolden(t testing.TB, path string, got []byte, normalizers ...Normalizer) {
+	t.Helper()
+
+	got = normalize(got, normalizers)
+	if *update {
+		if len(got) == 0 {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: output differs from golden file at line %d, run with -update to accept\n--- got:\n%s\n--- want:\n%s", path, diffLine(got, want), got, want)
+	}
+}
+
+// diffLine returns the first line, counting from 1, at which a and b differ.
+func diffLine(a []byte, b []byte) int {
+	line := 1
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+// RunGolden executes the pipeline with stdin and compares its stdout and
+// stderr with the golden files testdata/<name>.stdout and
+// testdata/<name>.stderr, see CompareGolden.  The pipeline's error is
+// returned for the test to check, as the commands may be expected to fail.
+func RunGolden(t testing.TB, name string, cmds []*exec.Cmd, stdin io.Reader, normalizers ...Normalizer) error {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	err := pipes.ExecPipeline(cmds, stdin, &stdout, &stderr)
+
+	base := filepath.Join("testdata", name)
+	CompareGolden(t, base+".stdout", stdout.Bytes(), normalizers...)
+	CompareGolden(t, base+".stderr", stderr.Bytes(), normalizers...)
+	return err
+}
@@ -0,0 +1,72 @@
+package pipestest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordingTB records failures rather than failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestCompareGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.golden")
+	if err := ioutil.WriteFile(path, []byte("a\n<TIME> in $TMPDIR\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	normalizers := []Normalizer{Timestamps, ReplaceString("/tmp/x", "$TMPDIR")}
+
+	r := &recordingTB{TB: t}
+	CompareGolden(r, path, []byte("a\n2020-01-02T03:04:05.123Z in /tmp/x\n"), normalizers...)
+	if len(r.errors) != 0 {
+		t.Errorf("matching output failed: %q", r.errors)
+	}
+
+	CompareGolden(r, path, []byte("a\nb\n"), normalizers...)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "at line 2") {
+		t.Errorf("differing output failed with %q, want a difference at line 2", r.errors)
+	}
+
+	// A missing golden file is compared as empty.
+	r.errors = nil
+	missing := filepath.Join(t.TempDir(), "missing")
+	CompareGolden(r, missing, nil)
+	if len(r.errors) != 0 {
+		t.Errorf("empty output failed: %q", r.errors)
+	}
+}
+
+func TestCompareGoldenUpdate(t *testing.T) {
+	defer func(old bool) { *update = old }(*update)
+	*update = true
+
+	path := filepath.Join(t.TempDir(), "sub", "out.golden")
+	CompareGolden(t, path, []byte("at 2006-01-02 15:04:05\n"), Timestamps)
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "at <TIME>\n" {
+		t.Errorf("golden file = %q, %v", b, err)
+	}
+	CompareGolden(t, path, nil)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("golden file for empty output wasn't removed: %v", err)
+	}
+}
+
+func TestRunGolden(t *testing.T) {
+	cmds := []*exec.Cmd{exec.Command("cat"), exec.Command("sh", "-c", "tr a-z A-Z; echo warning >&2")}
+	if err := RunGolden(t, "upper", cmds, strings.NewReader("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package pipestest
+
+import (
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/sean-jc/pipes"
+)
+
+// Latency delays starting the commands at the given stages, or all commands
+// if no stages are given, by d as measured by clock, e.g. a FakeClock.
+func Latency(clock pipes.Clock, d time.Duration, stages ...int) pipes.Option {
+	return pipes.WithStartHook(func(stage int, cmd *exec.Cmd) error {
+		if len(stages) > 0 && !contains(stages, stage) {
+			return nil
+		}
+		<-clock.After(d)
+		return nil
+	})
+}
+
+func contains(stages []int, stage int) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+type slowReader struct {
+	r     io.Reader
+	clock pipes.Clock
+	chunk int
+	delay time.Duration
+}
+
+// SlowReader returns a reader that reads from r at most chunk bytes at a
+// time, waiting for delay as measured by clock before each read, e.g. to
+// feed a pipeline's stdin slowly.
+func SlowReader(r io.Reader, clock pipes.Clock, chunk int, delay time.Duration) io.Reader {
+	return &slowReader{r, clock, chunk, delay}
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	<-s.clock.After(s.delay)
+	if len(p) > s.chunk {
+		p = p[:s.chunk]
+	}
+	return s.r.Read(p)
+}
+
+type slowWriter struct {
+	w     io.Writer
+	clock pipes.Clock
+	chunk int
+	delay time.Duration
+}
+
+// SlowWriter returns a writer that writes to w at most chunk bytes at a
+// time, waiting for delay as measured by clock before each chunk, e.g. to
+// model a slow consumer of a pipeline's output and exercise backpressure.
+func SlowWriter(w io.Writer, clock pipes.Clock, chunk int, delay time.Duration) io.Writer {
+	return &slowWriter{w, clock, chunk, delay}
+}
+
+func (s *slowWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > s.chunk {
+			n = s.chunk
+		}
+		<-s.clock.After(s.delay)
+		n, err := s.w.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type partialWriter struct {
+	w   io.Writer
+	max int
+}
+
+// PartialWriter returns a writer that writes at most max bytes of each
+// write to w and fails the rest with io.ErrShortWrite, e.g. to exercise
+// the handling of writers that fail mid-stream.
+func PartialWriter(w io.Writer, max int) io.Writer {
+	return &partialWriter{w, max}
+}
+
+func (p *partialWriter) Write(b []byte) (int, error) {
+	if len(b) <= p.max {
+		return p.w.Write(b)
+	}
+	n, err := p.w.Write(b[:p.max])
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
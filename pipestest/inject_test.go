@@ -0,0 +1,114 @@
+package pipestest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sean-jc/pipes"
+)
+
+func TestLatency(t *testing.T) {
+	c := NewFakeClock(epoch)
+	cmds := []*exec.Cmd{exec.Command("true"), exec.Command("true")}
+	done := make(chan error, 1)
+	go func() {
+		_, err := (&pipes.Runner{}).ExecPipeline(context.Background(), cmds, Latency(c, time.Second, 1))
+		done <- err
+	}()
+
+	// Only the second command waits.
+	c.BlockUntil(1)
+	select {
+	case err := <-done:
+		t.Fatalf("pipeline completed before the latency elapsed: %v", err)
+	default:
+	}
+	if cmds[0].Process == nil || cmds[1].Process != nil {
+		t.Errorf("commands started before the latency elapsed: %v, %v", cmds[0].Process, cmds[1].Process)
+	}
+	c.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSlowReader(t *testing.T) {
+	c := NewFakeClock(epoch)
+	r := SlowReader(strings.NewReader("abcdefg"), c, 3, time.Second)
+	got := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		got <- b
+	}()
+
+	// Every read, including the one returning EOF, waits.
+	for i := 0; i < 4; i++ {
+		c.BlockUntil(1)
+		c.Advance(time.Second)
+	}
+	if b := <-got; string(b) != "abcdefg" {
+		t.Errorf("read %q, want %q", b, "abcdefg")
+	}
+
+	buf := make([]byte, 10)
+	r = SlowReader(strings.NewReader("abcdefg"), NewFakeClock(epoch), 3, 0)
+	if n, err := r.Read(buf); n != 3 || err != nil {
+		t.Errorf("Read() = %d, %v, want 3 bytes", n, err)
+	}
+}
+
+// recordingWriter records the size of each write.
+type recordingWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.writes = append(w.writes, len(b))
+	return w.Buffer.Write(b)
+}
+
+func TestSlowWriter(t *testing.T) {
+	c := NewFakeClock(epoch)
+	var out recordingWriter
+	w := SlowWriter(&out, c, 3, time.Second)
+	done := make(chan error)
+	go func() {
+		n, err := w.Write([]byte("abcdefg"))
+		if err == nil && n != 7 {
+			err = io.ErrShortWrite
+		}
+		done <- err
+	}()
+
+	for i := 0; i < 3; i++ {
+		c.BlockUntil(1)
+		c.Advance(time.Second)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "abcdefg" || len(out.writes) != 3 || out.writes[0] != 3 || out.writes[2] != 1 {
+		t.Errorf("wrote %q in chunks of %v, want chunks of at most 3 bytes", out.String(), out.writes)
+	}
+}
+
+func TestPartialWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := PartialWriter(&out, 4)
+	if n, err := w.Write([]byte("abc")); n != 3 || err != nil {
+		t.Errorf("Write(3 bytes) = %d, %v", n, err)
+	}
+	if n, err := w.Write([]byte("defghi")); n != 4 || err != io.ErrShortWrite {
+		t.Errorf("Write(6 bytes) = %d, %v, want 4, %v", n, err, io.ErrShortWrite)
+	}
+	if out.String() != "abcdefg" {
+		t.Errorf("wrote %q, want %q", out.String(), "abcdefg")
+	}
+}
@@ -0,0 +1,119 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// maxPooledBuffer is the largest buffer a Pool will recycle, so that a
+// single command with huge output doesn't pin that memory forever.
+const maxPooledBuffer = 1 << 20
+
+// Pool executes short-lived commands on a fixed set of pre-started worker
+// goroutines, recycling the buffers used to capture Stdout and Stderr across
+// commands, to minimize the per-command setup cost when running very high
+// rates of commands.  A Pool must not be used after it is closed.
+type Pool struct {
+	jobs chan poolJob
+	wg   sync.WaitGroup
+	bufs sync.Pool
+}
+
+// PoolResult is the result of a single command executed by a Pool.
+type PoolResult struct {
+	// Stdout holds the command's Stdout if it succeeded.
+	Stdout []byte
+	// Err is an error containing the command that failed, the system
+	// error string and any information captured from Stderr.
+	Err error
+}
+
+type poolJob struct {
+	cmd   *exec.Cmd
+	stdin io.Reader
+	res   *PoolResult
+	done  *sync.WaitGroup
+}
+
+// NewPool returns a Pool that executes up to workers commands concurrently.
+func NewPool(workers int) *Pool {
+	p := &Pool{jobs: make(chan poolJob)}
+	p.bufs.New = func() interface{} {
+		return new(bytes.Buffer)
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		*job.res = p.exec(job.cmd, job.stdin)
+		job.done.Done()
+	}
+}
+
+func (p *Pool) getBuffer() *bytes.Buffer {
+	return p.bufs.Get().(*bytes.Buffer)
+}
+
+func (p *Pool) putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		buf.Reset()
+		p.bufs.Put(buf)
+	}
+}
+
+func (p *Pool) exec(cmd *exec.Cmd, stdin io.Reader) PoolResult {
+	stdout, stderr := p.getBuffer(), p.getBuffer()
+	defer p.putBuffer(stdout)
+	defer p.putBuffer(stderr)
+
+	if err := Exec(cmd, stdin, stdout, stderr); err != nil {
+		// The buffer is recycled, the error needs its own copy.
+		return PoolResult{Err: &Error{Err: err, Stderr: append([]byte(nil), stderr.Bytes()...)}}
+	}
+	return PoolResult{Stdout: append([]byte(nil), stdout.Bytes()...)}
+}
+
+// ExecO executes a single command on one of the Pool's workers, optionally
+// reading data from stdin.  Returns the command's Stdout as a byte slice,
+// and an error containing the command that failed, the system error string
+// and any information captured from Stderr.
+func (p *Pool) ExecO(cmd *exec.Cmd, stdin io.Reader) ([]byte, error) {
+	res := p.ExecBatch([]*exec.Cmd{cmd}, []io.Reader{stdin})
+	return res[0].Stdout, res[0].Err
+}
+
+// ExecBatch executes several independent commands on the Pool's workers,
+// reading data from the corresponding entry in stdins, if any, for each
+// command's stdin.  stdins may be nil or shorter than cmds.  Blocks until
+// all commands complete and returns each command's result, in order.
+func (p *Pool) ExecBatch(cmds []*exec.Cmd, stdins []io.Reader) []PoolResult {
+	res := make([]PoolResult, len(cmds))
+
+	var done sync.WaitGroup
+	done.Add(len(cmds))
+	for i, cmd := range cmds {
+		var stdin io.Reader
+		if i < len(stdins) {
+			stdin = stdins[i]
+		}
+		p.jobs <- poolJob{cmd: cmd, stdin: stdin, res: &res[i], done: &done}
+	}
+	done.Wait()
+	return res
+}
+
+// Close stops the Pool's workers once all submitted commands complete.
+func (p *Pool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
@@ -0,0 +1,57 @@
+package pipes
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(2)
+	defer p.Close()
+
+	out, err := p.ExecO(exec.Command("echo", "hi"), nil)
+	if err != nil || string(out) != "hi\n" {
+		t.Errorf("ExecO = %q, %v, want hi", out, err)
+	}
+
+	// Results are in order, and don't share the recycled buffers.
+	var cmds []*exec.Cmd
+	for i := 0; i < 20; i++ {
+		cmds = append(cmds, exec.Command("cat"))
+	}
+	cmds = append(cmds, exec.Command("sh", "-c", "echo oops >&2; exit 1"))
+	stdins := []io.Reader{strings.NewReader("0"), strings.NewReader("1")}
+	res := p.ExecBatch(cmds, stdins)
+	for i, r := range res[:20] {
+		want := ""
+		if i < len(stdins) {
+			want = fmt.Sprint(i)
+		}
+		if r.Err != nil || string(r.Stdout) != want {
+			t.Errorf("result %d = %q, %v, want %q", i, r.Stdout, r.Err, want)
+		}
+	}
+	if err := res[20].Err; err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("error = %v, want the captured Stderr", err)
+	}
+}
+
+func TestPoolWorkers(t *testing.T) {
+	p := NewPool(2)
+	defer p.Close()
+
+	// Only two of the four commands run at a time.
+	var cmds []*exec.Cmd
+	for i := 0; i < 4; i++ {
+		cmds = append(cmds, exec.Command("sleep", "0.2"))
+	}
+	start := time.Now()
+	p.ExecBatch(cmds, nil)
+	if d := time.Since(start); d < 400*time.Millisecond || d > 2*time.Second {
+		t.Errorf("batch took %s, want about 400ms", d)
+	}
+}
@@ -0,0 +1,70 @@
+package pipes
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Ports are free ports allocated on the loopback interface, by name, see
+// AllocatePorts.
+type Ports map[string]int
+
+// AllocatePorts allocates a distinct free port for each name, on network
+// "tcp" or "udp", e.g. for ephemeral servers in integration tests.  Ports
+// can be injected into commands' arguments by passing them as the data for
+// Command's templates, e.g. "--listen=127.0.0.1:{{.http}}", or into their
+// environment via SetEnv.  The ports are free when allocated, but nothing
+// prevents another process from taking them before the server does.
+func AllocatePorts(network string, names ...string) (Ports, error) {
+	ports := make(Ports, len(names))
+
+	// Keep every port bound until all are allocated, so they're distinct.
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+
+	for _, name := range names {
+		var port int
+		switch network {
+		case "tcp":
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				return nil, err
+			}
+			closers = append(closers, l)
+			port = l.Addr().(*net.TCPAddr).Port
+		case "udp":
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				return nil, err
+			}
+			closers = append(closers, conn)
+			port = conn.LocalAddr().(*net.UDPAddr).Port
+		default:
+			return nil, fmt.Errorf("unsupported network %q", network)
+		}
+		ports[name] = port
+	}
+	return ports, nil
+}
+
+// Addr returns the loopback address of the named port, e.g. for
+// WithTCPProbe.
+func (p Ports) Addr(name string) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(p[name]))
+}
+
+// SetEnv sets a variable for each port in env, named by prefix and the
+// port's name, e.g. "PORT_http" for the prefix "PORT_" and the name
+// "http", and returns env.
+func (p Ports) SetEnv(env *Env, prefix string) *Env {
+	for name, port := range p {
+		env.Set(prefix+name, strconv.Itoa(port))
+	}
+	return env
+}
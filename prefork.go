@@ -0,0 +1,247 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Prefork keeps instances of a frequently used command started in warm
+// standby, blocked reading their stdin, and hands each execution an idle
+// instance, to amortize the startup cost of heavy interpreters such as
+// python.  Each instance serves a single execution and is then replaced in
+// the background, so all executions run the same command line and differ
+// only in their stdin, e.g. a script.  If no instance is idle, a new one is
+// started for the execution.  A Prefork must not be used after it is
+// closed.
+type Prefork struct {
+	cmd  func() *exec.Cmd
+	idle chan *warmProc
+	wg   sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+
+	warm, cold int64
+}
+
+// warmProc is a started instance and this process's ends of its stdio.
+type warmProc struct {
+	cmd            *exec.Cmd
+	stdin          *os.File
+	stdout, stderr *os.File
+	exited         chan struct{}
+	err            error
+}
+
+// NewPrefork returns a Prefork keeping n instances of the command returned
+// by cmd, which is called for every instance, in warm standby.  Returns an
+// error containing the command that failed as well as the system error
+// string if the instances can't be started.
+func NewPrefork(n int, cmd func() *exec.Cmd) (*Prefork, error) {
+	p := &Prefork{cmd: cmd, idle: make(chan *warmProc, n)}
+	for i := 0; i < n; i++ {
+		w, err := p.start()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.idle <- w
+	}
+	return p, nil
+}
+
+// start starts an instance.
+func (p *Prefork) start() (*warmProc, error) {
+	cmd := p.cmd()
+
+	var files [6]*os.File
+	closeAll := func(files []*os.File) {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}
+	for i := 0; i < len(files); i += 2 {
+		var err error
+		if files[i], files[i+1], err = os.Pipe(); err != nil {
+			closeAll(files[:])
+			return nil, fmt.Errorf("%s %s", cmd.Path, err.Error())
+		}
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = files[0], files[3], files[5]
+	err := forkTracked(cmd)
+	closeAll([]*os.File{files[0], files[3], files[5]})
+	if err != nil {
+		closeAll([]*os.File{files[1], files[2], files[4]})
+		return nil, fmt.Errorf("%s %s", cmd.Path, err.Error())
+	}
+
+	w := &warmProc{cmd: cmd, stdin: files[1], stdout: files[2], stderr: files[4], exited: make(chan struct{})}
+	go func() {
+		w.err = cmd.Wait()
+		untrack(cmd)
+		close(w.exited)
+	}()
+	return w, nil
+}
+
+// kill kills an instance that won't be used and releases its pipes.
+func (w *warmProc) kill() {
+	w.cmd.Process.Signal(syscall.SIGKILL)
+	<-w.exited
+	w.stdin.Close()
+	w.stdout.Close()
+	w.stderr.Close()
+}
+
+// get returns an idle instance that is still running, or a new one.
+func (p *Prefork) get() (*warmProc, error) {
+	for {
+		select {
+		case w := <-p.idle:
+			p.replace()
+			select {
+			case <-w.exited:
+				// Died while idle, e.g. killed.
+				w.kill()
+				continue
+			default:
+			}
+			atomic.AddInt64(&p.warm, 1)
+			return w, nil
+		default:
+			atomic.AddInt64(&p.cold, 1)
+			return p.start()
+		}
+	}
+}
+
+// replace starts an instance in the background to replace one taken from
+// the idle instances.
+func (p *Prefork) replace() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		w, err := p.start()
+		if err != nil {
+			// Executions start instances themselves until the
+			// command can be started again.
+			return
+		}
+		select {
+		case p.idle <- w:
+		default:
+			w.kill()
+		}
+	}()
+}
+
+// Exec executes the command on an idle instance, optionally reading data
+// from stdin and writing the output to stdout and the Stderr output to
+// stderr, either of which is discarded if nil.  The instance is killed if
+// ctx is done before it completes.  Returns an error containing the command
+// that failed as well as the system error string.
+func (p *Prefork) Exec(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return fmt.Errorf("prefork is closed")
+	}
+
+	w, err := p.get()
+	if err != nil {
+		return err
+	}
+	path := w.cmd.Path
+
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+
+	var wg sync.WaitGroup
+	var outErrs [2]error
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		if stdin != nil {
+			// The instance exiting before reading all of its stdin
+			// isn't an error, as with Exec.
+			io.Copy(w.stdin, countPipedReader(stdin))
+		}
+		w.stdin.Close()
+	}()
+	copyOut := func(dst io.Writer, src *os.File, err *error) {
+		defer wg.Done()
+		_, *err = io.Copy(countPiped(dst), src)
+		src.Close()
+	}
+	go copyOut(stdout, w.stdout, &outErrs[0])
+	go copyOut(stderr, w.stderr, &outErrs[1])
+
+	select {
+	case <-w.exited:
+	case <-ctx.Done():
+		w.cmd.Process.Signal(syscall.SIGKILL)
+		<-w.exited
+	}
+	wg.Wait()
+
+	if err = ctx.Err(); err == nil {
+		if err = w.err; err == nil {
+			if err = outErrs[0]; err == nil {
+				err = outErrs[1]
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s", path, err.Error())
+	}
+	return nil
+}
+
+// Stats returns the number of executions that were handed a warm instance,
+// and the number that had to start one.
+func (p *Prefork) Stats() (warm int64, cold int64) {
+	return atomic.LoadInt64(&p.warm), atomic.LoadInt64(&p.cold)
+}
+
+// Close kills the idle instances, once any being started have been.
+// Executions already handed an instance are unaffected.
+func (p *Prefork) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return fmt.Errorf("prefork is closed")
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	for {
+		select {
+		case w := <-p.idle:
+			w.kill()
+		default:
+			return nil
+		}
+	}
+}
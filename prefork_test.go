@@ -0,0 +1,78 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefork(t *testing.T) {
+	// Instances log their start before running the script on their stdin.
+	log := filepath.Join(t.TempDir(), "log")
+	p, err := NewPrefork(2, func() *exec.Cmd {
+		return exec.Command("sh", "-c", "echo >>"+log+"; exec sh")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := func() int {
+		data, _ := ioutil.ReadFile(log)
+		return strings.Count(string(data), "\n")
+	}
+	for deadline := time.Now().Add(5 * time.Second); started() < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := started(); n != 2 {
+		t.Fatalf("%d instances started, want 2 in standby", n)
+	}
+
+	pids := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		var stdout, stderr bytes.Buffer
+		if err := p.Exec(context.Background(), strings.NewReader("echo $$; echo err >&2"), &stdout, &stderr); err != nil {
+			t.Fatal(err)
+		}
+		if stderr.String() != "err\n" {
+			t.Errorf("stderr = %q, want err", stderr.String())
+		}
+		pids[stdout.String()] = true
+	}
+	// Each execution gets its own instance.
+	if len(pids) != 4 {
+		t.Errorf("executions ran on %d instances, want 4", len(pids))
+	}
+	if warm, cold := p.Stats(); warm < 1 || warm+cold != 4 {
+		t.Errorf("Stats() = %d, %d, want warm executions", warm, cold)
+	}
+
+	if err := p.Exec(context.Background(), strings.NewReader("exit 3"), nil, nil); err == nil {
+		t.Error("no error for failing execution")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.Exec(ctx, strings.NewReader("exec sleep 10"), nil, nil); err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("error = %v after %s, want the execution killed", err, time.Since(start))
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Exec(context.Background(), nil, nil, nil); err == nil {
+		t.Error("no error executing on closed Prefork")
+	}
+	if err := p.Close(); err == nil {
+		t.Error("no error closing Prefork twice")
+	}
+}
+
+func TestPreforkStartFailure(t *testing.T) {
+	if _, err := NewPrefork(1, func() *exec.Cmd { return exec.Command("/nonexistent") }); err == nil {
+		t.Error("no error for command that can't be started")
+	}
+}
@@ -0,0 +1,74 @@
+package pipes
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procStat holds the fields of /proc/<pid>/stat used by this package.
+type procStat struct {
+	state string
+	ppid  int
+	// rss is the resident set size in pages.
+	rss int64
+}
+
+// readProcStat reads and parses /proc/<pid>/stat.
+func readProcStat(pid int) (procStat, error) {
+	b, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return procStat{}, err
+	}
+	// The command name may contain spaces and parentheses, the remaining
+	// fields, starting with the state, follow the last closing parenthesis.
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return procStat{}, errors.New("malformed /proc stat")
+	}
+	fields := bytes.Fields(b[i+1:])
+	if len(fields) < 22 {
+		return procStat{}, errors.New("malformed /proc stat")
+	}
+	ppid, _ := strconv.Atoi(string(fields[1]))
+	rss, _ := strconv.ParseInt(string(fields[21]), 10, 64)
+	return procStat{state: string(fields[0]), ppid: ppid, rss: rss}, nil
+}
+
+// procPids returns the pids of all processes in /proc.
+func procPids() []int {
+	paths, _ := filepath.Glob("/proc/[0-9]*")
+
+	var pids []int
+	for _, path := range paths {
+		if pid, err := strconv.Atoi(filepath.Base(path)); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// listProcesses returns all processes, read from /proc.
+func listProcesses() ([]ProcessInfo, error) {
+	pageSize := int64(os.Getpagesize())
+
+	var list []ProcessInfo
+	for _, pid := range procPids() {
+		stat, err := readProcStat(pid)
+		if err != nil {
+			// The process exited.
+			continue
+		}
+		cmdline, _ := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+		var args []string
+		if len(cmdline) > 0 {
+			args = strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")
+		}
+		list = append(list, ProcessInfo{Pid: pid, PPid: stat.ppid, Args: args, RSS: stat.rss * pageSize})
+	}
+	return list, nil
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package pipes
+
+import (
+	"errors"
+)
+
+// listProcesses is only supported on Unix platforms.
+func listProcesses() ([]ProcessInfo, error) {
+	return nil, errors.New("process listing not supported on this platform")
+}
@@ -0,0 +1,34 @@
+//go:build unix && !linux
+
+package pipes
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// listProcesses returns all processes, read from ps(1).
+func listProcesses() ([]ProcessInfo, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,rss=,args=").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []ProcessInfo
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		ppid, _ := strconv.Atoi(fields[1])
+		// ps reports the RSS in kilobytes.
+		rss, _ := strconv.ParseInt(fields[2], 10, 64)
+		list = append(list, ProcessInfo{Pid: pid, PPid: ppid, Args: fields[3:], RSS: rss * 1024})
+	}
+	return list, nil
+}
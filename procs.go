@@ -0,0 +1,56 @@
+package pipes
+
+import (
+	"os/exec"
+	"sync"
+)
+
+// procs tracks the commands started by this package that haven't been
+// waited on yet, e.g. so that the subreaper leaves them to cmd.Wait.
+var procs = struct {
+	// startMu is held for reading while forking commands, and for
+	// writing while reaping, so that commands are tracked before they
+	// can be reaped.
+	startMu sync.RWMutex
+
+	mu   sync.Mutex
+	cmds map[int]*exec.Cmd
+}{cmds: make(map[int]*exec.Cmd)}
+
+// forkTracked starts cmd, tracking it until untrack is called.  Every start
+// path ends in it, so the start lock is only held while forking, not while
+// start hooks run, e.g. waiting on other commands.
+func forkTracked(cmd *exec.Cmd) error {
+	procs.startMu.RLock()
+	defer procs.startMu.RUnlock()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	procs.mu.Lock()
+	procs.cmds[cmd.Process.Pid] = cmd
+	procs.mu.Unlock()
+	processesStarted.Add(1)
+	return nil
+}
+
+// untrack stops tracking cmd once it has been waited on.
+func untrack(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	recordExit(cmd)
+	procs.mu.Lock()
+	delete(procs.cmds, cmd.Process.Pid)
+	procs.mu.Unlock()
+}
+
+// isTracked returns true if pid is a command started by this package that
+// hasn't been waited on yet.
+func isTracked(pid int) bool {
+	procs.mu.Lock()
+	defer procs.mu.Unlock()
+
+	_, ok := procs.cmds[pid]
+	return ok
+}
@@ -0,0 +1,88 @@
+package pipes
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// subreaperEnv is set for a test binary re-executed by inSubreaper.
+const subreaperEnv = "PIPES_TEST_SUBREAPER"
+
+// inSubreaper returns true if the calling test, a top-level one, is to run
+// in this process, which is a subreaper.  Otherwise it runs the test in a
+// re-executed test binary, as EnableSubreaper can't be undone, and returns
+// false once it has passed.
+func inSubreaper(t *testing.T) bool {
+	if os.Getenv(subreaperEnv) != "" {
+		if err := EnableSubreaper(); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("subreaper only supported on Linux")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$", "-test.v")
+	cmd.Env = append(os.Environ(), subreaperEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "--- PASS: "+t.Name()) {
+		t.Fatalf("%s in a subreaper: %v\n%s", t.Name(), err, out)
+	}
+	return false
+}
+
+// checkStartsNotBlocked fails t unless other commands start, and are
+// reaped, while block is blocked starting a command, until its context is
+// done.
+func checkStartsNotBlocked(t *testing.T, block func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		block(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Each command exiting makes the reaper take the start lock.
+	started := make(chan error, 1)
+	go func() {
+		for i := 0; i < 5; i++ {
+			if _, err := (&Runner{}).Exec(context.Background(), exec.Command("true")); err != nil {
+				started <- err
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		started <- nil
+	}()
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("commands didn't start while another was blocked starting")
+	}
+	cancel()
+	<-blocked
+}
+
+func TestStartHookDoesntBlockStarts(t *testing.T) {
+	if !inSubreaper(t) {
+		return
+	}
+	checkStartsNotBlocked(t, func(ctx context.Context) {
+		wait := func(c *config) {
+			c.onStart(func(cmd *exec.Cmd, start func() error) error {
+				<-ctx.Done()
+				return start()
+			}, nil)
+		}
+		(&Runner{}).Exec(context.Background(), exec.Command("true"), wait)
+	})
+}
@@ -0,0 +1,108 @@
+package pipes
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// WithPTY runs the pipeline under a pseudo terminal of the given size, so
+// that commands behave as they would interactively, e.g. prompting for
+// passwords, coloring output or disabling buffering.  The first command's
+// stdin, the last command's stdout and all commands' Stderr output are
+// connected to the pty, and the first command is made a session leader with
+// the pty as its controlling terminal.  The execution's stdin, if any, is
+// written to the pty as the terminal's input and the terminal's output, as
+// echoed, is written to the execution's stdout.  If transcript is non-nil,
+// the session is recorded, see Transcript.  Only supported on Linux.
+func WithPTY(rows int, cols int, transcript *Transcript) Option {
+	return func(c *config) {
+		var master, slave *os.File
+		var closeSlave sync.Once
+		copying, done := false, make(chan struct{})
+
+		c.onSetup(func(c *config) error {
+			var err error
+			if master, slave, err = openPTY(rows, cols); err != nil {
+				return err
+			}
+			if transcript != nil {
+				transcript.begin(cols, rows)
+			}
+			return nil
+		})
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			i, last := stageIndex(c.cmds, cmd), len(c.cmds)-1
+			if i == 0 {
+				// The execution's writers are final once the
+				// commands are started.
+				stdin, stdout := c.stdin, c.stdout
+				if stdout == nil {
+					stdout = ioutil.Discard
+				}
+				if transcript != nil {
+					stdout = &transcriptWriter{stdout, transcript, "o"}
+				}
+				copying = true
+				go func() {
+					defer close(done)
+					// Reading fails with EIO once the commands
+					// have closed the pty.  Keep draining it if
+					// writing fails, lest the commands block.
+					if _, err := io.Copy(stdout, master); err != nil {
+						io.Copy(ioutil.Discard, master)
+					}
+				}()
+				if stdin != nil {
+					var w io.Writer = master
+					if transcript != nil {
+						w = &transcriptWriter{master, transcript, "i"}
+					}
+					go io.Copy(w, stdin)
+				}
+
+				cmd.Stdin = slave
+				if err := setSetctty(cmd, 0); err != nil {
+					return err
+				}
+			}
+			if i == last {
+				cmd.Stdout = slave
+			}
+			cmd.Stderr = slave
+
+			if err := start(); err != nil {
+				return err
+			}
+			// The terminal's output ends once the commands close it.
+			if i == last {
+				closeSlave.Do(func() { slave.Close() })
+			}
+			return nil
+		}, nil)
+
+		// Wait for the terminal's output once the commands have exited,
+		// before the execution's output is complete.
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			err := wait()
+			if copying && stageIndex(c.cmds, cmd) == len(c.cmds)-1 {
+				<-done
+			}
+			return err
+		}, nil)
+
+		c.onRelease(func() {
+			if master == nil {
+				return
+			}
+			closeSlave.Do(func() { slave.Close() })
+			if copying {
+				<-done
+			}
+			master.Close()
+		})
+	}
+}
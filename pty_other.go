@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pipes
+
+import (
+	"errors"
+	"os"
+)
+
+// openPTY fails, as ptys are only supported on Linux.
+func openPTY(rows int, cols int) (*os.File, *os.File, error) {
+	return nil, nil, errors.New("pty not supported on this platform")
+}
@@ -0,0 +1,141 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// ErrQuotaExceeded is the error to wrap by quota checks, see WithQuota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// IOUsage counts the bytes of an execution's input and output.
+type IOUsage struct {
+	Stdin  int64 `json:"stdin_bytes"`
+	Stdout int64 `json:"stdout_bytes"`
+	Stderr int64 `json:"stderr_bytes"`
+}
+
+// ioMeter counts an execution's I/O, checking it against a quota if check
+// is non-nil.
+type ioMeter struct {
+	c     *config
+	check func(total IOUsage, delta IOUsage) error
+
+	mu    sync.Mutex
+	total IOUsage
+	err   error
+}
+
+// add counts delta, returning the error of the check if it failed.
+func (m *ioMeter) add(delta IOUsage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	m.total.Stdin += delta.Stdin
+	m.total.Stdout += delta.Stdout
+	m.total.Stderr += delta.Stderr
+	if m.check == nil {
+		return nil
+	}
+	if m.err = m.check(m.total, delta); m.err != nil {
+		m.c.abort(m.err)
+	}
+	return m.err
+}
+
+// usage returns the bytes counted so far.
+func (m *ioMeter) usage() IOUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.total
+}
+
+// meter counts c's input and output with m, copying them through this
+// process.
+func (m *ioMeter) meter(c *config) {
+	if c.stdin != nil {
+		c.stdin = &meterReader{c.stdin, m}
+	}
+	stdout, stderr := c.stdout, c.stderr
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	c.stdout = &meterWriter{stdout, m, false}
+	c.stderr = &meterWriter{stderr, m, true}
+}
+
+type meterReader struct {
+	r io.Reader
+	m *ioMeter
+}
+
+func (r *meterReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if qerr := r.m.add(IOUsage{Stdin: int64(n)}); qerr != nil {
+			return 0, qerr
+		}
+	}
+	return n, err
+}
+
+type meterWriter struct {
+	w      io.Writer
+	m      *ioMeter
+	stderr bool
+}
+
+func (w *meterWriter) Write(p []byte) (int, error) {
+	delta := IOUsage{Stdout: int64(len(p))}
+	if w.stderr {
+		delta = IOUsage{Stderr: int64(len(p))}
+	}
+	if err := w.m.add(delta); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// WithQuota calls check with the execution's running I/O counts, and the
+// bytes just counted, as data is read from stdin for the first command and
+// before the output from the last command and all commands' Stderr output
+// is written, e.g. to enforce a tenant's quota across its executions in a
+// multi-tenant service.  If check returns an error, e.g. wrapping
+// ErrQuotaExceeded, the data isn't passed on and the pipeline is killed,
+// failing the execution with the error, wrapped.  check is called with the
+// execution's data flowing, so it must not block for long, but it isn't
+// called concurrently for the same execution.  The execution's input and
+// output are copied through this process to count them, rather than read
+// and written by the commands directly.
+func WithQuota(check func(total IOUsage, delta IOUsage) error) Option {
+	return func(c *config) {
+		m := &ioMeter{c: c, check: check}
+
+		c.onSetup(func(c *config) error {
+			m.meter(c)
+			return nil
+		})
+	}
+}
+
+// OutputQuota returns a quota check for WithQuota that fails once the
+// execution has written more than max bytes of output, counting both the
+// output from the last command and all commands' Stderr output.
+func OutputQuota(max int64) func(total IOUsage, delta IOUsage) error {
+	return func(total IOUsage, delta IOUsage) error {
+		if n := total.Stdout + total.Stderr; n > max {
+			return fmt.Errorf("output of %d bytes exceeds %d: %w", n, max, ErrQuotaExceeded)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestWithQuota(t *testing.T) {
+	var total, deltas IOUsage
+	check := func(t IOUsage, delta IOUsage) error {
+		total = t
+		deltas.Stdin += delta.Stdin
+		deltas.Stdout += delta.Stdout
+		deltas.Stderr += delta.Stderr
+		return nil
+	}
+	var stdout bytes.Buffer
+	_, err := (&Runner{}).ExecPipeline(context.Background(), []*exec.Cmd{
+		exec.Command("sh", "-c", "cat; echo err >&2"),
+		exec.Command("tr", "a-z", "A-Z"),
+	}, WithQuota(check), WithStdin(strings.NewReader("input")), WithStdout(&stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "INPUT" {
+		t.Errorf("stdout = %q, want %q", stdout.String(), "INPUT")
+	}
+	want := IOUsage{Stdin: 5, Stdout: 5, Stderr: 4}
+	if total != want || deltas != want {
+		t.Errorf("total = %+v, deltas = %+v, want %+v", total, deltas, want)
+	}
+}
+
+func TestOutputQuota(t *testing.T) {
+	var stdout bytes.Buffer
+	_, err := (&Runner{}).Exec(context.Background(), exec.Command("sh", "-c", "echo 12345; echo 678 >&2; exec cat /dev/zero"), WithQuota(OutputQuota(10)), WithStdout(&stdout))
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("error = %v, want %v", err, ErrQuotaExceeded)
+	}
+	// Data over the quota isn't passed on, although how much of the output
+	// within it is depends on how the reads split it.
+	if !strings.HasPrefix("12345\n", stdout.String()) {
+		t.Errorf("stdout = %q, want only the output within the quota", stdout.String())
+	}
+}
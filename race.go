@@ -0,0 +1,116 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// RaceResult describes an execution by Runner.ExecRace.
+type RaceResult struct {
+	// Winner is the index of the first alternative to succeed, -1 if
+	// none did.
+	Winner int
+	// Stdout holds the output of the winner.
+	Stdout []byte
+	// Results holds the Result of each alternative, in order, including
+	// those cancelled once the winner succeeded.
+	Results []*Result
+}
+
+// ExecRace executes alternative pipelines concurrently, e.g. `curl` and
+// `wget`, or the same query against several replicas, and takes the output
+// of the first to succeed, see ExecPipeline.  Each alternative's commands
+// are returned by the corresponding function, and executed with opts and
+// its output captured.  Once an alternative succeeds, the others' commands
+// are killed and waited for before returning.  Returns an
+// *ExecAllError holding each alternative's error if all of them fail.
+func (r *Runner) ExecRace(ctx context.Context, alternatives []func() []*exec.Cmd, opts ...Option) (*RaceResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	race := &RaceResult{Winner: -1, Results: make([]*Result, len(alternatives))}
+	errs := make([]error, len(alternatives))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(alternatives))
+	for i, cmds := range alternatives {
+		i, cmds := i, cmds
+		go func() {
+			defer wg.Done()
+
+			var stdout bytes.Buffer
+			altOpts := append(opts[:len(opts):len(opts)], WithStdout(&stdout))
+			res, err := r.ExecPipeline(ctx, cmds(), altOpts...)
+
+			mu.Lock()
+			defer mu.Unlock()
+			race.Results[i], errs[i] = res, err
+			if err == nil && race.Winner < 0 {
+				race.Winner, race.Stdout = i, stdout.Bytes()
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if race.Winner < 0 && len(alternatives) > 0 {
+		return race, &ExecAllError{Errors: errs}
+	}
+	return race, nil
+}
+
+// ExecHedged executes the pipeline returned by cmds, see ExecPipeline, and
+// executes a duplicate returned by another call to cmds if the first hasn't
+// completed within delay, e.g. to cut the latency of tools with occasional
+// stalls.  Whichever completes first is taken, and the other's commands are
+// killed and waited for before returning.  Both are executed with opts and
+// their output captured, so the commands must be safe to run twice.  The
+// RaceResult's Winner is 0 for the first pipeline and 1 for the duplicate,
+// whose Result is nil if it wasn't needed.  Returns the error of the
+// pipeline taken.
+func (r *Runner) ExecHedged(ctx context.Context, delay time.Duration, cmds func() []*exec.Cmd, opts ...Option) (*RaceResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		i      int
+		res    *Result
+		err    error
+		stdout []byte
+	}
+	done := make(chan outcome, 2)
+	run := func(i int) {
+		go func() {
+			var stdout bytes.Buffer
+			runOpts := append(opts[:len(opts):len(opts)], WithStdout(&stdout))
+			res, err := r.ExecPipeline(ctx, cmds(), runOpts...)
+			done <- outcome{i, res, err, stdout.Bytes()}
+		}()
+	}
+
+	race := &RaceResult{Winner: -1, Results: make([]*Result, 2)}
+	var err error
+	run(0)
+	running, hedge := 1, clockOrReal(r.Clock).After(delay)
+	for running > 0 {
+		select {
+		case <-hedge:
+			hedge = nil
+			run(1)
+			running++
+		case o := <-done:
+			running--
+			race.Results[o.i] = o.res
+			if race.Winner < 0 {
+				race.Winner, race.Stdout, err = o.i, o.stdout, o.err
+				hedge = nil
+				cancel()
+			}
+		}
+	}
+	return race, err
+}
@@ -0,0 +1,98 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sh returns a function returning a single stage running script.
+func sh(script string) func() []*exec.Cmd {
+	return func() []*exec.Cmd {
+		return []*exec.Cmd{exec.Command("sh", "-c", script)}
+	}
+}
+
+func TestExecRace(t *testing.T) {
+	start := time.Now()
+	race, err := (&Runner{}).ExecRace(context.Background(), []func() []*exec.Cmd{
+		sh("exec sleep 10"),
+		sh("echo failed; exit 1"),
+		sh("sleep 0.1; echo slow"),
+		func() []*exec.Cmd { return []*exec.Cmd{exec.Command("echo", "fast"), exec.Command("tr", "a-z", "A-Z")} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if race.Winner != 3 || string(race.Stdout) != "FAST\n" {
+		t.Errorf("Winner = %d, Stdout = %q, want 3, %q", race.Winner, race.Stdout, "FAST\n")
+	}
+	if len(race.Results) != 4 {
+		t.Errorf("%d results, want 4", len(race.Results))
+	}
+	// The sleeping alternative is killed once the winner succeeds.
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ExecRace took %v, want the losers killed", elapsed)
+	}
+}
+
+func TestExecRaceAllFail(t *testing.T) {
+	race, err := (&Runner{}).ExecRace(context.Background(), []func() []*exec.Cmd{
+		sh("exit 1"),
+		sh("exit 2"),
+	})
+	var allErr *ExecAllError
+	if !errors.As(err, &allErr) || len(allErr.Errors) != 2 || allErr.Errors[0] == nil || allErr.Errors[1] == nil {
+		t.Fatalf("error = %v, want an *ExecAllError for both alternatives", err)
+	}
+	if race.Winner != -1 || race.Stdout != nil {
+		t.Errorf("Winner = %d, Stdout = %q, want no winner", race.Winner, race.Stdout)
+	}
+
+	if race, err := (&Runner{}).ExecRace(context.Background(), nil); err != nil || race.Winner != -1 {
+		t.Errorf("ExecRace(nil) = %+v, %v, want no winner and no error", race, err)
+	}
+}
+
+func TestExecHedged(t *testing.T) {
+	// calls returns the scripts in turn, counting the calls, which may be
+	// concurrent.
+	var mu sync.Mutex
+	var n int
+	calls := func(scripts ...string) func() []*exec.Cmd {
+		n = 0
+		return func() []*exec.Cmd {
+			mu.Lock()
+			defer mu.Unlock()
+			n++
+			return sh(scripts[n-1])()
+		}
+	}
+
+	race, err := (&Runner{}).ExecHedged(context.Background(), 10*time.Second, calls("echo first"))
+	if err != nil || race.Winner != 0 || string(race.Stdout) != "first\n" {
+		t.Errorf("ExecHedged() = %d, %q, %v, want the first", race.Winner, race.Stdout, err)
+	}
+	if n != 1 || race.Results[1] != nil {
+		t.Errorf("%d calls, want the duplicate not run", n)
+	}
+
+	// A stalled pipeline is hedged, and killed once the duplicate completes.
+	start := time.Now()
+	race, err = (&Runner{}).ExecHedged(context.Background(), 10*time.Millisecond, calls("exec sleep 10", "echo second"))
+	if err != nil || race.Winner != 1 || string(race.Stdout) != "second\n" {
+		t.Errorf("ExecHedged() = %d, %q, %v, want the duplicate", race.Winner, race.Stdout, err)
+	}
+	if elapsed := time.Since(start); n != 2 || elapsed > 5*time.Second {
+		t.Errorf("%d calls in %v, want the stalled pipeline killed", n, elapsed)
+	}
+
+	// The first to complete is taken even if it fails.
+	race, err = (&Runner{}).ExecHedged(context.Background(), 10*time.Second, calls("exit 1"))
+	if err == nil || race.Winner != 0 {
+		t.Errorf("ExecHedged() = %d, %v, want the first's error", race.Winner, err)
+	}
+}
@@ -0,0 +1,143 @@
+package pipes
+
+import (
+	"net"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Readiness is a one-way flag that is set once something is ready, e.g. a
+// server started by a pipeline, typically by a trigger, see WithTrigger, or
+// a probe, see WithTCPProbe, or once it has failed to become ready.  The
+// zero value is not ready.
+type Readiness struct {
+	mu   sync.Mutex
+	done chan struct{}
+	err  error
+}
+
+func (r *Readiness) init() chan struct{} {
+	if r.done == nil {
+		r.done = make(chan struct{})
+	}
+	return r.done
+}
+
+// set marks r as done with err, unless it's already done.
+func (r *Readiness) set(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	done := r.init()
+	select {
+	case <-done:
+	default:
+		r.err = err
+		close(done)
+	}
+}
+
+// Mark marks r as ready, unless it's already ready or failed.
+func (r *Readiness) Mark() {
+	r.set(nil)
+}
+
+// Fail marks r as failed to become ready with err, e.g. because the server
+// exited, unless it's already ready or failed.
+func (r *Readiness) Fail(err error) {
+	r.set(err)
+}
+
+// Ready returns a channel that is closed once r is marked as ready or
+// failed.
+func (r *Readiness) Ready() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.init()
+}
+
+// IsReady returns true if r has been marked as ready.
+func (r *Readiness) IsReady() bool {
+	select {
+	case <-r.Ready():
+		return r.Err() == nil
+	default:
+		return false
+	}
+}
+
+// Err returns the error passed to Fail, if any.
+func (r *Readiness) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// WithStartAfter delays starting the commands at the given stages, or all
+// commands if no stages are given, until ready is marked as ready, e.g. to
+// start a client once a server, started by an earlier stage or another
+// execution, is ready.  The execution fails with ready's error if it's
+// marked as failed instead, or with the context's error if the context is
+// done first, so use a deadline lest a server that never becomes ready
+// hang the execution.
+func WithStartAfter(ready *Readiness, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			select {
+			case <-ready.Ready():
+				if err := ready.Err(); err != nil {
+					return err
+				}
+			case <-c.runCtx.Done():
+				return c.runCtx.Err()
+			}
+			return start()
+		}, stages)
+	}
+}
+
+// WithTCPProbe marks ready as ready once a TCP connection to addr succeeds,
+// probing every interval from when the first command is started until the
+// execution completes, e.g. for a server started by the pipeline that
+// doesn't announce when it's listening.
+func WithTCPProbe(addr string, interval time.Duration, ready *Readiness) Option {
+	return func(c *config) {
+		stop := make(chan struct{})
+		var once sync.Once
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			if err := start(); err != nil {
+				return err
+			}
+			once.Do(func() {
+				go probeTCP(addr, interval, ready, stop)
+			})
+			return nil
+		}, []int{0})
+		c.onRelease(func() {
+			close(stop)
+		})
+	}
+}
+
+func probeTCP(addr string, interval time.Duration, ready *Readiness, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		conn, err := net.DialTimeout("tcp", addr, interval)
+		if err == nil {
+			conn.Close()
+			ready.Mark()
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
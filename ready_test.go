@@ -0,0 +1,46 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestStartAfter(t *testing.T) {
+	var ready Readiness
+	cmds := []*exec.Cmd{exec.Command("true"), exec.Command("true")}
+	done := make(chan error, 1)
+	go func() {
+		_, err := (&Runner{}).ExecPipeline(context.Background(), cmds, WithStartAfter(&ready, 1))
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("pipeline completed before it was ready: %v", err)
+	default:
+	}
+	ready.Mark()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var failed Readiness
+	failed.Fail(errors.New("server exited"))
+	cmd := exec.Command("true")
+	if _, err := (&Runner{}).Exec(context.Background(), cmd, WithStartAfter(&failed)); err == nil || cmd.Process != nil {
+		t.Errorf("Exec() error = %v, started %t, want the readiness error", err, cmd.Process != nil)
+	}
+}
+
+func TestStartAfterDoesntBlockStarts(t *testing.T) {
+	if !inSubreaper(t) {
+		return
+	}
+	checkStartsNotBlocked(t, func(ctx context.Context) {
+		(&Runner{}).Exec(ctx, exec.Command("true"), WithStartAfter(&Readiness{}))
+	})
+}
@@ -0,0 +1,140 @@
+package pipes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// castEvent is an event of an asciinema v2 cast.
+type castEvent struct {
+	typ  string
+	data string
+	// input is the number of bytes of input recorded before the event.
+	input int
+}
+
+// readCast reads the events of an asciinema v2 cast.
+func readCast(r io.Reader) ([]castEvent, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024)
+
+	var header castHeader
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("cast: missing header")
+	}
+	if err := json.Unmarshal(s.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("cast: header: %s", err.Error())
+	}
+	if header.Version != 2 {
+		return nil, fmt.Errorf("cast: unsupported version %d", header.Version)
+	}
+
+	var events []castEvent
+	input := 0
+	for n := 2; s.Scan(); n++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var fields []interface{}
+		if err := json.Unmarshal(s.Bytes(), &fields); err != nil {
+			return nil, fmt.Errorf("cast:%d: %s", n, err.Error())
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("cast:%d: malformed event", n)
+		}
+		typ, ok1 := fields[1].(string)
+		data, ok2 := fields[2].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("cast:%d: malformed event", n)
+		}
+		events = append(events, castEvent{typ: typ, data: data, input: input})
+		if typ == "i" {
+			input += len(data)
+		}
+	}
+	return events, s.Err()
+}
+
+// ReplaySession returns an Expecter that replays the session recorded in
+// cast, an asciinema v2 cast recorded with input, e.g. by a Transcript, so
+// that interactive automation can be regression tested against captured
+// output, e.g. from a real device, without the device.  The recorded
+// output is replayed as fast as the script consumes it, but output recorded
+// after input is withheld until the script has sent that input.  Send fails
+// if the script's input deviates from the recorded input, and Close fails
+// if the script didn't send all of it.
+func ReplaySession(cast io.Reader) (*Expecter, error) {
+	events, err := readCast(cast)
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded []byte
+	for _, ev := range events {
+		if ev.typ == "i" {
+			recorded = append(recorded, ev.data...)
+		}
+	}
+
+	e := newExpecter()
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+	sent, closed := 0, false
+
+	go func() {
+		for _, ev := range events {
+			if ev.typ != "o" {
+				continue
+			}
+			mu.Lock()
+			for sent < ev.input && !closed {
+				cond.Wait()
+			}
+			stop := closed
+			mu.Unlock()
+			if stop {
+				break
+			}
+			e.Write([]byte(ev.data))
+		}
+		e.closeOutput()
+	}()
+
+	e.send = func(p []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if closed {
+			return fmt.Errorf("replay: session is closed")
+		}
+		rest := recorded[sent:]
+		if len(p) > len(rest) || string(p) != string(rest[:len(p)]) {
+			n := len(p)
+			if n > len(rest) {
+				n = len(rest)
+			}
+			return fmt.Errorf("replay: sent %q, recorded %q", p, rest[:n])
+		}
+		sent += len(p)
+		cond.Broadcast()
+		return nil
+	}
+	e.close = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		closed = true
+		cond.Broadcast()
+		if sent < len(recorded) {
+			return fmt.Errorf("replay: recorded input %q not sent", recorded[sent:])
+		}
+		return nil
+	}
+	return e, nil
+}
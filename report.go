@@ -0,0 +1,87 @@
+package pipes
+
+import (
+	"os/exec"
+	"time"
+)
+
+// UsageReport aggregates the resources consumed by an execution into a
+// single record, e.g. for chargeback by a platform running its customers'
+// pipelines, see WithUsageReport.
+type UsageReport struct {
+	RunID string `json:"run_id"`
+	// Labels are the labels passed to WithUsageReport, e.g. identifying
+	// the customer and pipeline.
+	Labels   map[string]string `json:"labels,omitempty"`
+	Start    time.Time         `json:"start"`
+	Duration time.Duration     `json:"duration_ns"`
+	// CPUSeconds is the user and system CPU time consumed by all commands.
+	CPUSeconds float64 `json:"cpu_seconds"`
+	// PeakRSS is the sum of the commands' peak resident set sizes in
+	// bytes, as the commands run concurrently, or zero if unavailable on
+	// this platform.
+	PeakRSS int64 `json:"peak_rss_bytes"`
+	// IO counts the bytes piped into and out of the pipeline.
+	IO     IOUsage      `json:"io"`
+	Stages []StageUsage `json:"stages"`
+}
+
+// StageUsage describes the resources consumed by a command of an
+// execution, see UsageReport.
+type StageUsage struct {
+	Path       string  `json:"path"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+	MaxRSS     int64   `json:"max_rss_bytes"`
+	// ReadBytes and WriteBytes count the bytes read and written by the
+	// command via any kind of file, including the pipes between commands,
+	// and are only available on Linux.
+	ReadBytes  int64 `json:"read_bytes"`
+	WriteBytes int64 `json:"write_bytes"`
+}
+
+// WithUsageReport calls report with a UsageReport of the execution, carrying
+// labels, once it completes, even if it fails.  The execution's input and
+// output are copied through this process to count them, rather than read
+// and written by the commands directly.
+func WithUsageReport(labels map[string]string, report func(rep *UsageReport)) Option {
+	return func(c *config) {
+		m := &ioMeter{c: c}
+		var counters []*ioSnapshot
+
+		c.onSetup(func(c *config) error {
+			counters = make([]*ioSnapshot, len(c.cmds))
+			m.meter(c)
+			return nil
+		})
+
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			snap := snapshotIO(cmd)
+			counters[stageIndex(c.cmds, cmd)] = snap
+			return wait()
+		}, nil)
+
+		c.onResult(func(res *Result) {
+			rep := &UsageReport{
+				RunID:    res.RunID,
+				Labels:   labels,
+				Start:    res.Start,
+				Duration: res.Duration,
+				IO:       m.usage(),
+			}
+			for i, stage := range res.Stages {
+				s := StageUsage{
+					Path:       stage.Path,
+					CPUSeconds: (stage.UserTime + stage.SystemTime).Seconds(),
+					MaxRSS:     stage.MaxRSS,
+				}
+				if i < len(counters) && counters[i] != nil {
+					s.ReadBytes, s.WriteBytes = counters[i].readBytes, counters[i].writeBytes
+				}
+				rep.CPUSeconds += s.CPUSeconds
+				rep.PeakRSS += s.MaxRSS
+				rep.Stages = append(rep.Stages, s)
+			}
+			report(rep)
+		})
+	}
+}
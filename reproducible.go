@@ -0,0 +1,73 @@
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setEnv sets the variable key to value in cmd's environment, inheriting
+// this process's environment if cmd.Env is nil.
+func setEnv(cmd *exec.Cmd, key string, value string) {
+	cmd.Env = append(withoutEnv(cmd, key), key+"="+value)
+}
+
+// WithReproducibleEnv pins the environment variables through which
+// commands' output commonly depends on where and when they run, for the
+// commands at the given stages, or all commands if no stages are given:
+// TZ is set to UTC, LC_ALL to C and, unless epoch is zero,
+// SOURCE_DATE_EPOCH to epoch, e.g. the time of the last commit, which
+// tools honoring https://reproducible-builds.org/specs/source-date-epoch/
+// embed instead of the current time.  Commands that embed the current time
+// regardless can be run under WithFakeTime.
+func WithReproducibleEnv(epoch time.Time, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			setEnv(cmd, "TZ", "UTC")
+			setEnv(cmd, "LC_ALL", "C")
+			if !epoch.IsZero() {
+				setEnv(cmd, "SOURCE_DATE_EPOCH", strconv.FormatInt(epoch.Unix(), 10))
+			}
+			return start()
+		}, stages)
+	}
+}
+
+// WithFakeTime runs the commands at the given stages, or all commands if no
+// stages are given, under faketime(1), which interposes on the C library's
+// time functions via libfaketime, so that the current time appears to be t,
+// with the clock frozen if frozen is set or else running from t.  Commands
+// that make system calls directly, like Go programs, or that are statically
+// linked, see the real time regardless.  Fails to start the commands if
+// faketime isn't installed.  Not supported on Windows.
+func WithFakeTime(t time.Time, frozen bool, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			faketime, err := exec.LookPath("faketime")
+			if err != nil {
+				return errors.New("faketime not found, install libfaketime")
+			}
+
+			// libfaketime parses times in the command's time zone.
+			loc := time.Local
+			if tz, ok := lookupEnv(cmd, "TZ"); ok {
+				if l, err := time.LoadLocation(strings.TrimPrefix(tz, ":")); err == nil {
+					loc = l
+				}
+			}
+			spec := t.In(loc).Format("2006-01-02 15:04:05")
+			if !frozen {
+				spec = "@" + spec
+			}
+
+			path, args := cmd.Path, cmd.Args
+			cmd.Path = faketime
+			cmd.Args = append([]string{"faketime", "-f", spec, path}, args[1:]...)
+			err = start()
+			cmd.Path, cmd.Args = path, args
+			return err
+		}, stages)
+	}
+}
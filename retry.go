@@ -0,0 +1,225 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// limitedBuffer is a bytes.Buffer that refuses writes once max bytes have
+// been buffered, so that replaying a stage's input can't exhaust memory.
+type limitedBuffer struct {
+	buf bytes.Buffer
+	max int64
+	err error
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(b.buf.Len()+len(p)) > b.max {
+		b.err = fmt.Errorf("Output exceeds buffer limit of %d bytes", b.max)
+		return 0, b.err
+	}
+	return b.buf.Write(p)
+}
+
+// ExecPipelineRetry pipes several commands together, optionally reading data
+// from stdin for the first command, and buffers the output of the last
+// command (up to max bytes) in memory.  The buffered output is then fed to a
+// final stage created by calling stage, which is retried up to retries times
+// if it fails, replaying the buffered data on each attempt so that expensive
+// upstream commands are run only once.  If cmds is empty, stdin itself is
+// buffered and replayed.  Output from the final stage is written to stdout
+// only if the attempt succeeds, and all commands' Stderr output is written to
+// stderr.  Returns an error containing the command that failed, on its last
+// attempt for the final stage, as well as the system error string.
+func ExecPipelineRetry(cmds []*exec.Cmd, stage func() *exec.Cmd, retries int, max int64, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if retries < 0 {
+		return fmt.Errorf("Negative retries %d", retries)
+	}
+
+	var err error
+
+	// Buffer the upstream output, failing if it exceeds the limit
+	input := &limitedBuffer{max: max}
+	if len(cmds) > 0 {
+		err = ExecPipeline(cmds, stdin, input, stderr)
+	} else if stdin != nil {
+		_, err = io.Copy(input, stdin)
+	}
+	if input.err != nil {
+		// The upstream command likely died from SIGPIPE, report the
+		// actual cause of the failure instead.
+		return input.err
+	} else if err != nil {
+		return err
+	}
+
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+
+	// Replay the buffered input to each attempt of the final stage, only
+	// forwarding the output of the attempt that succeeds.
+	for attempt := 0; attempt <= retries; attempt++ {
+		var output bytes.Buffer
+
+		if err = Exec(stage(), bytes.NewReader(input.buf.Bytes()), &output, stderr); err == nil {
+			_, err = output.WriteTo(stdout)
+			return err
+		}
+	}
+	return err
+}
+
+// Attempt describes an attempt of an execution retried by Runner.ExecRetry
+// and how its commands differed from the previous attempt's, e.g. to debug
+// why a later attempt succeeded.
+type Attempt struct {
+	// Attempt is the attempt's number, starting at 1.
+	Attempt int `json:"attempt"`
+	// Error is the attempt's error string, if it failed.
+	Error string `json:"error,omitempty"`
+	// Changes describes the commands that differed from the previous
+	// attempt's, as started.
+	Changes []StageChange `json:"changes,omitempty"`
+}
+
+// StageChange describes how a command differed from the same stage's
+// command in the previous attempt.
+type StageChange struct {
+	Stage int `json:"stage"`
+	// Args holds the command's arguments if they changed.
+	Args []string `json:"args,omitempty"`
+	// EnvSet holds the "key=value" environment variables that were added
+	// or changed and EnvUnset the keys of those that were removed.
+	EnvSet   []string `json:"env_set,omitempty"`
+	EnvUnset []string `json:"env_unset,omitempty"`
+}
+
+// startedCmd records a command's arguments and environment as started.
+type startedCmd struct {
+	args []string
+	env  []string
+}
+
+// ExecRetry executes the pipeline returned by cmds, see ExecPipeline,
+// retrying it up to retries times if it fails.  cmds is called with the
+// attempt number, starting at 1, for each attempt, as commands can't be
+// reused.  Each attempt is numbered for its error's breadcrumbs, see
+// WithAttempt.  Options are applied to each attempt, so a reader passed via
+// WithStdin is only read by the first.  Returns the last attempt's Result,
+// whose Attempts record the attempts' errors and how each attempt's
+// commands differed from the previous attempt's, including changes made by
+// start hooks, and its error.
+func (r *Runner) ExecRetry(ctx context.Context, retries int, cmds func(attempt int) []*exec.Cmd, opts ...Option) (*Result, error) {
+	var attempts []Attempt
+	var prev []startedCmd
+
+	for attempt := 1; ; attempt++ {
+		pipeline := cmds(attempt)
+		started := make([]startedCmd, len(pipeline))
+
+		// Record the commands once started, outermost so that the
+		// changes made by all other start hooks are seen.
+		record := func(c *config) {
+			c.onStart(func(cmd *exec.Cmd, start func() error) error {
+				err := start()
+				env := cmd.Env
+				if env == nil {
+					env = os.Environ()
+				}
+				started[stageIndex(c.cmds, cmd)] = startedCmd{
+					args: append([]string(nil), cmd.Args...),
+					env:  append([]string(nil), env...),
+				}
+				return err
+			}, nil)
+		}
+		attemptOpts := append([]Option{record}, opts...)
+		attemptOpts = append(attemptOpts, WithAttempt(attempt))
+
+		res, err := r.ExecPipeline(ctx, pipeline, attemptOpts...)
+		a := Attempt{Attempt: attempt}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		if prev != nil {
+			a.Changes = diffStarted(prev, started)
+		}
+		attempts = append(attempts, a)
+		prev = started
+
+		if err == nil || attempt > retries || ctx.Err() != nil {
+			res.Attempts = attempts
+			return res, err
+		}
+	}
+}
+
+// diffStarted returns the changes from prev to cur, ignoring stages that
+// weren't started in either.
+func diffStarted(prev []startedCmd, cur []startedCmd) []StageChange {
+	var changes []StageChange
+	for i := range cur {
+		if i >= len(prev) || prev[i].args == nil || cur[i].args == nil {
+			continue
+		}
+		change := StageChange{Stage: i}
+		if !equalStrings(prev[i].args, cur[i].args) {
+			change.Args = cur[i].args
+		}
+
+		before, after := envMap(prev[i].env), envMap(cur[i].env)
+		for _, kv := range cur[i].env {
+			key := kv[:strings.IndexByte(kv+"=", '=')]
+			if value, ok := before[key]; !ok || value != after[key] {
+				change.EnvSet = append(change.EnvSet, key+"="+after[key])
+				// Record duplicated keys only once.
+				before[key] = after[key]
+			}
+		}
+		for _, kv := range prev[i].env {
+			key := kv[:strings.IndexByte(kv+"=", '=')]
+			if _, ok := after[key]; !ok {
+				change.EnvUnset = append(change.EnvUnset, key)
+				after[key] = ""
+			}
+		}
+
+		if change.Args != nil || change.EnvSet != nil || change.EnvUnset != nil {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// envMap returns the variables in env, where the last of duplicated keys
+// wins, as in exec.Cmd.
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			m[kv[:i]] = kv[i+1:]
+		} else {
+			m[kv] = ""
+		}
+	}
+	return m
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
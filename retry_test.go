@@ -0,0 +1,96 @@
+package pipes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingStage returns a stage function whose first failures attempts echo
+// their input and fail, after which they echo it and succeed.
+func failingStage(failures int, attempts *int) func() *exec.Cmd {
+	return func() *exec.Cmd {
+		*attempts++
+		if *attempts <= failures {
+			return exec.Command("sh", "-c", "cat; exit 1")
+		}
+		return exec.Command("cat")
+	}
+}
+
+func TestExecPipelineRetry(t *testing.T) {
+	// Count the upstream runs, which must happen only once.
+	runs := filepath.Join(t.TempDir(), "runs")
+	upstream := func() []*exec.Cmd {
+		return []*exec.Cmd{exec.Command("sh", "-c", "echo >>"+runs+"; echo data")}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		failures int
+		retries  int
+		wantErr  bool
+	}{
+		{"success", 0, 2, false},
+		{"retry then success", 2, 2, false},
+		{"retries exhausted", 3, 2, true},
+	} {
+		if err := ioutil.WriteFile(runs, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var attempts int
+		var stdout bytes.Buffer
+		err := ExecPipelineRetry(upstream(), failingStage(tt.failures, &attempts), tt.retries, 1024, nil, &stdout, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+
+		wantAttempts, wantOut := tt.failures+1, "data\n"
+		if tt.wantErr {
+			wantAttempts, wantOut = tt.retries+1, ""
+		}
+		if attempts != wantAttempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, attempts, wantAttempts)
+		}
+		// Only the output of the attempt that succeeds is written.
+		if stdout.String() != wantOut {
+			t.Errorf("%s: stdout = %q, want %q", tt.name, stdout.String(), wantOut)
+		}
+		if data, _ := ioutil.ReadFile(runs); string(data) != "\n" {
+			t.Errorf("%s: upstream ran %d times, want once", tt.name, len(data))
+		}
+	}
+}
+
+func TestExecPipelineRetryBufferLimit(t *testing.T) {
+	var attempts int
+	err := ExecPipelineRetry([]*exec.Cmd{exec.Command("head", "-c", "100000", "/dev/zero")}, failingStage(0, &attempts), 1, 1000, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "Output exceeds buffer limit of 1000 bytes") {
+		t.Errorf("error = %v, want the buffer limit exceeded", err)
+	}
+	if attempts != 0 {
+		t.Errorf("%d attempts, want the final stage not to run", attempts)
+	}
+
+	// Stdin is buffered if there are no upstream commands.
+	var stdout bytes.Buffer
+	if err := ExecPipelineRetry(nil, failingStage(1, &attempts), 1, 4, strings.NewReader("data"), &stdout, nil); err != nil || stdout.String() != "data" {
+		t.Errorf("stdout = %q, error = %v, want the replayed stdin", stdout.String(), err)
+	}
+	if err := ExecPipelineRetry(nil, failingStage(0, &attempts), 1, 3, strings.NewReader("data"), nil, nil); err == nil {
+		t.Error("no error for stdin over the buffer limit")
+	}
+}
+
+func TestExecPipelineRetryNegative(t *testing.T) {
+	var attempts int
+	if err := ExecPipelineRetry(nil, failingStage(0, &attempts), -1, 1024, nil, nil, nil); err == nil {
+		t.Error("no error for negative retries")
+	}
+	if attempts != 0 {
+		t.Errorf("%d attempts, want none", attempts)
+	}
+}
@@ -0,0 +1,172 @@
+package pipes
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingWriter is an io.WriteCloser that appends to a log file, e.g. for
+// the output of a supervised long-running command, and rotates the file once
+// it grows beyond MaxSize bytes or has been written to for longer than
+// MaxAge.  Rotated files are renamed with a timestamp suffix, optionally
+// compressed with gzip, and only the newest MaxBackups rotated files are
+// kept.  Zero values for MaxSize, MaxAge or MaxBackups mean no limit.  The
+// file is opened on the first write.
+type RotatingWriter struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	// bg serializes background compression and pruning.
+	bg sync.Mutex
+	wg sync.WaitGroup
+}
+
+// NewRotatingWriter returns a RotatingWriter for the log file at path that
+// rotates the file when it exceeds maxSize bytes or maxAge.
+func NewRotatingWriter(path string, maxSize int64, maxAge time.Duration) *RotatingWriter {
+	return &RotatingWriter{Path: path, MaxSize: maxSize, MaxAge: maxAge}
+}
+
+func (w *RotatingWriter) open() error {
+	f, err := os.OpenFile(w.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size, w.opened = f, fi.Size(), time.Now()
+	return nil
+}
+
+// Write appends p to the log file, rotating it first if needed.
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	full := w.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.MaxSize
+	stale := w.MaxAge > 0 && time.Since(w.opened) >= w.MaxAge
+	if full || stale {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current log file and opens a new one.  Must be called
+// with mu held.
+func (w *RotatingWriter) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.f = nil
+
+	rotated := w.Path + "." + time.Now().Format("20060102-150405.000000000")
+	if err := os.Rename(w.Path, rotated); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	// Compress and prune in the background so as not to stall the writer.
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		w.bg.Lock()
+		defer w.bg.Unlock()
+
+		if w.Compress {
+			compressFile(rotated)
+		}
+		w.prune()
+	}()
+	return nil
+}
+
+// compressFile gzips path to path.gz, removing path on success.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune removes the oldest rotated files beyond MaxBackups.
+func (w *RotatingWriter) prune() {
+	if w.MaxBackups <= 0 {
+		return
+	}
+
+	// Rotated files sort chronologically thanks to their timestamp
+	// suffix, compressed or not.
+	rotated, err := filepath.Glob(w.Path + ".[0-9]*")
+	if err != nil || len(rotated) <= w.MaxBackups {
+		return
+	}
+	sort.Strings(rotated)
+	for _, path := range rotated[:len(rotated)-w.MaxBackups] {
+		os.Remove(path)
+	}
+}
+
+// Close closes the log file, waiting for any background compression to
+// complete.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	if w.f != nil {
+		err = w.f.Close()
+		w.f = nil
+	}
+	w.wg.Wait()
+	return err
+}
@@ -0,0 +1,19 @@
+package pipes
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// startReadOnlyView starts cmd in a sandbox denying writes beneath dirs,
+// except beneath scratch.
+func startReadOnlyView(cmd *exec.Cmd, dirs []string, scratch string, start func() error) (func(), error) {
+	var rules string
+	for _, dir := range dirs {
+		rules += "(deny file-write* (subpath " + strconv.Quote(dir) + "))"
+	}
+	if scratch != "" {
+		rules += "(allow file-write* (subpath " + strconv.Quote(scratch) + "))"
+	}
+	return func() {}, startSandboxed(cmd, rules, start)
+}
@@ -0,0 +1,70 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startReadOnlyView starts cmd in a new mount namespace in which dirs are
+// bind mounted read-only, and scratch is bind mounted on top, writable.
+// Bubblewrap does the mounting unless this process is root.
+func startReadOnlyView(cmd *exec.Cmd, dirs []string, scratch string, start func() error) (func(), error) {
+	if os.Geteuid() != 0 {
+		return func() {}, startBwrap(cmd, dirs, scratch, start)
+	}
+
+	return startOnThread(cmd, func() error {
+		// The mount namespace is per-thread, and inherited by the child.
+		if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+			return fmt.Errorf("unsharing mount namespace: %s", err.Error())
+		}
+		if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("making mounts private: %s", err.Error())
+		}
+		for _, dir := range dirs {
+			if err := syscall.Mount(dir, dir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+				return fmt.Errorf("bind mounting %s: %s", dir, err.Error())
+			}
+			if err := syscall.Mount("", dir, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+				return fmt.Errorf("remounting %s read-only: %s", dir, err.Error())
+			}
+		}
+		if scratch != "" {
+			// Bind mounts inherit the read-only flag of their source.
+			if err := syscall.Mount(scratch, scratch, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+				return fmt.Errorf("bind mounting %s: %s", scratch, err.Error())
+			}
+			if err := syscall.Mount("", scratch, "", syscall.MS_BIND|syscall.MS_REMOUNT, ""); err != nil {
+				return fmt.Errorf("remounting %s writable: %s", scratch, err.Error())
+			}
+		}
+		return nil
+	}, start)
+}
+
+// startBwrap starts cmd under bwrap(1), with a view of the file system in
+// which dirs are read-only except scratch, restoring cmd's path and
+// arguments once it's started.
+func startBwrap(cmd *exec.Cmd, dirs []string, scratch string, start func() error) error {
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return errors.New("read-only views require root or bubblewrap")
+	}
+
+	path, args := cmd.Path, cmd.Args
+	cmd.Path = bwrap
+	cmd.Args = []string{"bwrap", "--dev-bind", "/", "/"}
+	for _, dir := range dirs {
+		cmd.Args = append(cmd.Args, "--ro-bind", dir, dir)
+	}
+	if scratch != "" {
+		cmd.Args = append(cmd.Args, "--bind", scratch, scratch)
+	}
+	cmd.Args = append(append(cmd.Args, "--", path), args[1:]...)
+	err = start()
+	cmd.Path, cmd.Args = path, args
+	return err
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func startReadOnlyView(cmd *exec.Cmd, dirs []string, scratch string, start func() error) (func(), error) {
+	return nil, errors.New("read-only views not supported on this platform")
+}
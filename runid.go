@@ -0,0 +1,44 @@
+package pipes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os/exec"
+)
+
+// RunIDEnv is the environment variable set to the execution's run ID by
+// WithRunIDEnv.
+const RunIDEnv = "PIPES_RUN_ID"
+
+// newRunID returns a random 128-bit run ID in hex.
+func newRunID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// WithRunID sets the ID uniquely identifying the execution, e.g. to that of
+// a request it serves, instead of a random one.  The run ID is reported in
+// the Result, and hence to the Runner's AuditSink, see HistoryQuery.RunID,
+// and by the Admin, so that records of the same execution can be
+// correlated.
+func WithRunID(id string) Option {
+	return func(c *config) {
+		c.runID = id
+	}
+}
+
+// WithRunIDEnv sets the environment variable PIPES_RUN_ID to the
+// execution's run ID for the commands at the given stages, or all commands
+// if no stages are given, e.g. so that the commands' logs can be correlated
+// with the execution's records.
+func WithRunIDEnv(stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			setEnv(cmd, RunIDEnv, c.runID)
+			return start()
+		}, stages)
+	}
+}
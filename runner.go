@@ -0,0 +1,578 @@
+package pipes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Runner executes commands and pipelines subject to policies shared by all
+// of its executions.  The zero value is ready to use and imposes no limits.
+type Runner struct {
+	// Limiter, if non-nil, bounds the number of child processes that run
+	// concurrently.  A Limiter may be shared by multiple Runners.
+	Limiter *Limiter
+
+	// Breaker, if non-nil, fast-fails executions of commands that have
+	// been failing consistently.
+	Breaker *Breaker
+
+	// Audit, if non-nil, receives a record of every execution.
+	Audit AuditSink
+
+	// Clock, if non-nil, is used instead of the real clock to time
+	// executions, e.g. by tests.
+	Clock Clock
+
+	// Name, if non-empty, identifies the Runner in the breadcrumbs of
+	// its executions' errors, see BreadcrumbError.
+	Name string
+
+	// Paths, if non-nil, caches the resolution of command names by
+	// Runner.Command.
+	Paths *PathCache
+
+	// jobs holds the running background jobs, see Runner.Jobs.
+	jobsMu  sync.Mutex
+	jobs    []*Job
+	lastJob int
+}
+
+// Result describes an execution of a command or pipeline by a Runner.  A
+// Result can be marshaled to JSON, e.g. to persist execution records, in
+// which case the captured output is rendered as strings.
+type Result struct {
+	// RunID uniquely identifies the execution, see WithRunID.
+	RunID string `json:"run_id"`
+	// Label is the execution's label, see WithLabel.
+	Label string `json:"label,omitempty"`
+	// Stages holds the result of each command, in pipeline order.
+	Stages []StageResult `json:"stages"`
+	// Start is the time at which the first command was started.
+	Start time.Time `json:"start"`
+	// Duration is the time taken by the pipeline, from Start until all
+	// commands completed.
+	Duration time.Duration `json:"duration_ns"`
+	// QueueWait is the time spent waiting on the Runner's Limiter before
+	// any command was started.
+	QueueWait time.Duration `json:"queue_wait_ns"`
+	// Stdout and Stderr hold the tail of the pipeline's output if it was
+	// captured, see WithTail.
+	Stdout []byte `json:"-"`
+	Stderr []byte `json:"-"`
+	// PartialStdout holds the Stdout written by a failed execution before
+	// it failed, empty if none, and is nil unless the execution failed,
+	// see WithPartialOutput.  PartialTruncated is set if only the start
+	// of that output was kept.
+	PartialStdout    []byte `json:"-"`
+	PartialTruncated bool   `json:"partial_truncated,omitempty"`
+	// StdoutType and StderrType describe the output, if any, see
+	// WithOutputSniffing.
+	StdoutType *OutputType `json:"stdout_type,omitempty"`
+	StderrType *OutputType `json:"stderr_type,omitempty"`
+	// StdinFeed describes how stdin was fed to the first command, if
+	// WithMmapStdin was used.
+	StdinFeed StdinFeed `json:"stdin_feed,omitempty"`
+	// Workdir is the temporary directory in which the commands were run,
+	// if any, see WithTempWorkdir.
+	Workdir string `json:"workdir,omitempty"`
+	// Diagnostics describes the commands that died unexpectedly, see
+	// WithDiagnostics.
+	Diagnostics []Diagnostics `json:"diagnostics,omitempty"`
+	// Attempts describes each attempt of a retried execution, see
+	// Runner.ExecRetry.
+	Attempts []Attempt `json:"attempts,omitempty"`
+}
+
+// Close releases the resources held by the Result once the caller is done
+// with it, i.e. removes its Workdir, if any.
+func (r *Result) Close() error {
+	if r.Workdir == "" {
+		return nil
+	}
+	err := os.RemoveAll(r.Workdir)
+	r.Workdir = ""
+	return err
+}
+
+// MarshalJSON encodes the Result as JSON, rendering the captured output as
+// strings instead of base64, unless the output is binary.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type result Result
+	out := struct {
+		result
+		Stdout       string `json:"stdout,omitempty"`
+		Stderr       string `json:"stderr,omitempty"`
+		StdoutBase64 []byte `json:"stdout_base64,omitempty"`
+		StderrBase64 []byte `json:"stderr_base64,omitempty"`
+		// PartialStdout is a pointer so that empty partial output is
+		// told apart from none.
+		PartialStdout       *string `json:"partial_stdout,omitempty"`
+		PartialStdoutBase64 []byte  `json:"partial_stdout_base64,omitempty"`
+	}{result: result(r)}
+
+	if isBinary(r.Stdout, true, false) {
+		out.StdoutBase64 = r.Stdout
+	} else {
+		out.Stdout = string(r.Stdout)
+	}
+	if isBinary(r.Stderr, true, false) {
+		out.StderrBase64 = r.Stderr
+	} else {
+		out.Stderr = string(r.Stderr)
+	}
+	if isBinary(r.PartialStdout, false, true) {
+		out.PartialStdoutBase64 = r.PartialStdout
+	} else if r.PartialStdout != nil {
+		partial := string(r.PartialStdout)
+		out.PartialStdout = &partial
+	}
+	return json.Marshal(out)
+}
+
+// StageResult describes a single command in an execution.
+type StageResult struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	// Pid is the command's process ID, or zero if it wasn't started.
+	Pid int `json:"pid,omitempty"`
+	// ExitCode is the command's exit code, or -1 if it didn't exit, e.g.
+	// was killed by a signal or wasn't started.
+	ExitCode int `json:"exit_code"`
+	// UserTime and SystemTime are the CPU time consumed by the command.
+	UserTime   time.Duration `json:"user_time_ns"`
+	SystemTime time.Duration `json:"system_time_ns"`
+	// MaxRSS is the command's peak resident set size in bytes, or zero if
+	// unavailable on this platform.
+	MaxRSS int64 `json:"max_rss_bytes,omitempty"`
+	// TraceFile is the path of the command's trace, if traced, see
+	// WithTrace.
+	TraceFile string `json:"trace_file,omitempty"`
+	// Usage summarizes the resources consumed by the command, if
+	// collected, see WithUsage.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// newStageResult returns the StageResult for cmd, which may not have been
+// started.
+func newStageResult(cmd *exec.Cmd) StageResult {
+	stage := StageResult{Path: cmd.Path, Args: cmd.Args, ExitCode: -1}
+	if cmd.Process != nil {
+		stage.Pid = cmd.Process.Pid
+	}
+	if ps := cmd.ProcessState; ps != nil {
+		stage.ExitCode = ps.ExitCode()
+		stage.UserTime = ps.UserTime()
+		stage.SystemTime = ps.SystemTime()
+		stage.MaxRSS = maxRSS(ps)
+	}
+	return stage
+}
+
+// config holds the settings for a single execution by a Runner.
+type config struct {
+	// cmds are the commands being executed, available to setup hooks.
+	cmds []*exec.Cmd
+
+	stdin     io.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+	priority  int
+	runID     string
+	label     string
+	principal string
+
+	stageLabels []string
+	attempt     int
+	// failedStage is the index plus one of the first command that failed
+	// to start or complete, zero if none.
+	failedStage int
+
+	tail      bool
+	tailLines int
+	tailBytes int
+	errorTail int
+
+	workdir     string
+	diagnostics []Diagnostics
+
+	// runCtx is done once the commands are killed, for start hooks.
+	runCtx context.Context
+
+	// cancel kills the commands once set, see abort.
+	abortMu sync.Mutex
+	cancel  context.CancelFunc
+	aborted error
+
+	// setup hooks are run in order before any command is started, finish
+	// hooks are run in reverse order once the execution completes.
+	setup  []func(c *config) error
+	finish []func(err error) error
+
+	// start and wait hooks wrap starting and waiting for commands,
+	// outermost first.
+	start []stageHook
+	wait  []stageHook
+
+	// result hooks are run in order once the Result is complete.
+	result []func(res *Result)
+}
+
+// stageHook wraps starting or waiting for the commands at the given stages,
+// or all commands if stages is empty.  fn must call next to actually start
+// or wait for cmd.
+type stageHook struct {
+	stages []int
+	fn     func(cmd *exec.Cmd, next func() error) error
+}
+
+// applies returns true if the hook wraps the i'th command.
+func (h *stageHook) applies(i int) bool {
+	if len(h.stages) == 0 {
+		return true
+	}
+	for _, stage := range h.stages {
+		if stage == i {
+			return true
+		}
+	}
+	return false
+}
+
+// onSetup registers fn to be run before any command is started, e.g. to
+// acquire resources needed by the execution.
+func (c *config) onSetup(fn func(c *config) error) {
+	c.setup = append(c.setup, fn)
+}
+
+// onFinish registers fn to be run once the execution completes, or fails to
+// start, with the execution's error.  fn returns the error to report, e.g.
+// to release resources and report failures to do so.
+func (c *config) onFinish(fn func(err error) error) {
+	c.finish = append(c.finish, fn)
+}
+
+// onRelease registers release to be called once the execution completes.
+func (c *config) onRelease(release func()) {
+	c.onFinish(func(err error) error {
+		release()
+		return err
+	})
+}
+
+// onResult registers fn to be run once the Result is complete, e.g. to add
+// per-stage details to it.
+func (c *config) onResult(fn func(res *Result)) {
+	c.result = append(c.result, fn)
+}
+
+// onStart registers fn to wrap starting the commands at the given stages,
+// or all commands if no stages are given, e.g. to adjust process-wide state
+// that the child inherits.
+func (c *config) onStart(fn func(cmd *exec.Cmd, start func() error) error, stages []int) {
+	c.start = append(c.start, stageHook{stages: stages, fn: fn})
+}
+
+// onWait registers fn to wrap waiting for the commands at the given stages,
+// or all commands if no stages are given, e.g. to inspect a command that
+// has exited before it is reaped.
+func (c *config) onWait(fn func(cmd *exec.Cmd, wait func() error) error, stages []int) {
+	c.wait = append(c.wait, stageHook{stages: stages, fn: fn})
+}
+
+// runHooks calls fn for cmd, the i'th command, via the applicable hooks.
+func runHooks(hooks []stageHook, i int, cmd *exec.Cmd, fn func() error) error {
+	for j := len(hooks) - 1; j >= 0; j-- {
+		if h := &hooks[j]; h.applies(i) {
+			next := fn
+			fn = func() error {
+				return h.fn(cmd, next)
+			}
+		}
+	}
+	return fn()
+}
+
+// startCmd starts cmd, the i'th command, via the applicable start hooks.
+func (c *config) startCmd(i int, cmd *exec.Cmd) error {
+	return c.failed(i, runHooks(c.start, i, cmd, func() error {
+		if err := beforeFork(cmd); err != nil {
+			return err
+		}
+		return forkCmd(cmd)
+	}))
+}
+
+// waitCmd waits for cmd, the i'th command, via the applicable wait hooks.
+func (c *config) waitCmd(i int, cmd *exec.Cmd) error {
+	return c.failed(i, runHooks(c.wait, i, cmd, cmd.Wait))
+}
+
+// failed records the i'th command as having failed if err is non-nil and
+// no command failed before, returning err.
+func (c *config) failed(i int, err error) error {
+	if err != nil && c.failedStage == 0 {
+		c.failedStage = i + 1
+	}
+	return err
+}
+
+// abort kills the commands, failing the execution with err, e.g. because
+// of the commands' output.  Only the first call has an effect.
+func (c *config) abort(err error) {
+	c.abortMu.Lock()
+	defer c.abortMu.Unlock()
+
+	if c.aborted == nil && c.cancel != nil {
+		c.aborted = err
+		c.cancel()
+	}
+}
+
+// abortErr returns the error passed to abort, if any.
+func (c *config) abortErr() error {
+	c.abortMu.Lock()
+	defer c.abortMu.Unlock()
+
+	return c.aborted
+}
+
+func (c *config) runSetup() error {
+	for _, fn := range c.setup {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *config) runFinish(err error) error {
+	for i := len(c.finish) - 1; i >= 0; i-- {
+		err = c.finish[i](err)
+	}
+	return err
+}
+
+// Option configures a single execution by a Runner.
+type Option func(*config)
+
+// WithStdin reads data from r for the first command's stdin.
+func WithStdin(r io.Reader) Option {
+	return func(c *config) {
+		c.stdin = r
+	}
+}
+
+// WithStdout writes the output from the last command to w.  Stdout is
+// discarded by default.
+func WithStdout(w io.Writer) Option {
+	return func(c *config) {
+		c.stdout = w
+	}
+}
+
+// WithStderr writes all commands' Stderr output to w.  Stderr is discarded
+// by default.
+func WithStderr(w io.Writer) Option {
+	return func(c *config) {
+		c.stderr = w
+	}
+}
+
+// lockedWriter serializes writes to w, e.g. shared by stdout and stderr.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// WithStderrToStdout writes all commands' Stderr output along with the
+// output from the last command, like "2>&1" at the end of a shell pipeline,
+// in place of any WithStderr.  Applies to the stdout set by options before
+// it.
+func WithStderrToStdout() Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			switch c.stdout.(type) {
+			case nil:
+				c.stderr = nil
+			case *os.File:
+				c.stderr = c.stdout
+			default:
+				c.stdout = &lockedWriter{w: c.stdout}
+				c.stderr = c.stdout
+			}
+			return nil
+		})
+	}
+}
+
+// WithPriority sets the priority of the execution when it is queued by the
+// Runner's Limiter.  Queued executions with a higher priority are started
+// before those with a lower priority, e.g. so that interactive requests
+// aren't stuck behind background batch jobs.  The default priority is zero.
+func WithPriority(priority int) Option {
+	return func(c *config) {
+		c.priority = priority
+	}
+}
+
+// WithLabel sets a label identifying the execution, e.g. to the Runner's
+// Breaker.
+func WithLabel(label string) Option {
+	return func(c *config) {
+		c.label = label
+	}
+}
+
+// WithStartHook calls fn before starting each command, with the command's
+// index in the pipeline, e.g. for tests to inject latency or failures.  An
+// error returned by fn fails the execution without starting the command.
+func WithStartHook(fn func(stage int, cmd *exec.Cmd) error) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			if err := fn(stageIndex(c.cmds, cmd), cmd); err != nil {
+				return err
+			}
+			return start()
+		}, nil)
+	}
+}
+
+// Exec executes a single command, see ExecPipeline.
+func (r *Runner) Exec(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	return r.ExecPipeline(ctx, []*exec.Cmd{cmd}, opts...)
+}
+
+// ExecPipeline pipes several commands together, waiting for the Runner's
+// Limiter, if any, to admit the pipeline before starting any command.  All
+// commands are killed if ctx is done before the pipeline completes.  Returns
+// a Result describing the execution, which is non-nil even on failure, and
+// an error containing the command that failed as well as the system error
+// string, the context's error if ctx is done while the pipeline is queued,
+// or ErrBreakerOpen, wrapped, if the pipeline is rejected by the Runner's
+// Breaker.
+func (r *Runner) ExecPipeline(ctx context.Context, cmds []*exec.Cmd, opts ...Option) (*Result, error) {
+	var c config
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.runID == "" {
+		c.runID = newRunID()
+	}
+
+	res, err := r.execPipeline(ctx, cmds, &c)
+	err = c.breadcrumbs(r.Name, err)
+	if r.Audit != nil {
+		r.Audit.Audit(newAuditRecord(clockOrReal(r.Clock).Now(), &c, res, err))
+	}
+	return res, err
+}
+
+func (r *Runner) execPipeline(ctx context.Context, cmds []*exec.Cmd, c *config) (*Result, error) {
+	res := &Result{RunID: c.runID, Label: c.label}
+	clock := clockOrReal(r.Clock)
+
+	var key string
+	if r.Breaker != nil {
+		key = breakerKey(c.label, cmds)
+		if !r.Breaker.allow(key) {
+			return res, fmt.Errorf("%s %w", key, ErrBreakerOpen)
+		}
+	}
+
+	if r.Limiter != nil {
+		n := r.Limiter.weight(cmds)
+
+		queued := clock.Now()
+		if err := r.Limiter.acquire(ctx, n, c.priority); err != nil {
+			res.QueueWait = clock.Now().Sub(queued)
+			if r.Breaker != nil {
+				r.Breaker.cancel(key)
+			}
+			return res, err
+		}
+		defer r.Limiter.release(n)
+		res.QueueWait = clock.Now().Sub(queued)
+	}
+
+	res.Start = clock.Now()
+	ran := false
+	c.cmds = cmds
+	err := c.runSetup()
+	if err == nil {
+		var stdoutTail, stderrTail *TailBuffer
+		if c.tail {
+			stdoutTail = NewTailBuffer(c.tailLines, c.tailBytes)
+			stderrTail = NewTailBuffer(c.tailLines, c.tailBytes)
+			c.stdout = teeWriter(c.stdout, stdoutTail)
+			c.stderr = teeWriter(c.stderr, stderrTail)
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		c.runCtx = runCtx
+		c.abortMu.Lock()
+		c.cancel = cancel
+		c.abortMu.Unlock()
+
+		err = execPipeline(runCtx, cmds, c.stdin, c.stdout, c.stderr, c.startCmd, c.waitCmd)
+		ran = true
+		if aborted := c.abortErr(); aborted != nil {
+			err = fmt.Errorf("%s %w", cmds[0].Path, aborted)
+		}
+		cancel()
+
+		if c.tail {
+			res.Stdout, res.Stderr = stdoutTail.Bytes(), stderrTail.Bytes()
+			if err != nil {
+				err = &Error{Err: err, Stdout: res.Stdout, Stderr: res.Stderr, TailSize: c.errorTail}
+			}
+		}
+	}
+
+	// Failing to set up the execution or the caller giving up doesn't
+	// count against the commands themselves.
+	if r.Breaker != nil {
+		if ran && ctx.Err() == nil {
+			r.Breaker.record(key, err != nil)
+		} else {
+			r.Breaker.cancel(key)
+		}
+	}
+	err = c.runFinish(err)
+	res.Duration = clock.Now().Sub(res.Start)
+	res.Workdir = c.workdir
+
+	// Commands killed because the caller gave up, or because they were
+	// aborted, didn't die unexpectedly.
+	if ctx.Err() == nil && c.abortErr() == nil {
+		res.Diagnostics = c.diagnostics
+	}
+
+	for _, cmd := range cmds {
+		res.Stages = append(res.Stages, newStageResult(cmd))
+	}
+	for _, fn := range c.result {
+		fn(res)
+	}
+	return res, err
+}
+
+// teeWriter returns a writer that writes to both w, which may be nil, and
+// capture.
+func teeWriter(w io.Writer, capture io.Writer) io.Writer {
+	if w == nil {
+		return capture
+	}
+	return io.MultiWriter(w, capture)
+}
@@ -0,0 +1,82 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// hookRecorder records the order in which hooks run.
+type hookRecorder struct {
+	mu     sync.Mutex
+	events map[string][]string
+}
+
+func (h *hookRecorder) record(key string, event string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events[key] = append(h.events[key], event)
+}
+
+// hooks returns an Option registering hooks named name for the given
+// stages.
+func (h *hookRecorder) hooks(name string, stages ...int) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			h.record("setup", name)
+			return nil
+		})
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			key := fmt.Sprintf("start %d", stageIndex(c.cmds, cmd))
+			h.record(key, name+" before")
+			err := start()
+			h.record(key, name+" after")
+			return err
+		}, stages)
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			key := fmt.Sprintf("wait %d", stageIndex(c.cmds, cmd))
+			h.record(key, name+" before")
+			err := wait()
+			h.record(key, name+" after")
+			return err
+		}, stages)
+		c.onFinish(func(err error) error {
+			h.record("finish", name)
+			if err == nil {
+				return errors.New(name)
+			}
+			return fmt.Errorf("%s: %w", name, err)
+		})
+		c.onResult(func(res *Result) {
+			h.record("result", name)
+		})
+	}
+}
+
+func TestHookOrder(t *testing.T) {
+	h := &hookRecorder{events: make(map[string][]string)}
+	cmds := []*exec.Cmd{exec.Command("echo"), exec.Command("cat")}
+	_, err := (&Runner{}).ExecPipeline(context.Background(), cmds, h.hooks("a"), h.hooks("b", 1))
+
+	// The first option's start and wait hooks are outermost, and its finish
+	// hook runs last, with the error returned by the later ones.
+	if err == nil || err.Error() != "a: b" {
+		t.Errorf("ExecPipeline() error = %v, want %q", err, "a: b")
+	}
+	want := map[string][]string{
+		"setup":   {"a", "b"},
+		"start 0": {"a before", "a after"},
+		"start 1": {"a before", "b before", "b after", "a after"},
+		"wait 0":  {"a before", "a after"},
+		"wait 1":  {"a before", "b before", "b after", "a after"},
+		"finish":  {"b", "a"},
+		"result":  {"a", "b"},
+	}
+	if !reflect.DeepEqual(h.events, want) {
+		t.Errorf("hooks ran in order\n%v\nwant\n%v", h.events, want)
+	}
+}
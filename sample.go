@@ -0,0 +1,109 @@
+package pipes
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Sampling chooses which lines a Sampler keeps.  Either or both limits may
+// be set; zero means no limit.
+type Sampling struct {
+	// Every keeps only every Every'th line, starting with the first.
+	Every int
+	// PerSecond keeps at most PerSecond lines per second.
+	PerSecond int
+	// NUL, if set, samples NUL terminated records, as output by e.g.
+	// `find -print0`, instead of lines.
+	NUL bool
+	// Clock, if non-nil, is used instead of the real clock, e.g. by
+	// tests.
+	Clock Clock
+}
+
+// Sampler is a writer that forwards a sample of the lines written to it,
+// e.g. to keep a verbose command's output from overwhelming a log pipeline,
+// and counts the lines it drops.  Use it with WithStdout, WithStderr or
+// WithTee.
+type Sampler struct {
+	w  io.Writer
+	s  Sampling
+	lw *lineWriter
+
+	mu      sync.Mutex
+	seen    int64
+	dropped int64
+	// kept lines have been kept in the second starting at window.
+	window time.Time
+	kept   int
+	err    error
+}
+
+// NewSampler returns a Sampler that forwards the lines sampled per s to w.
+func NewSampler(w io.Writer, s Sampling) *Sampler {
+	sm := &Sampler{w: w, s: s}
+	sm.lw = newRecordWriter(sm.delim(), sm.line)
+	return sm
+}
+
+// delim returns the byte terminating the sampled records.
+func (sm *Sampler) delim() byte {
+	if sm.s.NUL {
+		return 0
+	}
+	return '\n'
+}
+
+func (sm *Sampler) line(line []byte) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.seen++
+	keep := sm.s.Every <= 1 || (sm.seen-1)%int64(sm.s.Every) == 0
+	if keep && sm.s.PerSecond > 0 {
+		now := clockOrReal(sm.s.Clock).Now()
+		if now.Sub(sm.window) >= time.Second {
+			sm.window, sm.kept = now, 0
+		}
+		if sm.kept >= sm.s.PerSecond {
+			keep = false
+		} else {
+			sm.kept++
+		}
+	}
+	if !keep || sm.err != nil {
+		sm.dropped++
+		return
+	}
+	if _, err := sm.w.Write(append(append([]byte(nil), line...), sm.delim())); err != nil {
+		sm.err = err
+	}
+}
+
+// Write splits p into lines and forwards the sampled ones.  A trailing
+// partial line is held until it's completed or the Sampler is closed.
+func (sm *Sampler) Write(p []byte) (int, error) {
+	sm.lw.Write(p)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return len(p), sm.err
+}
+
+// Dropped returns the number of lines dropped so far.
+func (sm *Sampler) Dropped() int64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.dropped
+}
+
+// Close samples any trailing partial line, as a complete line, and returns
+// the first error writing sampled lines, if any.
+func (sm *Sampler) Close() error {
+	sm.lw.flush()
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.err
+}
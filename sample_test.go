@@ -0,0 +1,52 @@
+package pipes
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSamplerEvery(t *testing.T) {
+	var out bytes.Buffer
+	sm := NewSampler(&out, Sampling{Every: 3})
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(sm, "%d\n", i)
+	}
+	// The trailing partial line is sampled on Close.
+	fmt.Fprint(sm, "6")
+	fmt.Fprint(sm, "7")
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "0\n3\n67\n" || sm.Dropped() != 4 {
+		t.Errorf("output = %q, dropped %d, want every third line", out.String(), sm.Dropped())
+	}
+}
+
+func TestSamplerPerSecond(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	var out bytes.Buffer
+	sm := NewSampler(&out, Sampling{PerSecond: 2, Clock: clock})
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(sm, "%d\n", i)
+	}
+	clock.now = clock.now.Add(time.Second)
+	fmt.Fprint(sm, "4\n5\n6\n")
+	if out.String() != "0\n1\n4\n5\n" || sm.Dropped() != 3 {
+		t.Errorf("output = %q, dropped %d, want two lines per second", out.String(), sm.Dropped())
+	}
+}
+
+func TestSamplerError(t *testing.T) {
+	sm := NewSampler(failingWriter{}, Sampling{})
+	if _, err := fmt.Fprint(sm, "a\nb\n"); err == nil {
+		t.Error("no error writing to failing writer")
+	}
+	if err := sm.Close(); err == nil {
+		t.Error("Close didn't return the error")
+	}
+	if n := sm.Dropped(); n != 1 {
+		t.Errorf("Dropped() = %d, want the lines after the error", n)
+	}
+}
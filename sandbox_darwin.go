@@ -0,0 +1,22 @@
+package pipes
+
+import (
+	"os/exec"
+)
+
+// startSandboxed starts cmd under sandbox-exec(1) with a profile allowing
+// everything but what rules deny, merging them into the profile of cmd's
+// sandbox if it's already wrapped by another option, and restores cmd's
+// path and arguments once it's started.
+func startSandboxed(cmd *exec.Cmd, rules string, start func() error) error {
+	path, args := cmd.Path, cmd.Args
+	if len(args) > 3 && args[0] == "sandbox-exec" && args[1] == "-p" {
+		cmd.Args = append([]string{args[0], args[1], args[2] + rules}, args[3:]...)
+	} else {
+		cmd.Path = "/usr/bin/sandbox-exec"
+		cmd.Args = append([]string{"sandbox-exec", "-p", "(version 1)(allow default)" + rules, path}, args[1:]...)
+	}
+	err := start()
+	cmd.Path, cmd.Args = path, args
+	return err
+}
@@ -0,0 +1,183 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// Overlap determines what a Scheduler does when a job is due while its
+// previous run is still executing.
+type Overlap int
+
+const (
+	// OverlapSkip skips the due run.
+	OverlapSkip Overlap = iota
+	// OverlapQueue runs the due run once the previous run completes.
+	OverlapQueue
+	// OverlapCancel cancels the previous run and starts the due run once
+	// the previous run has exited.
+	OverlapCancel
+)
+
+// Scheduler runs pipelines on recurring schedules, e.g. for lightweight
+// in-process job running.  Jobs are registered with Add and run while Run
+// is executing.
+type Scheduler struct {
+	// Runner executes the jobs, or a zero Runner if nil.
+	Runner *Runner
+	// OnResult, if non-nil, is called with the Result and error of each
+	// run once it completes.  It's called concurrently for different jobs.
+	OnResult func(name string, res *Result, err error)
+
+	mu      sync.Mutex
+	jobs    map[string]*schedJob
+	running bool
+	// ctx is the context of Run, nil once it's done.
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+type schedJob struct {
+	s        *Scheduler
+	name     string
+	schedule Schedule
+	overlap  Overlap
+	cmds     func() []*exec.Cmd
+	opts     []Option
+
+	running bool
+	queued  int
+	cancel  context.CancelFunc
+}
+
+// Add registers a job that runs the pipeline returned by cmds whenever
+// schedule activates, see ParseCron and Every, with overlapping runs handled
+// per overlap.  cmds is called for each run as commands can't be reused.
+// The run's label is set to name unless opts set another.  Jobs may be
+// added while the Scheduler is running.  Returns an error if a job of the
+// same name was already added.
+func (s *Scheduler) Add(name string, schedule Schedule, overlap Overlap, cmds func() []*exec.Cmd, opts ...Option) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %s already scheduled", name)
+	}
+	if s.jobs == nil {
+		s.jobs = make(map[string]*schedJob)
+	}
+	j := &schedJob{
+		s:        s,
+		name:     name,
+		schedule: schedule,
+		overlap:  overlap,
+		cmds:     cmds,
+		opts:     append([]Option{WithLabel(name)}, opts...),
+	}
+	s.jobs[name] = j
+	if s.ctx != nil {
+		s.wg.Add(1)
+		go j.loop(s.ctx)
+	}
+	return nil
+}
+
+// Run runs the registered jobs until ctx is done, then cancels the runs in
+// flight and waits for them to complete before returning ctx's error.
+// Returns an error if the Scheduler is already running.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("scheduler is already running")
+	}
+	s.running, s.ctx = true, ctx
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go j.loop(ctx)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	s.mu.Lock()
+	s.ctx = nil
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+	return ctx.Err()
+}
+
+func (s *Scheduler) runner() *Runner {
+	if s.Runner == nil {
+		return &Runner{}
+	}
+	return s.Runner
+}
+
+// loop waits for the job's activations until ctx is done.
+func (j *schedJob) loop(ctx context.Context) {
+	defer j.s.wg.Done()
+
+	clock := clockOrReal(j.s.runner().Clock)
+	for {
+		now := clock.Now()
+		next := j.schedule.Next(now)
+		if next.IsZero() {
+			return
+		}
+		select {
+		case <-clock.After(next.Sub(now)):
+			j.due(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// due runs the job or handles the overlap with its previous run.
+func (j *schedJob) due(ctx context.Context) {
+	j.s.mu.Lock()
+	defer j.s.mu.Unlock()
+
+	if !j.running {
+		j.start(ctx)
+		return
+	}
+	switch j.overlap {
+	case OverlapQueue:
+		j.queued++
+	case OverlapCancel:
+		j.cancel()
+		j.queued = 1
+	}
+}
+
+// start starts a run, called with the Scheduler's mutex held.
+func (j *schedJob) start(ctx context.Context) {
+	runCtx, cancel := context.WithCancel(ctx)
+	j.running, j.cancel = true, cancel
+
+	j.s.wg.Add(1)
+	go func() {
+		defer j.s.wg.Done()
+
+		res, err := j.s.runner().ExecPipeline(runCtx, j.cmds(), j.opts...)
+		cancel()
+		if j.s.OnResult != nil {
+			j.s.OnResult(j.name, res, err)
+		}
+
+		j.s.mu.Lock()
+		defer j.s.mu.Unlock()
+		j.running = false
+		if j.queued > 0 && ctx.Err() == nil {
+			j.queued--
+			j.start(ctx)
+		}
+	}()
+}
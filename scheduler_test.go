@@ -0,0 +1,102 @@
+package pipes
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runScheduler runs a Scheduler with a single job for d, returning the
+// results of its runs.
+func runScheduler(t *testing.T, d time.Duration, schedule Schedule, overlap Overlap, cmds func() []*exec.Cmd) []error {
+	t.Helper()
+	var mu sync.Mutex
+	var errs []error
+	s := &Scheduler{OnResult: func(name string, res *Result, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if name != "job" || res.Label != "job" {
+			t.Errorf("result of %s labeled %q, want job", name, res.Label)
+		}
+		errs = append(errs, err)
+	}}
+	if err := s.Add("job", schedule, overlap, cmds); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("job", schedule, overlap, cmds); err == nil {
+		t.Error("no error adding job twice")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	go func() {
+		time.Sleep(d / 2)
+		if err := s.Run(ctx); err == nil {
+			t.Error("no error running Scheduler twice")
+		}
+	}()
+	if err := s.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	return errs
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	for _, overlap := range []Overlap{OverlapSkip, OverlapQueue} {
+		// The command fails if another run is in progress.
+		lock := filepath.Join(t.TempDir(), "lock")
+		exclusive := func() []*exec.Cmd {
+			return []*exec.Cmd{exec.Command("sh", "-c", "mkdir "+lock+" && sleep 0.1 && rmdir "+lock)}
+		}
+		errs := runScheduler(t, 500*time.Millisecond, Every(20*time.Millisecond), overlap, exclusive)
+		if len(errs) < 2 || len(errs) > 5 {
+			t.Errorf("overlap %d: %d runs, want about 4", overlap, len(errs))
+		}
+		for _, err := range errs[:len(errs)-1] {
+			if err != nil {
+				t.Errorf("overlap %d: %v", overlap, err)
+			}
+		}
+	}
+
+	// Runs are canceled by the next one.
+	errs := runScheduler(t, 500*time.Millisecond, Every(100*time.Millisecond), OverlapCancel, func() []*exec.Cmd {
+		return []*exec.Cmd{exec.Command("sleep", "10")}
+	})
+	if len(errs) < 3 {
+		t.Errorf("%d runs, want the runs to be canceled", len(errs))
+	}
+	for _, err := range errs {
+		if err == nil {
+			t.Error("canceled run succeeded")
+		}
+	}
+}
+
+func TestSchedulerAddWhileRunning(t *testing.T) {
+	s := &Scheduler{}
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	ran := make(chan struct{}, 10)
+	if err := s.Add("late", Every(10*time.Millisecond), OverlapSkip, func() []*exec.Cmd {
+		ran <- struct{}{}
+		return []*exec.Cmd{exec.Command("true")}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Error("job added while running didn't run")
+	}
+	cancel()
+	<-done
+}
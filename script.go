@@ -0,0 +1,122 @@
+package pipes
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// isShellSafe returns true if s needs no quoting in a shell word.
+func isShellSafe(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("@%+=:,./_-", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// quote quotes a single shell word.
+func quote(s string) string {
+	if isShellSafe(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Quote returns args quoted as shell words, separated by spaces, such that
+// a POSIX shell splits the result back into exactly args.  Arguments that
+// need no quoting are left as is.
+func Quote(args ...string) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = quote(arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// commandScript renders cmd as a shell command, including its environment,
+// if not inherited, and its working directory.
+func commandScript(cmd *exec.Cmd) string {
+	argv := append([]string{cmd.Path}, cmd.Args[1:]...)
+
+	script := Quote(argv...)
+	if cmd.Env != nil {
+		script = "env -i " + Quote(cmd.Env...) + " " + script
+	}
+	if cmd.Dir != "" {
+		script = "(cd " + quote(cmd.Dir) + " && exec " + script + ")"
+	}
+	return script
+}
+
+// BashScript renders the pipeline as a bash script that runs exactly the
+// same commands, with the same arguments, environment, working directories
+// and redirections, e.g. so that what a service ran can be copied, pasted
+// and re-run by hand.  The script fails if any command fails, like the
+// pipeline.
+func (p *Pipeline) BashScript() string {
+	line, body := p.render(commandScript, true)
+	return "#!/usr/bin/env bash\nset -o pipefail\n" + line + body + "\n"
+}
+
+// render renders the pipeline as a command line, with each command rendered
+// by cmdScript, and the bodies of its here-documents, which follow the
+// line.  If bash is set, Stderr redirections apply to every command, as in
+// the pipeline, rather than the last.
+func (p *Pipeline) render(cmdScript func(cmd *exec.Cmd) string, bash bool) (line, body string) {
+	stages := make([]string, len(p.Cmds))
+	for i, cmd := range p.Cmds {
+		if i < len(p.Groups) && p.Groups[i] != nil {
+			group, groupBody := p.Groups[i].render(cmdScript, bash)
+			// Keep "((" from being taken for arithmetic.
+			if strings.HasPrefix(group, "(") {
+				group = " " + group
+			}
+			stages[i], body = "("+group+")", body+groupBody
+		} else {
+			stages[i] = cmdScript(cmd)
+		}
+		if i == 0 {
+			if p.Stdin != "" {
+				stages[0] += " < " + quote(p.Stdin)
+			}
+			if p.Input != "" {
+				redirect, inputBody := inputRedirect(p.Input)
+				stages[0], body = stages[0]+redirect, body+inputBody
+			}
+		}
+	}
+
+	var stdout string
+	if p.Stdout != "" {
+		stdout = " > " + quote(p.Stdout)
+		if p.Append {
+			stdout = " >> " + quote(p.Stdout)
+		}
+	}
+	line = strings.Join(stages, " | ")
+	switch {
+	case !bash:
+		line += stdout
+		if p.Stderr != "" {
+			line += " 2> " + quote(p.Stderr)
+		}
+		if p.MergeStderr {
+			line += " 2>&1"
+		}
+	case p.Stderr != "":
+		line = "{ " + line + stdout + "; } 2> " + quote(p.Stderr)
+	case p.MergeStderr:
+		// Every command's stderr, not only the last's.
+		line = "{ " + line + "; }" + stdout + " 2>&1"
+	default:
+		line += stdout
+	}
+	return line, body
+}
@@ -0,0 +1,136 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Secrets resolves secrets by name, e.g. from Vault or a KMS, for WithSecrets
+// and WithSecretStdin.  The caller owns the returned secret, and may zero
+// it.
+type Secrets interface {
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// SecretsFunc adapts a function to the Secrets interface.
+type SecretsFunc func(ctx context.Context, name string) ([]byte, error)
+
+// Secret calls f.
+func (f SecretsFunc) Secret(ctx context.Context, name string) ([]byte, error) {
+	return f(ctx, name)
+}
+
+// secretOpen and secretClose delimit a placeholder for a secret.
+const (
+	secretOpen  = "{{secret:"
+	secretClose = "}}"
+)
+
+// SecretPlaceholder returns a placeholder for the named secret, for use in
+// the value of an environment variable in a command's Env, e.g.
+//
+//	cmd.Env = append(os.Environ(), "GITHUB_TOKEN="+pipes.SecretPlaceholder("github/token"))
+//
+// which WithSecrets replaces by the secret only as the command is started.
+func SecretPlaceholder(name string) string {
+	return secretOpen + name + secretClose
+}
+
+// resolveSecrets returns env with the placeholders for secrets replaced by
+// the secrets resolved via s, or nil if there are none.
+func resolveSecrets(ctx context.Context, s Secrets, env []string) ([]string, error) {
+	var resolved []string
+	for i, kv := range env {
+		var sb strings.Builder
+		rest := kv
+		for {
+			j := strings.Index(rest, secretOpen)
+			if j < 0 {
+				break
+			}
+			k := strings.Index(rest[j:], secretClose)
+			if k < 0 {
+				break
+			}
+			name := rest[j+len(secretOpen) : j+k]
+			secret, err := s.Secret(ctx, name)
+			if err != nil {
+				return nil, fmt.Errorf("secret %q: %s", name, err.Error())
+			}
+			if bytes.IndexByte(secret, 0) >= 0 {
+				return nil, fmt.Errorf("secret %q %s", name, errNUL.Error())
+			}
+			sb.WriteString(rest[:j])
+			sb.Write(secret)
+			rest = rest[j+k+len(secretClose):]
+		}
+		if sb.Len() == 0 && rest == kv {
+			continue
+		}
+		if resolved == nil {
+			resolved = append([]string(nil), env...)
+		}
+		sb.WriteString(rest)
+		resolved[i] = sb.String()
+	}
+	return resolved, nil
+}
+
+// WithSecrets replaces the placeholders for secrets, see SecretPlaceholder,
+// in the environment of each command by the secrets resolved via s as the
+// command is started, restoring the placeholders once it's started, so
+// that secrets are never rendered by Pipeline.BashScript, recorded by
+// ExecRetry or resolved for commands that aren't started.  Fails the
+// execution if a secret can't be resolved.
+func WithSecrets(s Secrets) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			env := cmd.Env
+			if env == nil {
+				env = os.Environ()
+			}
+			resolved, err := resolveSecrets(c.runCtx, s, env)
+			if err != nil || resolved == nil {
+				if err != nil {
+					return err
+				}
+				return start()
+			}
+
+			placeholders := cmd.Env
+			cmd.Env = resolved
+			err = start()
+			cmd.Env = placeholders
+			return err
+		}, nil)
+	}
+}
+
+// WithSecretStdin feeds the named secret, resolved via s as the first
+// command is started, to its stdin in place of any other input, e.g. for
+// "docker login --password-stdin", rather than passing it in arguments,
+// which other users can see.  The secret is zeroed once the execution
+// completes.
+func WithSecretStdin(s Secrets, name string) Option {
+	return func(c *config) {
+		var secret []byte
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			var err error
+			if secret, err = s.Secret(c.runCtx, name); err != nil {
+				return fmt.Errorf("secret %q: %s", name, err.Error())
+			}
+			cmd.Stdin = bytes.NewReader(secret)
+			return start()
+		}, []int{0})
+		c.onFinish(func(err error) error {
+			for i := range secret {
+				secret[i] = 0
+			}
+			return err
+		})
+	}
+}
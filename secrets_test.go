@@ -0,0 +1,74 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// testSecrets resolves the secrets in the map.
+func testSecrets(secrets map[string]string) Secrets {
+	return SecretsFunc(func(ctx context.Context, name string) ([]byte, error) {
+		s, ok := secrets[name]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return []byte(s), nil
+	})
+}
+
+func TestWithSecrets(t *testing.T) {
+	s := testSecrets(map[string]string{"user": "alice", "token": "s3cr3t", "nul": "a\x00b"})
+
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", `echo "$AUTH $PLAIN"`)
+	cmd.Env = []string{"AUTH=" + SecretPlaceholder("user") + ":" + SecretPlaceholder("token"), "PLAIN={{secret:"}
+	if _, err := (&Runner{}).Exec(context.Background(), cmd, WithSecrets(s), WithStdout(&out)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "alice:s3cr3t {{secret:\n" {
+		t.Errorf("output = %q, want the secrets substituted", out.String())
+	}
+	if cmd.Env[0] != "AUTH={{secret:user}}:{{secret:token}}" {
+		t.Errorf("Env = %q after the start, want the placeholders", cmd.Env)
+	}
+
+	// Commands whose secrets can't be resolved aren't started.
+	for _, name := range []string{"missing", "nul"} {
+		cmd := exec.Command("true")
+		cmd.Env = []string{"X=" + SecretPlaceholder(name)}
+		if _, err := (&Runner{}).Exec(context.Background(), cmd, WithSecrets(s)); err == nil || cmd.Process != nil {
+			t.Errorf("secret %q: Exec() error = %v, started %t", name, err, cmd.Process != nil)
+		}
+	}
+}
+
+func TestWithSecretStdin(t *testing.T) {
+	s := testSecrets(map[string]string{"password": "hunter2"})
+	var out bytes.Buffer
+	if _, err := (&Runner{}).Exec(context.Background(), exec.Command("cat"), WithSecretStdin(s, "password"), WithStdout(&out)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hunter2" {
+		t.Errorf("stdin = %q, want the secret", out.String())
+	}
+}
+
+func TestSecretsDontBlockStarts(t *testing.T) {
+	if !inSubreaper(t) {
+		return
+	}
+	checkStartsNotBlocked(t, func(ctx context.Context) {
+		// A secret store that doesn't respond until the execution is
+		// canceled.
+		slow := SecretsFunc(func(ctx context.Context, name string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		cmd := exec.Command("true")
+		cmd.Env = []string{"X=" + SecretPlaceholder("x")}
+		(&Runner{}).Exec(ctx, cmd, WithSecrets(slow))
+	})
+}
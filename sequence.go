@@ -0,0 +1,176 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Step is a command in a Sequence.
+type Step struct {
+	// Name identifies the step, e.g. in its StepResult.
+	Name string
+	// Cmd returns the step's command, and is only called if the step
+	// runs.
+	Cmd func(s *SequenceState) (*exec.Cmd, error)
+	// Enabled, if non-nil, decides at run time whether the step runs,
+	// e.g. to compress the output only if it's large.  A skipped step
+	// passes its input on to the next step unchanged.
+	Enabled func(s *SequenceState) bool
+	// Capture, if non-empty, names the variable in which the step's
+	// output is stored, without trailing newlines, like `X=$(cmd)`,
+	// instead of being fed to the next step, which reads no input.
+	Capture string
+}
+
+// Template returns a Step.Cmd executing the named program with arguments,
+// and environment variables in addition to this process's, expanded from
+// text/template templates applied to the sequence's variables, see
+// Command, e.g. to use the output captured by an earlier step:
+//
+//	pipes.Step{Cmd: pipes.Template("git", pipes.Args("checkout", "{{.Branch}}"), nil)}
+//
+// Each env template expands to a single "key=value" variable.
+func Template(name string, args []string, env []string) func(s *SequenceState) (*exec.Cmd, error) {
+	return func(s *SequenceState) (*exec.Cmd, error) {
+		cmd, err := Command(name, args, s.Vars)
+		if err != nil {
+			return nil, err
+		}
+		if len(env) == 0 {
+			return cmd, nil
+		}
+		cmd.Env = os.Environ()
+		for i, text := range env {
+			kv, err := expandTemplate(name, text, s.Vars)
+			if err != nil {
+				return nil, templateError(name, "environment variable", i, err)
+			}
+			cmd.Env = append(cmd.Env, kv)
+		}
+		return cmd, nil
+	}
+}
+
+// SequenceState is the state of a Sequence's execution, on which its steps
+// can decide before they run.
+type SequenceState struct {
+	// Vars holds the sequence's variables.
+	Vars map[string]string
+	// Steps holds the results of the steps run or skipped so far.
+	Steps []StepResult
+	// InputSize is the size of the next step's input, i.e. of the output
+	// of the last step run, or -1 if unknown, before the first step.
+	InputSize int64
+}
+
+// StepResult describes a step in an execution of a Sequence.
+type StepResult struct {
+	Name    string `json:"name,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+	// Result is the step's Result, nil if it was skipped.
+	Result *Result `json:"result,omitempty"`
+	// OutputSize is the size of the step's output, or of its input if it
+	// was skipped.
+	OutputSize int64 `json:"output_size"`
+}
+
+// Sequence is a declarative series of commands, each run to completion
+// before the next is started and fed the output of the previous, like a
+// pipeline whose stages run one at a time, i.e. `cmd1 >tmp; cmd2 <tmp`, so
+// that each step can decide on the results of the previous ones.
+type Sequence struct {
+	Steps []Step
+	// Vars holds the initial variables, copied by each execution.
+	Vars map[string]string
+	// SpoolAbove, if positive, spools the output of a step that exceeds
+	// SpoolAbove bytes to a temporary file, see NewCapture, rather than
+	// holding it in memory until the next step runs.
+	SpoolAbove int64
+}
+
+// ExecSequence executes seq's steps in order, optionally reading data from
+// stdin for the first step and writing the output of the last step, or the
+// last input if it's skipped, to stdout, which is discarded if nil.  Each
+// step is executed via Exec with opts, and passed the variables captured
+// by earlier steps via the SequenceState.  Stops at the first step that
+// fails.  Returns the StepResult of each step run or skipped and the
+// failing step's error.
+func (r *Runner) ExecSequence(ctx context.Context, seq *Sequence, stdin io.Reader, stdout io.Writer, opts ...Option) ([]StepResult, error) {
+	s := &SequenceState{Vars: make(map[string]string, len(seq.Vars)), InputSize: -1}
+	for k, v := range seq.Vars {
+		s.Vars[k] = v
+	}
+
+	input := stdin
+	// prev holds the current input, once a step has run.
+	var prev *Capture
+	defer func() {
+		if prev != nil {
+			prev.Close()
+		}
+	}()
+
+	last := len(seq.Steps) - 1
+	for i, step := range seq.Steps {
+		if step.Enabled != nil && !step.Enabled(s) {
+			s.Steps = append(s.Steps, StepResult{Name: step.Name, Skipped: true, OutputSize: s.InputSize})
+			continue
+		}
+
+		cmd, err := step.Cmd(s)
+		if err != nil {
+			return s.Steps, fmt.Errorf("Step %d %s: %s", i, step.Name, err.Error())
+		}
+
+		var capture *Capture
+		var out io.Writer
+		if i == last && step.Capture == "" {
+			out = stdout
+		} else {
+			if capture, err = NewCapture(0, seq.SpoolAbove, ""); err != nil {
+				return s.Steps, err
+			}
+			out = capture
+		}
+		if out == nil {
+			out = ioutil.Discard
+		}
+		var written int64
+		out = &countWriter{out, &written}
+
+		stepOpts := append(opts[:len(opts):len(opts)], WithStdin(input), WithStdout(out))
+		res, err := r.Exec(ctx, cmd, stepOpts...)
+		s.Steps = append(s.Steps, StepResult{Name: step.Name, Result: res, OutputSize: written})
+		if prev != nil {
+			prev.Close()
+		}
+		prev, input, s.InputSize = capture, nil, written
+		if err != nil {
+			return s.Steps, err
+		}
+		if step.Capture != "" {
+			data, err := capture.Bytes()
+			if err != nil {
+				return s.Steps, err
+			}
+			s.Vars[step.Capture] = strings.TrimRight(string(data), "\n")
+			capture.Close()
+			prev, s.InputSize = nil, 0
+		} else if capture != nil {
+			input = capture.Reader()
+		}
+	}
+
+	// Pass on the input of skipped trailing steps.
+	if stdout != nil && input != nil && (last < 0 || s.Steps[last].Skipped) {
+		if _, err := io.Copy(stdout, input); err != nil {
+			return s.Steps, err
+		}
+	}
+	return s.Steps, nil
+}
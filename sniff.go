@@ -0,0 +1,96 @@
+package pipes
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"unicode/utf8"
+)
+
+// sniffLen is the number of leading bytes of output examined by
+// WithOutputSniffing, as many as http.DetectContentType considers.
+const sniffLen = 512
+
+// OutputType describes the kind of output a command produced.
+type OutputType struct {
+	// Binary is set if the output isn't UTF-8 text.
+	Binary bool `json:"binary"`
+	// ContentType is the output's MIME type, if sniffed.
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// isBinary returns true if b contains NUL bytes or isn't valid UTF-8.  If b
+// may begin or end in the middle of a UTF-8 sequence, because it's the tail
+// or the head of the output, partial sequences there are tolerated.
+func isBinary(b []byte, tail bool, head bool) bool {
+	if bytes.IndexByte(b, 0) >= 0 {
+		return true
+	}
+	for i := 0; tail && i < utf8.UTFMax-1 && len(b) > 0 && !utf8.RuneStart(b[0]); i++ {
+		b = b[1:]
+	}
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			return !head || utf8.FullRune(b)
+		}
+		b = b[size:]
+	}
+	return false
+}
+
+// headWriter retains the first sniffLen bytes written to it.
+type headWriter struct {
+	mu   sync.Mutex
+	head []byte
+	n    int64
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if room := sniffLen - len(w.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		w.head = append(w.head, p[:room]...)
+	}
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// outputType returns the type of the output seen, nil if there was none.
+func (w *headWriter) outputType(contentType bool) *OutputType {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.n == 0 {
+		return nil
+	}
+	t := &OutputType{Binary: isBinary(w.head, false, w.n > int64(len(w.head)))}
+	if contentType {
+		t.ContentType = http.DetectContentType(w.head)
+	}
+	return t
+}
+
+// WithOutputSniffing examines the beginning of the execution's output and
+// Stderr output to tell binary from text, and, if contentType is set, sniff
+// its MIME type, see http.DetectContentType.  The results are available via
+// the Result's StdoutType and StderrType.
+func WithOutputSniffing(contentType bool) Option {
+	return func(c *config) {
+		stdout, stderr := &headWriter{}, &headWriter{}
+
+		c.onSetup(func(c *config) error {
+			c.stdout = teeWriter(c.stdout, stdout)
+			c.stderr = teeWriter(c.stderr, stderr)
+			return nil
+		})
+		c.onResult(func(res *Result) {
+			res.StdoutType = stdout.outputType(contentType)
+			res.StderrType = stderr.outputType(contentType)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package pipes
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// SocketPair is a connected pair of Unix sockets, one end of which is passed
+// to a command, see WithSocketPair, and the other of which is used by this
+// process, e.g. for a control protocol alongside the command's stdio.
+type SocketPair struct {
+	conn  net.Conn
+	child *os.File
+}
+
+// NewSocketPair returns a new SocketPair of the given type: "unix" for a
+// stream, "unixgram" for datagrams or "unixpacket" for sequenced packets.
+// Only supported on Unix.
+func NewSocketPair(typ string) (*SocketPair, error) {
+	return newSocketPair(typ)
+}
+
+// Conn returns this process's end of the pair.  For "unixgram" and
+// "unixpacket" pairs, it's a *net.UnixConn that preserves message
+// boundaries.
+func (p *SocketPair) Conn() net.Conn {
+	return p.conn
+}
+
+// Close closes both ends of the pair, as far as this process is concerned.
+func (p *SocketPair) Close() error {
+	p.child.Close()
+	return p.conn.Close()
+}
+
+// WithSocketPair passes the child end of p to the command at the given
+// stage as an extra file, see exec.Cmd.ExtraFiles.  If env is non-empty,
+// the environment variable env is set to the file's descriptor number in
+// the child, e.g. "CONTROL_FD=3".  The child end is closed in this process
+// once the command is started, so that reading this process's end of a
+// "unix" or "unixpacket" pair returns EOF once the command exits; datagram
+// sockets have no EOF.
+func WithSocketPair(p *SocketPair, env string, stage int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			fd := 3 + len(cmd.ExtraFiles)
+			cmd.ExtraFiles = append(cmd.ExtraFiles, p.child)
+			if env != "" {
+				if cmd.Env == nil {
+					cmd.Env = os.Environ()
+				}
+				cmd.Env = append(cmd.Env, env+"="+strconv.Itoa(fd))
+			}
+			err := start()
+			p.child.Close()
+			return err
+		}, []int{stage})
+	}
+}
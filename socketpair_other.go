@@ -0,0 +1,10 @@
+//go:build !unix
+
+package pipes
+
+import "errors"
+
+// newSocketPair fails, as socket pairs are only supported on Unix.
+func newSocketPair(typ string) (*SocketPair, error) {
+	return nil, errors.New("socket pairs not supported on this platform")
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package pipes
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+func newSocketPair(typ string) (*SocketPair, error) {
+	var sotype int
+	switch typ {
+	case "unix":
+		sotype = syscall.SOCK_STREAM
+	case "unixgram":
+		sotype = syscall.SOCK_DGRAM
+	case "unixpacket":
+		sotype = syscall.SOCK_SEQPACKET
+	default:
+		return nil, fmt.Errorf("unsupported socket type %q", typ)
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, sotype, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socketpair", err)
+	}
+	syscall.CloseOnExec(fds[0])
+	syscall.CloseOnExec(fds[1])
+
+	// FileConn dups the descriptor, so close the original.
+	parent := os.NewFile(uintptr(fds[0]), "socketpair")
+	defer parent.Close()
+	conn, err := net.FileConn(parent)
+	if err != nil {
+		syscall.Close(fds[1])
+		return nil, err
+	}
+	return &SocketPair{conn: conn, child: os.NewFile(uintptr(fds[1]), "socketpair")}, nil
+}
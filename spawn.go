@@ -0,0 +1,62 @@
+package pipes
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+var (
+	devNullOnce sync.Once
+	devNullFile *os.File
+	devNullErr  error
+)
+
+// devNull returns a handle to the null device shared by all executions,
+// which is never closed.
+func devNull() (*os.File, error) {
+	devNullOnce.Do(func() {
+		devNullFile, devNullErr = os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	})
+	return devNullFile, devNullErr
+}
+
+// isDiscard returns true if w discards everything written to it.
+func isDiscard(w io.Writer) bool {
+	if pw, ok := w.(pipedWriter); ok {
+		w = pw.w
+	}
+	return w == ioutil.Discard
+}
+
+// WithLeanSpawn trims the work done by this process around spawning each
+// command, for services running thousands of tiny commands per second.
+// os/exec already spawns with posix_spawn semantics where it matters, e.g.
+// via vfork on Linux unless the command is placed in a new user namespace,
+// so the remaining overhead is in setting up the command's stdio: output
+// that would be discarded is written by the command to the null device
+// rather than to a pipe drained by a goroutine, and a single, shared handle
+// to the null device replaces opening it for every command without stdin.
+// The commands are still started via exec.Cmd.
+func WithLeanSpawn() Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			null, err := devNull()
+			if err != nil {
+				return start()
+			}
+			if cmd.Stdin == nil {
+				cmd.Stdin = null
+			}
+			if isDiscard(cmd.Stdout) {
+				cmd.Stdout = null
+			}
+			if isDiscard(cmd.Stderr) {
+				cmd.Stderr = null
+			}
+			return start()
+		}, nil)
+	}
+}
@@ -0,0 +1,213 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// ErrSpeculationAborted is returned for speculative executions that were
+// aborted, see Speculation.Abort.
+var ErrSpeculationAborted = errors.New("speculation aborted")
+
+// Speculation is a pipeline whose first stages run ahead while the caller
+// decides whether to run the rest, e.g. while an interactive UI waits for
+// the user's confirmation, see Runner.Speculate.
+type Speculation struct {
+	decide chan bool
+	once   sync.Once
+	done   chan struct{}
+	res    *Result
+	err    error
+}
+
+// specBuffer buffers up to limit bytes of the output of the stages run
+// ahead until the rest of the pipeline is started.
+type specBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	chunks [][]byte
+	size   int
+	limit  int
+	eof    bool
+	// closed is set once the buffer is no longer drained.
+	closed bool
+}
+
+// fill reads src into the buffer until it ends, waiting while the buffer
+// is full.
+func (b *specBuffer) fill(src io.Reader) {
+	for {
+		b.mu.Lock()
+		for b.size >= b.limit && !b.closed {
+			b.cond.Wait()
+		}
+		closed := b.closed
+		b.mu.Unlock()
+		if closed {
+			// Keep draining, lest the stages block.
+			io.Copy(ioutil.Discard, src)
+			return
+		}
+
+		chunk := make([]byte, 32<<10)
+		n, err := src.Read(chunk)
+
+		b.mu.Lock()
+		if n > 0 {
+			b.chunks = append(b.chunks, chunk[:n])
+			b.size += n
+		}
+		if err != nil {
+			b.eof = true
+		}
+		b.cond.Broadcast()
+		b.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// drain writes the buffered output, and the rest as it's read, to dst.
+func (b *specBuffer) drain(dst io.Writer) error {
+	for {
+		b.mu.Lock()
+		for len(b.chunks) == 0 && !b.eof && !b.closed {
+			b.cond.Wait()
+		}
+		if len(b.chunks) == 0 {
+			b.mu.Unlock()
+			return nil
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		b.size -= len(chunk)
+		b.cond.Broadcast()
+		b.mu.Unlock()
+
+		if _, err := dst.Write(chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// close stops buffering, discarding the rest of the output.
+func (b *specBuffer) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.chunks, b.size = nil, 0
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// Speculate starts executing the pipeline cmds, see ExecPipeline, but only
+// its first stages commands, buffering up to limit bytes of their output,
+// after which they block writing, until the caller commits to running the
+// rest via Commit, or gives up via Abort.  Returns an error if stages
+// doesn't leave any command to run once committed.
+func (r *Runner) Speculate(ctx context.Context, cmds []*exec.Cmd, stages int, limit int, opts ...Option) (*Speculation, error) {
+	if stages < 1 || stages >= len(cmds) {
+		return nil, fmt.Errorf("Speculation of %d stages out of range for %d commands", stages, len(cmds))
+	}
+
+	s := &Speculation{decide: make(chan bool, 1), done: make(chan struct{})}
+	speculate := func(c *config) {
+		b := &specBuffer{limit: limit}
+		b.cond = sync.NewCond(&b.mu)
+		filled := make(chan struct{})
+		var wg sync.WaitGroup
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			prev := cmd.Stdin
+			go func() {
+				defer close(filled)
+				b.fill(prev)
+			}()
+
+			var commit bool
+			select {
+			case commit = <-s.decide:
+			case <-c.runCtx.Done():
+			}
+			if !commit {
+				b.close()
+				if err := c.runCtx.Err(); err != nil {
+					return err
+				}
+				return ErrSpeculationAborted
+			}
+
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				b.close()
+				return err
+			}
+			cmd.Stdin = pr
+			err = start()
+			pr.Close()
+			if err != nil {
+				pw.Close()
+				b.close()
+				return err
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := b.drain(pw); err != nil {
+					// The command exited early, let the previous
+					// command fail writing, as in a pipeline.
+					b.close()
+					if closer, ok := prev.(io.Closer); ok {
+						closer.Close()
+					}
+				}
+				pw.Close()
+			}()
+			return nil
+		}, []int{stages})
+
+		// The previous command's output is closed once it has been
+		// waited on, so wait for it to be consumed first.
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			select {
+			case <-filled:
+			case <-c.runCtx.Done():
+			}
+			return wait()
+		}, []int{stages - 1})
+
+		c.onRelease(func() {
+			b.close()
+			wg.Wait()
+		})
+	}
+
+	go func() {
+		defer close(s.done)
+		s.res, s.err = r.ExecPipeline(ctx, cmds, append(opts[:len(opts):len(opts)], speculate)...)
+	}()
+	return s, nil
+}
+
+// Commit runs the rest of the pipeline, fed the output buffered so far,
+// and waits for it to complete.  Returns the execution's Result and error,
+// which wraps ErrSpeculationAborted if it was aborted before.
+func (s *Speculation) Commit() (*Result, error) {
+	s.once.Do(func() { s.decide <- true })
+	<-s.done
+	return s.res, s.err
+}
+
+// Abort kills the stages run ahead, discarding their output, unless the
+// speculation was committed before, and waits for them to exit.
+func (s *Speculation) Abort() {
+	s.once.Do(func() { s.decide <- false })
+	<-s.done
+}
@@ -0,0 +1,73 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpeculateCommit(t *testing.T) {
+	var out bytes.Buffer
+	cmds := []*exec.Cmd{exec.Command("head", "-c", "1000000", "/dev/zero"), exec.Command("wc", "-c")}
+	s, err := (&Runner{}).Speculate(context.Background(), cmds, 1, 64<<10, WithStdout(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first stage blocks once the buffer is full, and the rest isn't
+	// started before the commit.
+	time.Sleep(50 * time.Millisecond)
+	if cmds[1].Process != nil {
+		t.Error("second stage started before the commit")
+	}
+	if _, err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "1000000" {
+		t.Errorf("second stage read %s bytes, want all of the first's output", got)
+	}
+}
+
+func TestSpeculateAbort(t *testing.T) {
+	cmds := []*exec.Cmd{exec.Command("sh", "-c", "echo hi; sleep 10"), exec.Command("cat")}
+	s, err := (&Runner{}).Speculate(context.Background(), cmds, 1, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Now()
+	s.Abort()
+	if d := time.Since(begin); d > 5*time.Second {
+		t.Errorf("Abort() took %v, want the first stage killed", d)
+	}
+	if cmds[1].Process != nil {
+		t.Error("second stage started after the abort")
+	}
+	if _, err := s.Commit(); !errors.Is(err, ErrSpeculationAborted) {
+		t.Errorf("Commit() error = %v after Abort, want %v", err, ErrSpeculationAborted)
+	}
+
+	if _, err := (&Runner{}).Speculate(context.Background(), cmds, 2, 1<<10); err == nil {
+		t.Error("Speculate() of every stage succeeded")
+	}
+}
+
+func TestSpeculateDoesntBlockStarts(t *testing.T) {
+	if !inSubreaper(t) {
+		return
+	}
+	checkStartsNotBlocked(t, func(ctx context.Context) {
+		cmds := []*exec.Cmd{exec.Command("true"), exec.Command("true")}
+		s, err := (&Runner{}).Speculate(ctx, cmds, 1, 1<<10)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		<-ctx.Done()
+		s.Abort()
+	})
+}
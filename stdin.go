@@ -0,0 +1,294 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// StdinMode determines how WithStageStdin combines a reader with a
+// command's stdin.
+type StdinMode int
+
+const (
+	// StdinBefore feeds the reader before the previous command's output.
+	StdinBefore StdinMode = iota
+	// StdinAfter feeds the reader after the previous command's output.
+	StdinAfter
+	// StdinInstead feeds only the reader, like `cmd <file` inside a
+	// pipeline.  The previous command's output is discarded.
+	StdinInstead
+)
+
+// isWriteError returns true if err is the error of writing to a file.
+func isWriteError(err error) bool {
+	var pe *os.PathError
+	return errors.As(err, &pe) && pe.Op == "write"
+}
+
+// readErrReader records the error of reading from r, other than io.EOF, to
+// tell it apart from errors writing what was read.
+type readErrReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// WithStageStdin feeds the command at the given stage data read from r,
+// combined with the previous command's output, or the execution's stdin for
+// the first command, per mode.  Unless r is a file replacing the command's
+// stdin, which the command reads directly, the data is copied through this
+// process, within the kernel where supported.  If the command exits before
+// reading all of its stdin, the previous command's output is closed as in a
+// regular pipeline.  Failing to read from r fails the execution.
+func WithStageStdin(stage int, r io.Reader, mode StdinMode) Option {
+	return func(c *config) {
+		var wg sync.WaitGroup
+
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			prev := cmd.Stdin
+			// Discard the previous command's output, lest it block.
+			discardPrev := func() {
+				if prev != nil && mode == StdinInstead && stage > 0 {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						io.Copy(ioutil.Discard, prev)
+					}()
+				}
+			}
+
+			// A file replacing the command's stdin is read by the
+			// command directly.
+			if f, ok := r.(*os.File); ok && mode == StdinInstead {
+				cmd.Stdin = f
+				if err := start(); err != nil {
+					return err
+				}
+				discardPrev()
+				return nil
+			}
+
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			cmd.Stdin = pr
+			err = start()
+			pr.Close()
+			if err != nil {
+				pw.Close()
+				return err
+			}
+			discardPrev()
+
+			src := &readErrReader{r: r}
+			var sources []io.Reader
+			switch {
+			case prev == nil || mode == StdinInstead:
+				sources = []io.Reader{src}
+			case mode == StdinBefore:
+				sources = []io.Reader{src, prev}
+			default:
+				sources = []io.Reader{prev, src}
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer pw.Close()
+
+				var err error
+				for _, source := range sources {
+					if source != src {
+						_, err = copyStream(pw, source)
+					} else if f, ok := r.(*os.File); ok {
+						// Let a file be moved within the
+						// kernel, telling its errors from
+						// those writing to the command.
+						if _, err = copyStream(pw, f); err != nil && !isWriteError(err) {
+							src.err = err
+						}
+					} else {
+						_, err = io.Copy(pw, src)
+					}
+					if err != nil {
+						break
+					}
+				}
+				if src.err != nil {
+					c.abort(fmt.Errorf("reading stdin for stage %d: %w", stage, src.err))
+				} else if err != nil && stage > 0 && mode != StdinInstead {
+					// The command exited early, let the previous
+					// command fail writing, as in a pipeline.
+					if closer, ok := prev.(io.Closer); ok {
+						closer.Close()
+					}
+				}
+			}()
+			return nil
+		}, []int{stage})
+
+		// The previous command's output is closed once it has been
+		// waited on, so wait for it to be consumed first.
+		if stage > 0 {
+			c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+				done := make(chan struct{})
+				go func() {
+					wg.Wait()
+					close(done)
+				}()
+				select {
+				case <-done:
+				case <-c.runCtx.Done():
+				}
+				return wait()
+			}, []int{stage - 1})
+		}
+	}
+}
+
+// StdinSource is a source of data for MultiStdin.
+type StdinSource struct {
+	// Name identifies the source in errors.
+	Name string
+	// Open opens the source once MultiStdin reaches it.
+	Open func() (io.ReadCloser, error)
+}
+
+// ReaderSource returns a StdinSource reading from r, identified by name.
+func ReaderSource(name string, r io.Reader) StdinSource {
+	return StdinSource{Name: name, Open: func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(r), nil
+	}}
+}
+
+// FileSource returns a StdinSource reading the file at path.
+func FileSource(path string) StdinSource {
+	return StdinSource{Name: path, Open: func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}}
+}
+
+// SourceError is returned by a MultiStdin reader that failed to open or
+// read one of its sources.
+type SourceError struct {
+	// Source is the name of the source that failed.
+	Source string
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return e.Source + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+type multiStdin struct {
+	sources []StdinSource
+	cur     io.ReadCloser
+	err     error
+}
+
+// MultiStdin returns a reader that reads from the sources in order, like
+// `cat a b | cmd` without running cat, e.g. for WithStdin or
+// WithStageStdin.  Each source is opened once the previous source is
+// exhausted and closed once it's exhausted in turn.  Failing to open or
+// read a source fails the reader with a *SourceError naming the source.
+// Files are moved within the kernel where supported.  Close closes the
+// current source.
+func MultiStdin(sources ...StdinSource) io.ReadCloser {
+	return &multiStdin{sources: sources}
+}
+
+func (m *multiStdin) Read(p []byte) (int, error) {
+	for m.err == nil {
+		if m.cur == nil {
+			if len(m.sources) == 0 {
+				return 0, io.EOF
+			}
+			cur, err := m.sources[0].Open()
+			if err != nil {
+				m.err = &SourceError{Source: m.sources[0].Name, Err: err}
+				break
+			}
+			m.cur = cur
+		}
+
+		n, err := m.cur.Read(p)
+		if err == io.EOF {
+			m.cur.Close()
+			m.cur, m.sources = nil, m.sources[1:]
+			err = nil
+		} else if err != nil {
+			m.err = &SourceError{Source: m.sources[0].Name, Err: err}
+		}
+		if n > 0 || m.err != nil {
+			return n, m.err
+		}
+	}
+	return 0, m.err
+}
+
+// WriteTo writes the sources to w, moving files within the kernel where
+// supported, e.g. when os/exec copies the reader to a command's stdin.
+func (m *multiStdin) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for m.err == nil && len(m.sources) > 0 {
+		if m.cur == nil {
+			cur, err := m.sources[0].Open()
+			if err != nil {
+				m.err = &SourceError{Source: m.sources[0].Name, Err: err}
+				break
+			}
+			m.cur = cur
+		}
+
+		var n int64
+		var err error
+		if f, ok := m.cur.(*os.File); ok {
+			if n, err = copyStream(w, f); err != nil && isWriteError(err) {
+				return written + n, err
+			}
+		} else {
+			src := &readErrReader{r: m.cur}
+			if n, err = io.Copy(w, src); err != nil && src.err == nil {
+				return written + n, err
+			}
+		}
+		written += n
+		if err != nil {
+			m.err = &SourceError{Source: m.sources[0].Name, Err: err}
+			break
+		}
+		m.cur.Close()
+		m.cur, m.sources = nil, m.sources[1:]
+	}
+	return written, m.err
+}
+
+func (m *multiStdin) Close() error {
+	if m.cur == nil {
+		return nil
+	}
+	err := m.cur.Close()
+	m.cur, m.sources = nil, nil
+	if m.err == nil {
+		m.err = fmt.Errorf("read from closed MultiStdin")
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWithStageStdin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	if err := ioutil.WriteFile(path, []byte("file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		stage int
+		mode  StdinMode
+		file  bool
+		want  string
+	}{
+		{"before", 1, StdinBefore, false, "r\nin\nprev\n"},
+		{"after", 1, StdinAfter, false, "in\nprev\nr\n"},
+		{"instead", 1, StdinInstead, false, "r\n"},
+		{"file after", 1, StdinAfter, true, "in\nprev\nfile\n"},
+		{"file instead", 1, StdinInstead, true, "file\n"},
+		{"first before", 0, StdinBefore, false, "r\nin\nprev\n"},
+		{"first after", 0, StdinAfter, false, "in\nr\nprev\n"},
+	} {
+		var r io.Reader = strings.NewReader("r\n")
+		if tt.file {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		var out bytes.Buffer
+		cmds := []*exec.Cmd{exec.Command("sh", "-c", "cat; echo prev"), exec.Command("cat")}
+		if _, err := (&Runner{}).ExecPipeline(context.Background(), cmds, WithStdin(strings.NewReader("in\n")), WithStageStdin(tt.stage, r, tt.mode), WithStdout(&out)); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.name, out.String(), tt.want)
+		}
+	}
+}
+
+func TestWithStageStdinErrors(t *testing.T) {
+	// Failing to read fails the execution.
+	errRead := errors.New("read failed")
+	cmds := []*exec.Cmd{exec.Command("echo", "prev"), exec.Command("cat")}
+	if _, err := (&Runner{}).ExecPipeline(context.Background(), cmds, WithStageStdin(1, iotest.ErrReader(errRead), StdinAfter)); !errors.Is(err, errRead) {
+		t.Errorf("error = %v, want %v", err, errRead)
+	}
+
+	// A command may exit without reading all of its stdin.
+	var out bytes.Buffer
+	cmds = []*exec.Cmd{exec.Command("echo", "prev"), exec.Command("head", "-n", "1")}
+	(&Runner{}).ExecPipeline(context.Background(), cmds, WithStageStdin(1, strings.NewReader("r\n"), StdinBefore), WithStdout(&out))
+	if out.String() != "r\n" {
+		t.Errorf("output = %q, want the reader's first line", out.String())
+	}
+}
+
+// onlyReader hides all methods of r but Read, e.g. WriteTo.
+type onlyReader struct{ r io.Reader }
+
+func (r onlyReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func TestMultiStdin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	if err := ioutil.WriteFile(path, []byte("file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sources are opened once reached.
+	var opened []string
+	lazy := func(name string) StdinSource {
+		return StdinSource{Name: name, Open: func() (io.ReadCloser, error) {
+			opened = append(opened, name)
+			return ioutil.NopCloser(strings.NewReader(name + "\n")), nil
+		}}
+	}
+
+	m := MultiStdin(lazy("a"), FileSource(path), ReaderSource("r", strings.NewReader("r\n")), lazy("b"))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(m, buf); err != nil || string(buf) != "a\n" || len(opened) != 1 {
+		t.Errorf("Read = %q, %v, opened %q, want only the first source", buf, err, opened)
+	}
+	rest, err := ioutil.ReadAll(onlyReader{m})
+	if err != nil || string(rest) != "file\nr\nb\n" {
+		t.Errorf("Read = %q, %v", rest, err)
+	}
+
+	// Commands' stdin is written via WriteTo.
+	out, err := ExecO(exec.Command("cat"), MultiStdin(FileSource(path), lazy("c"), FileSource(path)))
+	if err != nil || string(out) != "file\nc\nfile\n" {
+		t.Errorf("ExecO = %q, %v", out, err)
+	}
+}
+
+func TestMultiStdinErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	errRead := errors.New("read failed")
+	for _, failing := range []StdinSource{FileSource(missing), ReaderSource(missing, iotest.ErrReader(errRead))} {
+		for _, read := range []func(r io.Reader) ([]byte, error){
+			func(r io.Reader) ([]byte, error) { return ioutil.ReadAll(onlyReader{r}) },
+			func(r io.Reader) ([]byte, error) {
+				var buf bytes.Buffer
+				_, err := io.Copy(&buf, r)
+				return buf.Bytes(), err
+			},
+		} {
+			data, err := read(MultiStdin(ReaderSource("a", strings.NewReader("a\n")), failing))
+			var se *SourceError
+			if string(data) != "a\n" || !errors.As(err, &se) || se.Source != missing {
+				t.Errorf("read = %q, %v, want a *SourceError for %s", data, err, missing)
+			}
+		}
+	}
+
+	// Reading after Close fails.
+	m := MultiStdin(ReaderSource("a", strings.NewReader("abc")))
+	buf := make([]byte, 1)
+	m.Read(buf)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Read(buf); err == nil {
+		t.Error("no error reading after Close")
+	}
+}
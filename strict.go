@@ -0,0 +1,106 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Untrusted is a string from untrusted input, e.g. a request parameter, to
+// be passed to a command by StrictCommand, which checks it.  Being a
+// distinct type, an Untrusted value can't be used where a string is
+// expected, e.g. as a program's name, without an explicit conversion.
+type Untrusted string
+
+// ErrSuspiciousArg is returned by StrictCommand for Untrusted arguments
+// that look like an attempt at injection.
+var ErrSuspiciousArg = errors.New("suspicious untrusted argument")
+
+// shellMeta holds the characters that a shell would interpret.
+const shellMeta = "|&;<>()$`\\\"'*?[]{}!#~"
+
+// checkUntrusted returns an error wrapping ErrSuspiciousArg if s contains
+// shell metacharacters, control characters or invalid UTF-8.
+func checkUntrusted(s Untrusted) error {
+	for i, r := range string(s) {
+		switch {
+		case r == utf8.RuneError && !strings.HasPrefix(string(s[i:]), "\uFFFD"):
+			return fmt.Errorf("%w: invalid UTF-8 at offset %d", ErrSuspiciousArg, i)
+		case unicode.IsControl(r):
+			return fmt.Errorf("%w: control character %q at offset %d", ErrSuspiciousArg, r, i)
+		case strings.ContainsRune(shellMeta, r):
+			return fmt.Errorf("%w: shell metacharacter %q at offset %d", ErrSuspiciousArg, r, i)
+		}
+	}
+	return nil
+}
+
+// FlagArg is an option with an Untrusted value, see Flag.
+type FlagArg struct {
+	Name  string
+	Value Untrusted
+}
+
+// Flag returns an argument for StrictCommand passing the Untrusted value of
+// the option name, as the argument following name or, if name ends with
+// "=", e.g. "--output=", appended to it, so that the value is taken as
+// data even if it starts with a dash.
+func Flag(name string, value Untrusted) FlagArg {
+	return FlagArg{name, value}
+}
+
+// StrictCommand returns an exec.Cmd to execute the named program with args,
+// each a string, which is passed as is, an Untrusted value or a FlagArg,
+// e.g.
+//
+//	pipes.StrictCommand("grep", "-r", pipes.Flag("-e", pattern), pipes.EndOfOptions, pipes.Untrusted(dir))
+//
+// Untrusted values are only allowed in positions marked as data, i.e. as
+// the value of a Flag or after EndOfOptions, and never as the program's
+// name or an option, so that they can't inject options.  Untrusted values
+// are also rejected if they contain shell metacharacters, control
+// characters or invalid UTF-8.  No shell is involved, but the program may
+// well pass its arguments on to one, e.g. ssh(1) or a script's eval, or
+// print them to a terminal, so rejecting such values at the boundary
+// catches injection bugs before they're exploitable.  Returns an error
+// wrapping ErrSuspiciousArg for such values, or an error for arguments of
+// any other type.
+func StrictCommand(name string, args ...interface{}) (*exec.Cmd, error) {
+	argv := make([]string, 0, len(args))
+	operands := false
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case string:
+			argv = append(argv, arg)
+			if arg == EndOfOptions {
+				operands = true
+			}
+		case Untrusted:
+			if !operands {
+				return nil, fmt.Errorf("%s argument %d is Untrusted outside of data positions, use Flag or EndOfOptions", name, i+1)
+			}
+			if err := checkUntrusted(arg); err != nil {
+				return nil, fmt.Errorf("%s argument %d %q %w", name, i+1, string(arg), err)
+			}
+			argv = append(argv, string(arg))
+		case FlagArg:
+			if operands {
+				return nil, fmt.Errorf("%s argument %d is a Flag after %s", name, i+1, EndOfOptions)
+			}
+			if err := checkUntrusted(arg.Value); err != nil {
+				return nil, fmt.Errorf("%s argument %d %s %q %w", name, i+1, arg.Name, string(arg.Value), err)
+			}
+			if strings.HasSuffix(arg.Name, "=") {
+				argv = append(argv, arg.Name+string(arg.Value))
+			} else {
+				argv = append(argv, arg.Name, string(arg.Value))
+			}
+		default:
+			return nil, fmt.Errorf("%s argument %d of type %T isn't a string, Untrusted or FlagArg", name, i+1, arg)
+		}
+	}
+	return exec.Command(name, argv...), nil
+}
@@ -0,0 +1,38 @@
+package pipes
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrictCommand(t *testing.T) {
+	cmd, err := StrictCommand("grep", "-r", Flag("-e", "-x"), Flag("--include=", "go"), Flag("-m", Untrusted("café �")), EndOfOptions, Untrusted("-dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"grep", "-r", "-e", "-x", "--include=go", "-m", "café �", "--", "-dir"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Args = %q, want %q", cmd.Args, want)
+	}
+
+	for _, tt := range []struct {
+		args       []interface{}
+		suspicious bool
+		want       string
+	}{
+		{[]interface{}{Untrusted("x")}, false, "Untrusted outside of data positions"},
+		{[]interface{}{EndOfOptions, Flag("-e", "x")}, false, "Flag after --"},
+		{[]interface{}{1}, false, "of type int"},
+		{[]interface{}{EndOfOptions, Untrusted("a;b")}, true, "shell metacharacter ';'"},
+		{[]interface{}{EndOfOptions, Untrusted("$(id)")}, true, "shell metacharacter '$'"},
+		{[]interface{}{Flag("-e", "a\nb")}, true, "control character '\\n'"},
+		{[]interface{}{Flag("-e", "a\xffb")}, true, "invalid UTF-8 at offset 1"},
+	} {
+		_, err := StrictCommand("grep", tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) || errors.Is(err, ErrSuspiciousArg) != tt.suspicious {
+			t.Errorf("StrictCommand(%v) error = %v, want %q (suspicious %v)", tt.args, err, tt.want, tt.suspicious)
+		}
+	}
+}
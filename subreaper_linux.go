@@ -0,0 +1,83 @@
+package pipes
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+const prSetChildSubreaper = 36
+
+var subreaper struct {
+	once sync.Once
+	err  error
+}
+
+// reaper reaps orphans whenever a child exits, once started.
+var reaper sync.Once
+
+// orphanZombies returns the pids of this process's children that have
+// exited but haven't been reaped, other than commands started by this
+// package, which are left for their cmd.Wait.
+func orphanZombies() []int {
+	self := os.Getpid()
+
+	var pids []int
+	for _, pid := range procPids() {
+		stat, err := readProcStat(pid)
+		if err == nil && stat.state == "Z" && stat.ppid == self && !isTracked(pid) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// reapOrphans reaps exited children other than commands started by this
+// package, calling reaped, if non-nil, with each one's pid and status.
+func reapOrphans(reaped func(pid int, status syscall.WaitStatus)) {
+	procs.startMu.Lock()
+	defer procs.startMu.Unlock()
+
+	for _, pid := range orphanZombies() {
+		var status syscall.WaitStatus
+		if n, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err == nil && n == pid && reaped != nil {
+			reaped(pid, status)
+		}
+	}
+}
+
+// EnableSubreaper marks this process as a child subreaper, so that orphaned
+// descendants of the commands it runs, e.g. daemons started by tools that
+// double-fork, are reparented to this process rather than to init, and
+// reaps them once they exit, so that they don't linger as zombies, e.g. in
+// a container whose init doesn't reap.  Commands started other than via
+// this package, e.g. directly via os/exec, may be reaped before they're
+// waited on, failing their Wait.  Only supported on Linux.
+func EnableSubreaper() error {
+	subreaper.once.Do(func() {
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0, 0, 0, 0)
+		if errno != 0 {
+			subreaper.err = fmt.Errorf("setting child subreaper: %s", errno.Error())
+			return
+		}
+
+		startReaper()
+	})
+	return subreaper.err
+}
+
+// startReaper starts reaping orphans whenever a child exits, if it isn't
+// already doing so.
+func startReaper() {
+	reaper.Do(func() {
+		sigchld := make(chan os.Signal, 1)
+		signal.Notify(sigchld, syscall.SIGCHLD)
+		go func() {
+			for range sigchld {
+				reapOrphans(nil)
+			}
+		}()
+	})
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package pipes
+
+import (
+	"errors"
+)
+
+// EnableSubreaper is only supported on Linux.
+func EnableSubreaper() error {
+	return errors.New("subreaper not supported on this platform")
+}
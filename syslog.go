@@ -0,0 +1,114 @@
+//go:build !windows && !plan9
+
+package pipes
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"sync"
+)
+
+// journalSocket is the socket on which systemd-journald accepts entries via
+// its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// logWriter forwards each line written to it via send.  Failing to forward
+// a line doesn't fail the write, lest a logging hiccup kill the command whose
+// output is being logged; the first such error is returned by Close.
+type logWriter struct {
+	lines *lineWriter
+	close func() error
+
+	mu  sync.Mutex
+	err error
+}
+
+func newLogWriter(send func(line []byte) error, close func() error) *logWriter {
+	w := &logWriter{close: close}
+	w.lines = newLineWriter(func(line []byte) {
+		if err := send(line); err != nil {
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = err
+			}
+			w.mu.Unlock()
+		}
+	})
+	return w
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	return w.lines.Write(p)
+}
+
+// Close forwards any trailing partial line and closes the connection to the
+// logging daemon.
+func (w *logWriter) Close() error {
+	w.lines.flush()
+	err := w.close()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return err
+}
+
+// NewSyslogWriter returns a writer that forwards each line written to it to
+// the local syslog daemon, with the given tag and priority.
+func NewSyslogWriter(tag string, priority syslog.Priority) (io.WriteCloser, error) {
+	sw, err := syslog.New(priority, tag)
+	if err != nil {
+		return nil, err
+	}
+	return newLogWriter(func(line []byte) error {
+		_, err := sw.Write(line)
+		return err
+	}, sw.Close), nil
+}
+
+// NewSyslogWriters returns writers for a command's Stdout and Stderr that
+// forward lines to the local syslog daemon with the given tag, logging
+// Stdout lines at LOG_INFO and Stderr lines at LOG_WARNING.
+func NewSyslogWriters(tag string) (stdout io.WriteCloser, stderr io.WriteCloser, err error) {
+	if stdout, err = NewSyslogWriter(tag, syslog.LOG_INFO|syslog.LOG_USER); err != nil {
+		return nil, nil, err
+	}
+	if stderr, err = NewSyslogWriter(tag, syslog.LOG_WARNING|syslog.LOG_USER); err != nil {
+		stdout.Close()
+		return nil, nil, err
+	}
+	return stdout, stderr, nil
+}
+
+// NewJournalWriter returns a writer that forwards each line written to it to
+// systemd-journald, using its native protocol, with the given identifier and
+// priority.  Only the severity of priority is used, the journal doesn't have
+// facilities.
+func NewJournalWriter(identifier string, priority syslog.Priority) (io.WriteCloser, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return newLogWriter(func(line []byte) error {
+		_, err := fmt.Fprintf(conn, "PRIORITY=%d\nSYSLOG_IDENTIFIER=%s\nMESSAGE=%s\n", priority&7, identifier, line)
+		return err
+	}, conn.Close), nil
+}
+
+// NewJournalWriters returns writers for a command's Stdout and Stderr that
+// forward lines to systemd-journald with the given identifier, logging
+// Stdout lines at LOG_INFO and Stderr lines at LOG_WARNING.
+func NewJournalWriters(identifier string) (stdout io.WriteCloser, stderr io.WriteCloser, err error) {
+	if stdout, err = NewJournalWriter(identifier, syslog.LOG_INFO); err != nil {
+		return nil, nil, err
+	}
+	if stderr, err = NewJournalWriter(identifier, syslog.LOG_WARNING); err != nil {
+		stdout.Close()
+		return nil, nil, err
+	}
+	return stdout, stderr, nil
+}
@@ -0,0 +1,136 @@
+package pipes
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// sysProcAttr returns cmd's SysProcAttr, allocating it if necessary.
+func sysProcAttr(cmd *exec.Cmd) *syscall.SysProcAttr {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	return cmd.SysProcAttr
+}
+
+// WithSetsid runs the commands at the given stages, or all commands if no
+// stages are given, in a new session, detaching them from this process's
+// controlling terminal and process group.  On Windows, the commands are run
+// in a new process group instead.
+func WithSetsid(stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			if err := setSetsid(cmd); err != nil {
+				return err
+			}
+			return start()
+		}, stages)
+	}
+}
+
+// WithSetctty runs the commands at the given stages, or all commands if no
+// stages are given, in a new session whose controlling terminal is the
+// terminal open on the child's file descriptor fd, e.g. 0 for a pty passed
+// as Stdin.  Not supported on Windows.
+func WithSetctty(fd int, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			if err := setSetctty(cmd, fd); err != nil {
+				return err
+			}
+			return start()
+		}, stages)
+	}
+}
+
+// WithPdeathsig sends sig, e.g. SIGKILL, to the commands at the given
+// stages, or all commands if no stages are given, if this process dies
+// before they do, e.g. crashes, so that they aren't orphaned.  On Unix
+// platforms other than Linux and FreeBSD, which lack parent death signals,
+// this is emulated by a watchdog process per command.  Not supported on
+// Windows.
+func WithPdeathsig(sig os.Signal, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			release, err := startWithPdeathsig(cmd, sig, start)
+			if err == nil {
+				c.onRelease(release)
+			}
+			return err
+		}, stages)
+	}
+}
+
+// WithNoNewPrivs sets the no_new_privs attribute of the commands at the
+// given stages, or all commands if no stages are given, so that neither
+// they nor their descendants can gain privileges by executing setuid or
+// file capability binaries.  Only supported on Linux.
+func WithNoNewPrivs(stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			release, err := startNoNewPrivs(cmd, start)
+			if err == nil {
+				c.onRelease(release)
+			}
+			return err
+		}, stages)
+	}
+}
+
+// WithNoNetwork cuts the commands at the given stages, or all commands if
+// no stages are given, off the network, e.g. so that stages that merely
+// transform data provably can't exfiltrate it.  On Linux the commands run
+// in a new network namespace, with only a loopback interface, and unless
+// this process is root, in a new user namespace mapping only its user,
+// which requires unprivileged user namespaces.  On macOS the commands run
+// under sandbox-exec(1), which is deprecated but still functional.  Not
+// supported on other platforms.
+func WithNoNetwork(stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			return startNoNetwork(cmd, start)
+		}, stages)
+	}
+}
+
+// WithReadOnlyView runs the commands at the given stages, or all commands
+// if no stages are given, with a view of the file system in which the
+// directories dirs are read-only, except for scratch, if non-empty, which
+// remains writable even if beneath one of dirs, e.g. so that a tool
+// analyzing a source tree can't modify it but for its build directory.
+// Relative paths are resolved against this process's working directory.
+// On Linux the directories are bind mounted read-only in a new mount
+// namespace, which requires root, or else bubblewrap, whose bwrap(1) is
+// used instead; directories mounted beneath dirs remain writable.  On
+// macOS the commands run under sandbox-exec(1).  Not supported on other
+// platforms.
+func WithReadOnlyView(dirs []string, scratch string, stages ...int) Option {
+	return func(c *config) {
+		var absDirs []string
+		var absScratch string
+		c.onSetup(func(c *config) error {
+			for _, dir := range dirs {
+				abs, err := filepath.Abs(dir)
+				if err != nil {
+					return err
+				}
+				absDirs = append(absDirs, abs)
+			}
+			if scratch != "" {
+				var err error
+				absScratch, err = filepath.Abs(scratch)
+				return err
+			}
+			return nil
+		})
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			release, err := startReadOnlyView(cmd, absDirs, absScratch, start)
+			if err == nil {
+				c.onRelease(release)
+			}
+			return err
+		}, stages)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func setSetsid(cmd *exec.Cmd) error {
+	return errors.New("sessions not supported on this platform")
+}
+
+func setSetctty(cmd *exec.Cmd, fd int) error {
+	return errors.New("controlling terminals not supported on this platform")
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package pipes
+
+import (
+	"os/exec"
+)
+
+func setSetsid(cmd *exec.Cmd) error {
+	sysProcAttr(cmd).Setsid = true
+	return nil
+}
+
+func setSetctty(cmd *exec.Cmd, fd int) error {
+	attr := sysProcAttr(cmd)
+	attr.Setsid, attr.Setctty, attr.Ctty = true, true, fd
+	return nil
+}
@@ -0,0 +1,18 @@
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// setSetsid runs cmd in a new process group, the closest Windows has to a
+// new session.
+func setSetsid(cmd *exec.Cmd) error {
+	sysProcAttr(cmd).CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+	return nil
+}
+
+func setSetctty(cmd *exec.Cmd, fd int) error {
+	return errors.New("controlling terminals not supported on this platform")
+}
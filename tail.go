@@ -0,0 +1,82 @@
+package pipes
+
+import (
+	"sync"
+)
+
+// TailBuffer is an io.Writer that retains only the last lines and/or bytes
+// written to it, e.g. to keep enough of a chatty command's output to
+// diagnose a failure without paying for capturing all of it.
+type TailBuffer struct {
+	mu       sync.Mutex
+	buf      []byte
+	maxLines int
+	maxBytes int
+}
+
+// NewTailBuffer returns a TailBuffer that retains at most the last maxLines
+// lines and at most the last maxBytes bytes.  A zero limit means no limit.
+func NewTailBuffer(maxLines int, maxBytes int) *TailBuffer {
+	return &TailBuffer{maxLines: maxLines, maxBytes: maxBytes}
+}
+
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+
+	// Find the start of the last maxLines lines, the final line may or
+	// may not be terminated.
+	if t.maxLines > 0 {
+		n := 0
+		for i := len(t.buf) - 2; i >= 0; i-- {
+			if t.buf[i] != '\n' {
+				continue
+			}
+			if n++; n == t.maxLines {
+				t.buf = t.buf[i+1:]
+				break
+			}
+		}
+	}
+	if t.maxBytes > 0 && len(t.buf) > t.maxBytes {
+		t.buf = t.buf[len(t.buf)-t.maxBytes:]
+	}
+
+	// Don't let the discarded head of the buffer pin memory.
+	if cap(t.buf) > 2*len(t.buf)+4096 {
+		t.buf = append([]byte(nil), t.buf...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns a copy of the retained data.
+func (t *TailBuffer) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]byte(nil), t.buf...)
+}
+
+// WithTail retains the last maxLines lines and/or maxBytes bytes of the
+// pipeline's Stdout and Stderr, in addition to writing them to any writers
+// configured for the execution.  The retained output is available via the
+// Result and, if the execution fails, is attached to the returned error,
+// which is an *Error.  A zero limit means no limit.
+func WithTail(maxLines int, maxBytes int) Option {
+	return func(c *config) {
+		c.tailLines, c.tailBytes = maxLines, maxBytes
+		c.tail = true
+	}
+}
+
+// WithErrorTail sets the maximum number of bytes of captured Stderr included
+// in the error string of the *Error returned if the execution fails, see
+// WithTail, to max, or no limit if max is negative.  The default is
+// DefaultErrorTailSize.
+func WithErrorTail(max int) Option {
+	return func(c *config) {
+		c.errorTail = max
+	}
+}
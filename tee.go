@@ -0,0 +1,159 @@
+package pipes
+
+import (
+	"io"
+	"sync"
+)
+
+// Backpressure chooses what a Tee does when its consumer is slower than the
+// pipeline producing the output.  The zero value blocks the pipeline until
+// the consumer catches up.
+type Backpressure struct {
+	// Buffer is the number of bytes buffered for the consumer, which is
+	// written to asynchronously if Buffer is positive.  The pipeline is
+	// blocked while the buffer is full.
+	Buffer int
+	// Drop drops writes that don't fit in the buffer rather than blocking
+	// the pipeline, see Tee.Dropped.  Requires a positive Buffer.
+	Drop bool
+}
+
+// Tee is a writer that forwards output to a consumer, e.g. a WebSocket, with
+// a Backpressure policy, see WithTee.  Writes to a Tee never fail: once the
+// consumer fails, all further output is dropped and the error is returned by
+// Close.
+type Tee struct {
+	w  io.Writer
+	bp Backpressure
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	writing bool
+	closed  bool
+	dropped int64
+	err     error
+}
+
+// NewTee returns a Tee that forwards output to w according to bp.
+func NewTee(w io.Writer, bp Backpressure) *Tee {
+	t := &Tee{w: w, bp: bp}
+	t.cond = sync.NewCond(&t.mu)
+	if t.async() {
+		go t.run()
+	}
+	return t
+}
+
+func (t *Tee) async() bool {
+	return t.bp.Buffer > 0 || t.bp.Drop
+}
+
+// Write forwards p to the consumer, buffers p or drops p, according to the
+// Tee's Backpressure.
+func (t *Tee) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil || t.closed {
+		t.dropped += int64(len(p))
+		return len(p), nil
+	}
+	if !t.async() {
+		if _, err := t.w.Write(p); err != nil {
+			t.err = err
+			t.dropped += int64(len(p))
+		}
+		return len(p), nil
+	}
+
+	if t.bp.Drop {
+		if len(t.buf)+len(p) > t.bp.Buffer {
+			t.dropped += int64(len(p))
+			return len(p), nil
+		}
+	} else {
+		// Writes larger than the buffer are accepted once it's empty.
+		for len(t.buf) > 0 && len(t.buf)+len(p) > t.bp.Buffer && t.err == nil {
+			t.cond.Wait()
+		}
+		if t.err != nil {
+			t.dropped += int64(len(p))
+			return len(p), nil
+		}
+	}
+	t.buf = append(t.buf, p...)
+	t.cond.Broadcast()
+	return len(p), nil
+}
+
+// run writes buffered output to the consumer until the Tee is closed.
+func (t *Tee) run() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for {
+		for len(t.buf) == 0 && !t.closed {
+			t.cond.Wait()
+		}
+		if len(t.buf) == 0 {
+			return
+		}
+
+		chunk := t.buf
+		t.buf, t.writing = nil, true
+		t.mu.Unlock()
+		_, err := t.w.Write(chunk)
+		t.mu.Lock()
+		t.writing = false
+
+		if err != nil && t.err == nil {
+			t.err = err
+			t.dropped += int64(len(chunk) + len(t.buf))
+			t.buf = nil
+		}
+		t.cond.Broadcast()
+	}
+}
+
+// Dropped returns the number of bytes dropped so far, because the buffer
+// was full or the consumer failed.
+func (t *Tee) Dropped() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.dropped
+}
+
+// Close waits for buffered output to be written to the consumer and returns
+// the consumer's error, if any.  Output written after Close is dropped.
+func (t *Tee) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	t.cond.Broadcast()
+	for t.writing || len(t.buf) > 0 {
+		t.cond.Wait()
+	}
+	return t.err
+}
+
+// WithTee additionally writes the output from the last command to stdout
+// and all commands' Stderr output to stderr, either of which may be nil.
+// Unlike WithStdout and WithStderr, a slow consumer is handled according to
+// its Backpressure if it's a Tee, e.g. to also stream output to a flaky
+// WebSocket without stalling or failing the pipeline.
+func WithTee(stdout io.Writer, stderr io.Writer) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			if stdout != nil {
+				c.stdout = teeWriter(c.stdout, stdout)
+			}
+			if stderr != nil {
+				c.stderr = teeWriter(c.stderr, stderr)
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks each write until unblocked, signalling started when
+// a write starts.
+type blockingWriter struct {
+	started chan struct{}
+	unblock chan struct{}
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}, 100), unblock: make(chan struct{})}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.started <- struct{}{}
+	<-w.unblock
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("consumer gone")
+}
+
+func TestTeeDrop(t *testing.T) {
+	w := newBlockingWriter()
+	tee := NewTee(w, Backpressure{Buffer: 4, Drop: true})
+
+	// The consumer is stuck on the first write, the second is buffered
+	// and the third doesn't fit.
+	tee.Write([]byte("abcd"))
+	<-w.started
+	tee.Write([]byte("efgh"))
+	tee.Write([]byte("ij"))
+	if n := tee.Dropped(); n != 2 {
+		t.Errorf("Dropped() = %d, want 2", n)
+	}
+
+	close(w.unblock)
+	if err := tee.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.buf.String() != "abcdefgh" {
+		t.Errorf("consumer got %q, want abcdefgh", w.buf.String())
+	}
+	tee.Write([]byte("k"))
+	if n := tee.Dropped(); n != 3 {
+		t.Errorf("Dropped() = %d after Close, want 3", n)
+	}
+}
+
+func TestTeeBuffer(t *testing.T) {
+	w := newBlockingWriter()
+	tee := NewTee(w, Backpressure{Buffer: 4})
+
+	tee.Write([]byte("abcd"))
+	<-w.started
+	tee.Write([]byte("efgh"))
+
+	// The buffer is full, so the pipeline blocks until the consumer
+	// catches up.
+	done := make(chan struct{})
+	go func() {
+		tee.Write([]byte("ij"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("write to full buffer didn't block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(w.unblock)
+	<-done
+
+	if err := tee.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.buf.String() != "abcdefghij" || tee.Dropped() != 0 {
+		t.Errorf("consumer got %q, dropped %d, want everything", w.buf.String(), tee.Dropped())
+	}
+}
+
+func TestTeeFailure(t *testing.T) {
+	for _, bp := range []Backpressure{{}, {Buffer: 4}} {
+		tee := NewTee(failingWriter{}, bp)
+		for i := 0; i < 3; i++ {
+			if n, err := tee.Write([]byte("ab")); n != 2 || err != nil {
+				t.Errorf("%+v: Write = %d, %v, want success", bp, n, err)
+			}
+		}
+		if err := tee.Close(); err == nil {
+			t.Errorf("%+v: Close didn't return the consumer's error", bp)
+		}
+		if n := tee.Dropped(); n != 6 {
+			t.Errorf("%+v: Dropped() = %d, want 6", bp, n)
+		}
+	}
+}
+
+func TestWithTee(t *testing.T) {
+	var stdout, copied bytes.Buffer
+	tee := NewTee(&copied, Backpressure{Buffer: 1024})
+
+	// A failing Tee doesn't fail the pipeline.
+	failing := NewTee(failingWriter{}, Backpressure{})
+	cmd := exec.Command("sh", "-c", "echo out; echo err >&2")
+	if _, err := (&Runner{}).Exec(context.Background(), cmd, WithStdout(&stdout), WithTee(tee, failing)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tee.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := failing.Close(); err == nil {
+		t.Error("Close didn't return the consumer's error")
+	}
+	if stdout.String() != "out\n" || copied.String() != "out\n" {
+		t.Errorf("stdout = %q, tee = %q, want the output in both", stdout.String(), copied.String())
+	}
+}
@@ -0,0 +1,20 @@
+package pipes
+
+// WithTerminal connects the caller's terminal, i.e. /dev/tty, to the
+// pipeline's stdin, stdout and stderr, for those not otherwise redirected,
+// e.g. so that a CLI can delegate to an interactive tool like vim or ssh.
+// Tools mid-pipeline that open /dev/tty themselves work as well.  If raw is
+// true, the terminal is put in raw mode, so that keys, including ^C, are
+// passed to the commands as is.  Otherwise, signals generated by the
+// terminal are delivered to the commands by the kernel and ignored by this
+// process while the pipeline runs.  Other signals received by this process,
+// e.g. SIGTERM, are forwarded to the commands.  The terminal's state is
+// restored once the pipeline completes, even if a command left it in raw
+// mode, e.g. because it was killed.  Not supported on Windows and Plan 9.
+func WithTerminal(raw bool) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			return connectTerminal(c, raw)
+		})
+	}
+}
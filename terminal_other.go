@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package pipes
+
+import "errors"
+
+// connectTerminal fails, as this platform doesn't have terminals, or at
+// least not termios.
+func connectTerminal(c *config, raw bool) error {
+	return errors.New("terminal passthrough not supported on this platform")
+}
@@ -0,0 +1,112 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package pipes
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	var t syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&t))); errno != 0 {
+		return nil, errno
+	}
+	return &t, nil
+}
+
+func setTermios(fd uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw puts t in raw mode, as by cfmakeraw(3).
+func makeRaw(t *syscall.Termios) {
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+}
+
+func connectTerminal(c *config, raw bool) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	saved, err := getTermios(tty.Fd())
+	if err != nil {
+		tty.Close()
+		return err
+	}
+	if raw {
+		t := *saved
+		makeRaw(&t)
+		if err = setTermios(tty.Fd(), &t); err != nil {
+			tty.Close()
+			return err
+		}
+	}
+
+	if c.stdin == nil && c.cmds[0].Stdin == nil {
+		c.stdin = tty
+	}
+	if c.stdout == nil {
+		c.stdout = tty
+	}
+	if c.stderr == nil {
+		c.stderr = tty
+	}
+
+	// Record the commands as they're started, for forwarding signals.
+	var mu sync.Mutex
+	var started []*os.Process
+	c.onStart(func(cmd *exec.Cmd, start func() error) error {
+		if err := start(); err != nil {
+			return err
+		}
+		mu.Lock()
+		started = append(started, cmd.Process)
+		mu.Unlock()
+		return nil
+	}, nil)
+
+	// In raw mode, the terminal doesn't generate signals, so any signal
+	// was sent to this process deliberately.
+	sigs := make(chan os.Signal, 16)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				if !raw && (sig == syscall.SIGINT || sig == syscall.SIGQUIT) {
+					continue
+				}
+				mu.Lock()
+				for _, p := range started {
+					p.Signal(sig)
+				}
+				mu.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	c.onRelease(func() {
+		signal.Stop(sigs)
+		close(done)
+		setTermios(tty.Fd(), saved)
+		tty.Close()
+	})
+	return nil
+}
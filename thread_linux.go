@@ -0,0 +1,106 @@
+package pipes
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// threadStarts holds the commands being started on a thread locked by
+// startOnThread, so that options that each change the starting thread's
+// attributes, and are therefore nested, share one thread rather than each
+// starting the command on its own and losing the outer ones' attributes.
+var threadStarts = struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]*threadStart
+}{cmds: make(map[*exec.Cmd]*threadStart)}
+
+type threadStart struct {
+	// last holds the setups deferred by startOnThreadLast.
+	last []func() error
+}
+
+// startOnThread calls setup and then start on a dedicated, locked OS thread,
+// so that setup can change attributes of the thread that the child inherits
+// from it, e.g. capabilities, without affecting the rest of the process.
+// The thread is never unlocked, so the runtime discards it once done rather
+// than reusing it with attributes that differ from the rest of the process.
+// If cmd has a parent death signal, which is sent when the thread that
+// started the child exits, the thread is kept until release is called.  If
+// cmd is already being started on such a thread, i.e. by an outer start
+// hook, setup and start are called on it directly.
+func startOnThread(cmd *exec.Cmd, setup func() error, start func() error) (release func(), err error) {
+	threadStarts.Lock()
+	nested := threadStarts.cmds[cmd] != nil
+	threadStarts.Unlock()
+	if nested {
+		if err := setup(); err != nil {
+			return func() {}, err
+		}
+		return func() {}, start()
+	}
+
+	errc := make(chan error, 1)
+	done := make(chan struct{})
+
+	go func() {
+		runtime.LockOSThread()
+
+		threadStarts.Lock()
+		threadStarts.cmds[cmd] = &threadStart{}
+		threadStarts.Unlock()
+		err := setup()
+		if err == nil {
+			err = start()
+		}
+		threadStarts.Lock()
+		delete(threadStarts.cmds, cmd)
+		threadStarts.Unlock()
+
+		// Check once started, as start may have set the signal.
+		park := cmd.SysProcAttr != nil && cmd.SysProcAttr.Pdeathsig != 0
+		errc <- err
+		if err == nil && park {
+			<-done
+		}
+	}()
+
+	var once bool
+	return func() {
+		if !once {
+			once = true
+			close(done)
+		}
+	}, <-errc
+}
+
+// startOnThreadLast is like startOnThread, but calls setup only once the
+// setups of the start hooks nested in the caller's are done, just before
+// the child is forked, e.g. to drop privileges that they need.
+func startOnThreadLast(cmd *exec.Cmd, setup func() error, start func() error) (release func(), err error) {
+	return startOnThread(cmd, func() error {
+		threadStarts.Lock()
+		ts := threadStarts.cmds[cmd]
+		ts.last = append(ts.last, setup)
+		threadStarts.Unlock()
+		return nil
+	}, start)
+}
+
+// beforeFork calls the setups deferred by startOnThreadLast for cmd, on the
+// thread about to fork it, innermost first.
+func beforeFork(cmd *exec.Cmd) error {
+	threadStarts.Lock()
+	var last []func() error
+	if ts := threadStarts.cmds[cmd]; ts != nil {
+		last, ts.last = ts.last, nil
+	}
+	threadStarts.Unlock()
+
+	for i := len(last) - 1; i >= 0; i-- {
+		if err := last[i](); err != nil {
+			return err
+		}
+	}
+	return nil
+}
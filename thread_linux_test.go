@@ -0,0 +1,115 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// childStatus runs sh with opts, returning the fields of its
+// /proc/self/status and its umask.
+func childStatus(t *testing.T, opts ...Option) (map[string]string, string) {
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "cat /proc/self/status; echo Umask: $(umask)")
+	if _, err := (&Runner{}).Exec(context.Background(), cmd, append(opts, WithStdout(&out))...); err != nil {
+		t.Fatal(err)
+	}
+
+	status := make(map[string]string)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			status[line[:i]] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return status, status["Umask"]
+}
+
+func TestThreadOptionsCombined(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts []Option
+		want map[string]string
+		root bool
+	}{
+		{
+			name: "umask, no_new_privs",
+			opts: []Option{WithUmask(0077), WithNoNewPrivs()},
+			want: map[string]string{"Umask": "0077", "NoNewPrivs": "1"},
+		},
+		{
+			name: "no_new_privs, umask",
+			opts: []Option{WithNoNewPrivs(), WithUmask(0077)},
+			want: map[string]string{"Umask": "0077", "NoNewPrivs": "1"},
+		},
+		{
+			name: "affinity, umask, no_new_privs",
+			opts: []Option{WithCPUAffinity([]int{0}), WithUmask(0027), WithNoNewPrivs()},
+			want: map[string]string{"Cpus_allowed_list": "0", "Umask": "0027", "NoNewPrivs": "1"},
+		},
+		{
+			name: "capabilities, no_new_privs",
+			opts: []Option{WithDropCapabilities(nil), WithNoNewPrivs()},
+			want: map[string]string{"CapEff": "0000000000000000", "CapBnd": "0000000000000000", "NoNewPrivs": "1"},
+			root: true,
+		},
+		{
+			name: "no_new_privs, capabilities, umask",
+			opts: []Option{WithNoNewPrivs(), WithDropCapabilities(nil), WithUmask(0077)},
+			want: map[string]string{"CapEff": "0000000000000000", "CapBnd": "0000000000000000", "NoNewPrivs": "1", "Umask": "0077"},
+			root: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.root && os.Geteuid() != 0 {
+				t.Skip("requires root")
+			}
+			status, _ := childStatus(t, test.opts...)
+			for key, want := range test.want {
+				if got := status[key]; got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+
+	// The options don't affect this process.
+	status, umask := childStatus(t)
+	if status["NoNewPrivs"] != "0" {
+		t.Errorf("NoNewPrivs = %q after the options were used", status["NoNewPrivs"])
+	}
+	if umask == "0077" || umask == "0027" {
+		t.Errorf("umask = %q after the options were used", umask)
+	}
+}
+
+func TestDropCapabilitiesBeforeReadOnlyView(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	dir, err := ioutil.TempDir("", "pipes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The read-only view is set up with the capabilities dropped after
+	// it, regardless of the options' order.
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", "grep CapEff /proc/self/status; touch "+filepath.Join(dir, "f"))
+	var stdout bytes.Buffer
+	_, err = (&Runner{}).Exec(context.Background(), cmd, WithDropCapabilities(nil), WithReadOnlyView([]string{dir}, ""), WithStdout(&stdout), WithStderr(&stderr))
+	if err == nil {
+		t.Error("wrote to the read-only view")
+	}
+	if got := strings.Fields(stdout.String()); len(got) != 2 || got[1] != "0000000000000000" {
+		t.Errorf("child's capabilities = %q, want none", got)
+	}
+	if !strings.Contains(stderr.String(), "Read-only file system") {
+		t.Errorf("stderr = %q, want a read-only file system error", stderr.String())
+	}
+}
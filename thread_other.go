@@ -0,0 +1,10 @@
+//go:build !linux
+
+package pipes
+
+import "os/exec"
+
+// beforeFork does nothing, as only Linux starts commands on locked threads.
+func beforeFork(cmd *exec.Cmd) error {
+	return nil
+}
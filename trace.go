@@ -0,0 +1,45 @@
+package pipes
+
+import (
+	"io/ioutil"
+	"os/exec"
+)
+
+// WithTrace runs the commands at the given stages, or all commands if no
+// stages are given, under tracer, e.g. "strace" or "ltrace", with the given
+// flags, e.g. []string{"-f", "-tt"}, to debug failures that are hard to
+// reproduce without changing the code that builds the pipeline.  Each
+// command's trace is written to a new file in dir, or the default temporary
+// directory if dir is empty, whose path is available via the command's
+// StageResult.TraceFile.  The tracer must accept "-o file" and "--", as
+// strace and ltrace do.
+func WithTrace(tracer string, flags []string, dir string, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			path, err := exec.LookPath(tracer)
+			if err != nil {
+				return err
+			}
+			f, err := ioutil.TempFile(dir, "trace-")
+			if err != nil {
+				return err
+			}
+			f.Close()
+
+			i := stageIndex(c.cmds, cmd)
+			c.onResult(func(res *Result) {
+				res.Stages[i].TraceFile = f.Name()
+			})
+
+			// Restore the command once started, so that errors and
+			// the Result refer to the traced command, not the tracer.
+			origPath, origArgs := cmd.Path, cmd.Args
+			args := append([]string{tracer}, flags...)
+			args = append(args, "-o", f.Name(), "--", cmd.Path)
+			cmd.Path, cmd.Args = path, append(args, cmd.Args[1:]...)
+			err = start()
+			cmd.Path, cmd.Args = origPath, origArgs
+			return err
+		}, stages)
+	}
+}
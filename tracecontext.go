@@ -0,0 +1,82 @@
+package pipes
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// traceContextKey is the context key for the trace context set by
+// ContextWithTraceParent.
+type traceContextKey struct{}
+
+type traceContext struct {
+	traceparent string
+	tracestate  string
+}
+
+// ContextWithTraceParent returns a copy of ctx carrying the W3C trace
+// context given by the traceparent and tracestate headers, see
+// https://www.w3.org/TR/trace-context/, e.g. as received by a service, for
+// WithTraceContext.
+func ContextWithTraceParent(ctx context.Context, traceparent string, tracestate string) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, traceContext{traceparent, tracestate})
+}
+
+// WithTraceContext sets the environment variables TRACEPARENT and
+// TRACESTATE to the W3C trace context of the execution's context for the
+// commands at the given stages, or all commands if no stages are given, so
+// that instrumented commands, e.g. using OpenTelemetry, continue the trace.
+// The trace context is returned by extract, or set by
+// ContextWithTraceParent if extract is nil.  To propagate an OpenTelemetry
+// span:
+//
+//	pipes.WithTraceContext(func(ctx context.Context) (string, string) {
+//		carrier := propagation.MapCarrier{}
+//		propagation.TraceContext{}.Inject(ctx, carrier)
+//		return carrier["traceparent"], carrier["tracestate"]
+//	})
+//
+// Commands inherit the variables from this process's environment as usual
+// if the context carries no valid trace context.
+func WithTraceContext(extract func(ctx context.Context) (traceparent string, tracestate string), stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			var tc traceContext
+			if extract != nil {
+				tc.traceparent, tc.tracestate = extract(c.runCtx)
+			} else {
+				tc, _ = c.runCtx.Value(traceContextKey{}).(traceContext)
+			}
+			if validTraceParent(tc.traceparent) {
+				setEnv(cmd, "TRACEPARENT", tc.traceparent)
+				if tc.tracestate != "" {
+					setEnv(cmd, "TRACESTATE", tc.tracestate)
+				} else {
+					// Don't pair the new parent with an unrelated state.
+					cmd.Env = withoutEnv(cmd, "TRACESTATE")
+				}
+			}
+			return start()
+		}, stages)
+	}
+}
+
+// validTraceParent reports whether traceparent is a well-formed version 00
+// traceparent header, with non-zero trace and parent IDs.
+func validTraceParent(traceparent string) bool {
+	fields := strings.Split(traceparent, "-")
+	if len(fields) != 4 || fields[0] != "00" {
+		return false
+	}
+	for i, n := range []int{2, 32, 16, 2} {
+		f := fields[i]
+		if len(f) != n || strings.Trim(f, "0123456789abcdef") != "" {
+			return false
+		}
+		if (i == 1 || i == 2) && strings.Trim(f, "0") == "" {
+			return false
+		}
+	}
+	return true
+}
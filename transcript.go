@@ -0,0 +1,121 @@
+package pipes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// castHeader is the header line of an asciinema v2 cast.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Transcript records interactive sessions run under a pty, see WithPTY, as
+// an asciinema v2 cast, with the timing of the terminal's output and input,
+// and as a plain typescript of the output, like script(1).  Sessions
+// recorded by the same Transcript are appended to the same recording.
+type Transcript struct {
+	cast       io.Writer
+	typescript io.Writer
+
+	mu      sync.Mutex
+	started bool
+	start   time.Time
+	partial map[string][]byte
+	err     error
+}
+
+// NewTranscript returns a Transcript writing a cast to cast and a
+// typescript to typescript, either of which may be nil.
+func NewTranscript(cast io.Writer, typescript io.Writer) *Transcript {
+	return &Transcript{cast: cast, typescript: typescript, partial: make(map[string][]byte)}
+}
+
+func (t *Transcript) write(w io.Writer, p []byte) {
+	if w == nil || t.err != nil {
+		return
+	}
+	_, t.err = w.Write(p)
+}
+
+// begin writes the headers, unless already written by an earlier session.
+func (t *Transcript) begin(width int, height int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		return
+	}
+	t.started, t.start = true, time.Now()
+
+	header := castHeader{Version: 2, Width: width, Height: height, Timestamp: t.start.Unix()}
+	if term := os.Getenv("TERM"); term != "" {
+		header.Env = map[string]string{"TERM": term}
+	}
+	data, _ := json.Marshal(header)
+	t.write(t.cast, append(data, '\n'))
+	t.write(t.typescript, []byte(fmt.Sprintf("Script started on %s\n", t.start.Format("2006-01-02 15:04:05-07:00"))))
+}
+
+// record records p as an event of the given type, "o" for output or "i" for
+// input.  An incomplete UTF-8 sequence at the end of p is held back until
+// the next event of the same type, as casts are JSON.
+func (t *Transcript) record(typ string, p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if typ == "o" {
+		t.write(t.typescript, p)
+	}
+
+	data := append(t.partial[typ], p...)
+	n := len(data)
+	for i := 1; i <= utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				n = len(data) - i
+			}
+			break
+		}
+	}
+	t.partial[typ] = append([]byte(nil), data[n:]...)
+	if n == 0 {
+		return
+	}
+
+	event, _ := json.Marshal([]interface{}{time.Since(t.start).Seconds(), typ, string(data[:n])})
+	t.write(t.cast, append(event, '\n'))
+}
+
+// Close completes the typescript and returns the first error writing the
+// recording, if any.
+func (t *Transcript) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		t.write(t.typescript, []byte(fmt.Sprintf("\nScript done on %s\n", time.Now().Format("2006-01-02 15:04:05-07:00"))))
+	}
+	return t.err
+}
+
+// transcriptWriter records writes to w as events of type typ.
+type transcriptWriter struct {
+	w   io.Writer
+	t   *Transcript
+	typ string
+}
+
+func (w *transcriptWriter) Write(p []byte) (int, error) {
+	w.t.record(w.typ, p)
+	return w.w.Write(p)
+}
@@ -0,0 +1,85 @@
+package pipes
+
+import "regexp"
+
+// Match is a line of output that matched a trigger's pattern, see
+// WithTrigger.
+type Match struct {
+	// Stream is "stdout" or "stderr".
+	Stream string
+	// Line is the matching line or record, without its terminator.
+	Line string
+	// Submatches are the match and its submatches, as by
+	// Regexp.FindStringSubmatch.
+	Submatches []string
+
+	c *config
+}
+
+// Cancel kills the pipeline, failing the execution with err, wrapped, e.g.
+// because the output reports a fatal error.
+func (m *Match) Cancel(err error) {
+	m.c.abort(err)
+}
+
+// WithTrigger calls action for each line of the output from the last
+// command, if stream is "stdout", or of all commands' Stderr output, if
+// stream is "stderr", or of both if stream is empty, that matches re, e.g.
+// to cancel the pipeline if "FATAL" appears, to mark a server as ready once
+// "listening on" appears, see Readiness, to emit an event or to start a
+// dependent pipeline.  Actions are called synchronously while the output is
+// written, so they must not block for long.  A trailing partial line is
+// matched once the pipeline completes.
+func WithTrigger(stream string, re *regexp.Regexp, action func(m *Match)) Option {
+	return WithRecordTrigger(stream, '\n', re, action)
+}
+
+// WithRecordTrigger is like WithTrigger, but matches records terminated by
+// delim, e.g. NUL for `find -print0`, instead of lines.
+func WithRecordTrigger(stream string, delim byte, re *regexp.Regexp, action func(m *Match)) Option {
+	return func(c *config) {
+		var lws []*lineWriter
+		watch := func(name string) *lineWriter {
+			lw := newRecordWriter(delim, func(line []byte) {
+				if sub := re.FindSubmatch(line); sub != nil {
+					m := &Match{Stream: name, Line: string(line), c: c}
+					for _, s := range sub {
+						m.Submatches = append(m.Submatches, string(s))
+					}
+					action(m)
+				}
+			})
+			lws = append(lws, lw)
+			return lw
+		}
+
+		c.onSetup(func(c *config) error {
+			if stream == "" || stream == "stdout" {
+				c.stdout = teeWriter(c.stdout, watch("stdout"))
+			}
+			if stream == "" || stream == "stderr" {
+				c.stderr = teeWriter(c.stderr, watch("stderr"))
+			}
+			return nil
+		})
+		c.onRelease(func() {
+			for _, lw := range lws {
+				lw.flush()
+			}
+		})
+	}
+}
+
+// MarkReady returns a trigger action that marks r as ready.
+func MarkReady(r *Readiness) func(m *Match) {
+	return func(m *Match) {
+		r.Mark()
+	}
+}
+
+// CancelWith returns a trigger action that cancels the pipeline with err.
+func CancelWith(err error) func(m *Match) {
+	return func(m *Match) {
+		m.Cancel(err)
+	}
+}
@@ -0,0 +1,47 @@
+package pipes
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestWithTrigger(t *testing.T) {
+	var matches []string
+	record := func(m *Match) {
+		matches = append(matches, m.Stream+":"+m.Submatches[1])
+	}
+	cmd := exec.Command("sh", "-c", "echo ok 1; echo ok 2 >&2; echo no; printf 'ok 3'")
+	if _, err := (&Runner{}).Exec(context.Background(), cmd, WithStdout(ioutil.Discard), WithStderr(ioutil.Discard), WithTrigger("", regexp.MustCompile(`^ok (\d)$`), record)); err != nil {
+		t.Fatal(err)
+	}
+	// The trailing partial line is matched once the pipeline completes.
+	sort.Strings(matches)
+	if want := []string{"stderr:2", "stdout:1", "stdout:3"}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("matches = %q, want %q", matches, want)
+	}
+
+	errFatal := errors.New("fatal")
+	cmd = exec.Command("sh", "-c", "echo FATAL; exec sleep 10")
+	if _, err := (&Runner{}).Exec(context.Background(), cmd, WithStdout(ioutil.Discard), WithTrigger("stdout", regexp.MustCompile("FATAL"), CancelWith(errFatal))); !errors.Is(err, errFatal) {
+		t.Errorf("error = %v, want %v", err, errFatal)
+	}
+}
+
+func TestWithRecordTrigger(t *testing.T) {
+	var matches []string
+	cmd := exec.Command("printf", `a\nb\0c\0`)
+	if _, err := (&Runner{}).Exec(context.Background(), cmd, WithStdout(ioutil.Discard), WithRecordTrigger("stdout", 0, regexp.MustCompile("."), func(m *Match) {
+		matches = append(matches, m.Line)
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a\nb", "c"}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("matches = %q, want %q", matches, want)
+	}
+}
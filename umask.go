@@ -0,0 +1,22 @@
+package pipes
+
+import (
+	"os"
+	"os/exec"
+)
+
+// WithUmask sets the umask of the commands at the given stages, or of all
+// commands if no stages are given, so that the files they create have
+// predictable permissions regardless of this process's umask.  Stages are
+// zero-based indexes into the pipeline.  Not supported on Windows.
+func WithUmask(mask os.FileMode, stages ...int) Option {
+	return func(c *config) {
+		c.onStart(func(cmd *exec.Cmd, start func() error) error {
+			release, err := startWithUmask(cmd, int(mask.Perm()), start)
+			if err == nil {
+				c.onRelease(release)
+			}
+			return err
+		}, stages)
+	}
+}
@@ -0,0 +1,29 @@
+package pipes
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startWithUmask calls start with the umask set to mask.  The umask is part
+// of a thread's filesystem attributes on Linux, which the child inherits
+// from the thread that forks it, so start is called on a thread that stops
+// sharing its filesystem attributes with the rest of the process before
+// setting its umask, see startOnThread, leaving this process's umask
+// untouched.  Falls back to setting the process-wide umask if unsharing
+// isn't permitted.
+func startWithUmask(cmd *exec.Cmd, mask int, start func() error) (func(), error) {
+	unshared := true
+	release, err := startOnThread(cmd, func() error {
+		if err := syscall.Unshare(syscall.CLONE_FS); err != nil {
+			unshared = false
+			return err
+		}
+		syscall.Umask(mask)
+		return nil
+	}, start)
+	if !unshared {
+		return func() {}, startWithProcessUmask(mask, start)
+	}
+	return release, err
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package pipes
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// startWithUmask fails, as this platform doesn't have a umask.
+func startWithUmask(cmd *exec.Cmd, mask int, start func() error) (func(), error) {
+	return nil, errors.New("umask not supported on this platform")
+}
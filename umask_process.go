@@ -0,0 +1,13 @@
+//go:build unix && !linux
+
+package pipes
+
+import (
+	"os/exec"
+)
+
+// startWithUmask calls start with the umask set to mask, which is
+// process-wide on this platform, see startWithProcessUmask.
+func startWithUmask(cmd *exec.Cmd, mask int, start func() error) (func(), error) {
+	return func() {}, startWithProcessUmask(mask, start)
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package pipes
+
+import (
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes changes to the process-wide umask.
+var umaskMu sync.Mutex
+
+// startWithProcessUmask calls start with the process-wide umask set to mask,
+// restoring it once start returns, by which point the child has inherited
+// it.  Files created by this process while start runs also get mask, which
+// is unavoidable where the umask is process-wide.
+func startWithProcessUmask(mask int, start func() error) error {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return start()
+}
@@ -0,0 +1,73 @@
+package pipes
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Usage summarizes the resources consumed by a command, like GNU time -v,
+// see WithUsage.  Fields are zero if unavailable on this platform.
+type Usage struct {
+	MinorFaults            int64 `json:"minor_faults"`
+	MajorFaults            int64 `json:"major_faults"`
+	VoluntaryCtxSwitches   int64 `json:"voluntary_ctx_switches"`
+	InvoluntaryCtxSwitches int64 `json:"involuntary_ctx_switches"`
+	// BlockInput and BlockOutput count file system inputs and outputs.
+	BlockInput  int64 `json:"block_input"`
+	BlockOutput int64 `json:"block_output"`
+	// ReadBytes and WriteBytes count the bytes read and written by the
+	// command via any kind of file, including pipes, and are only
+	// available on Linux.
+	ReadBytes  int64 `json:"read_bytes"`
+	WriteBytes int64 `json:"write_bytes"`
+}
+
+// WithUsage collects a Usage summary for each command, available via the
+// command's StageResult.Usage, and rendered by Result.UsageSummary, to
+// guide optimizing pipelines.
+func WithUsage() Option {
+	return func(c *config) {
+		c.onWait(func(cmd *exec.Cmd, wait func() error) error {
+			counters := snapshotIO(cmd)
+			err := wait()
+
+			i := stageIndex(c.cmds, cmd)
+			u := newUsage(cmd.ProcessState)
+			if u != nil && counters != nil {
+				u.ReadBytes, u.WriteBytes = counters.readBytes, counters.writeBytes
+			}
+			c.onResult(func(res *Result) {
+				res.Stages[i].Usage = u
+			})
+			return err
+		}, nil)
+	}
+}
+
+// UsageSummary renders the resource usage of each command, if collected,
+// in the style of GNU time -v.
+func (r *Result) UsageSummary() string {
+	var sb strings.Builder
+	for _, stage := range r.Stages {
+		fmt.Fprintf(&sb, "Command: %s\n", strings.Join(stage.Args, " "))
+		fmt.Fprintf(&sb, "\tExit status: %d\n", stage.ExitCode)
+		fmt.Fprintf(&sb, "\tUser time (seconds): %.2f\n", stage.UserTime.Seconds())
+		fmt.Fprintf(&sb, "\tSystem time (seconds): %.2f\n", stage.SystemTime.Seconds())
+		fmt.Fprintf(&sb, "\tMaximum resident set size (kbytes): %d\n", stage.MaxRSS/1024)
+
+		u := stage.Usage
+		if u == nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "\tMajor (requiring I/O) page faults: %d\n", u.MajorFaults)
+		fmt.Fprintf(&sb, "\tMinor (reclaiming a frame) page faults: %d\n", u.MinorFaults)
+		fmt.Fprintf(&sb, "\tVoluntary context switches: %d\n", u.VoluntaryCtxSwitches)
+		fmt.Fprintf(&sb, "\tInvoluntary context switches: %d\n", u.InvoluntaryCtxSwitches)
+		fmt.Fprintf(&sb, "\tFile system inputs: %d\n", u.BlockInput)
+		fmt.Fprintf(&sb, "\tFile system outputs: %d\n", u.BlockOutput)
+		fmt.Fprintf(&sb, "\tBytes read: %d\n", u.ReadBytes)
+		fmt.Fprintf(&sb, "\tBytes written: %d\n", u.WriteBytes)
+	}
+	return sb.String()
+}
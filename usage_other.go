@@ -0,0 +1,18 @@
+//go:build !unix
+
+package pipes
+
+import "os"
+
+// maxRSS is unavailable on this platform.
+func maxRSS(ps *os.ProcessState) int64 {
+	return 0
+}
+
+// newUsage returns an empty Usage, as it is unavailable on this platform.
+func newUsage(ps *os.ProcessState) *Usage {
+	if ps == nil {
+		return nil
+	}
+	return &Usage{}
+}
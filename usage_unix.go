@@ -0,0 +1,43 @@
+//go:build unix
+
+package pipes
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// maxRSS returns the peak resident set size, in bytes, of the process
+// described by ps.
+func maxRSS(ps *os.ProcessState) int64 {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// Darwin reports bytes, everyone else reports kilobytes.
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return int64(ru.Maxrss)
+	}
+	return int64(ru.Maxrss) * 1024
+}
+
+// newUsage returns the Usage of the process described by ps, or nil if it
+// wasn't started.
+func newUsage(ps *os.ProcessState) *Usage {
+	if ps == nil {
+		return nil
+	}
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return nil
+	}
+	return &Usage{
+		MinorFaults:            int64(ru.Minflt),
+		MajorFaults:            int64(ru.Majflt),
+		VoluntaryCtxSwitches:   int64(ru.Nvcsw),
+		InvoluntaryCtxSwitches: int64(ru.Nivcsw),
+		BlockInput:             int64(ru.Inblock),
+		BlockOutput:            int64(ru.Oublock),
+	}
+}
@@ -0,0 +1,163 @@
+package pipes
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ChangeSource reports changes to watched files, e.g. a PollWatcher or an
+// fsnotify watcher via the pipesfsnotify package.
+type ChangeSource interface {
+	// Changes returns a channel that receives the paths of changed
+	// files and is closed once the source is closed.
+	Changes() <-chan string
+}
+
+// Watch executes the pipeline returned by cmds and re-executes it whenever
+// src reports a change, e.g. for a build or test loop.  Changes are
+// debounced: the pipeline is re-executed once no change has been reported
+// for debounce, as measured by the Runner's Clock, so that saving several
+// files triggers a single execution.  An execution still in flight is
+// canceled before the next starts.  fn is called with the Result and error
+// of every execution, including canceled ones.  Watch returns once ctx is
+// done, after canceling the execution in flight, or once src is closed,
+// after the execution in flight completes.
+func (r *Runner) Watch(ctx context.Context, src ChangeSource, debounce time.Duration, cmds func() []*exec.Cmd, fn func(res *Result, err error), opts ...Option) {
+	clock := clockOrReal(r.Clock)
+
+	var cancel context.CancelFunc
+	var done chan struct{}
+	start := func() {
+		var runCtx context.Context
+		runCtx, cancel = context.WithCancel(ctx)
+		done = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			fn(r.ExecPipeline(runCtx, cmds(), opts...))
+		}(done)
+	}
+	start()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case _, ok := <-src.Changes():
+			if !ok {
+				<-done
+				cancel()
+				return
+			}
+			settled = clock.After(debounce)
+		case <-settled:
+			settled = nil
+			cancel()
+			<-done
+			start()
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		}
+	}
+}
+
+// fileState is what a PollWatcher compares to detect changes.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+}
+
+// PollWatcher is a ChangeSource that polls files and directory trees for
+// changes to their modification times, sizes and modes, and for files being
+// created or removed.  It needs no platform support but scales poorly to
+// large trees.
+type PollWatcher struct {
+	paths    []string
+	interval time.Duration
+	changes  chan string
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewPollWatcher returns a PollWatcher polling the given files and
+// directory trees every interval.
+func NewPollWatcher(interval time.Duration, paths ...string) *PollWatcher {
+	w := &PollWatcher{
+		paths:    paths,
+		interval: interval,
+		changes:  make(chan string, 64),
+		stop:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *PollWatcher) snapshot() map[string]fileState {
+	files := make(map[string]fileState)
+	for _, root := range w.paths {
+		filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err == nil {
+				files[path] = fileState{fi.ModTime(), fi.Size(), fi.Mode()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+func (w *PollWatcher) run() {
+	defer close(w.changes)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	files := w.snapshot()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+
+		now := w.snapshot()
+		for path, state := range now {
+			if old, ok := files[path]; !ok || old != state {
+				w.report(path)
+			}
+		}
+		for path := range files {
+			if _, ok := now[path]; !ok {
+				w.report(path)
+			}
+		}
+		files = now
+	}
+}
+
+// report reports a changed path, dropping it if the consumer is far behind,
+// which is harmless as a single change triggers a re-execution.
+func (w *PollWatcher) report(path string) {
+	select {
+	case w.changes <- path:
+	default:
+	}
+}
+
+// Changes returns a channel that receives the paths of changed files.
+func (w *PollWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Close stops polling and closes the Changes channel.
+func (w *PollWatcher) Close() error {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	return nil
+}
@@ -0,0 +1,71 @@
+package pipes
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// copyFS copies the files and directories in fsys into dir.
+func copyFS(dir string, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if d.IsDir() {
+			if name == "." {
+				return nil
+			}
+			return os.Mkdir(path, 0755)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		src, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err = copyStream(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+		return dst.Close()
+	})
+}
+
+// WithTempWorkdir runs every command in a new temporary directory, which is
+// populated with a copy of fsys if fsys is non-nil, for tools that insist on
+// writing into their working directory.  The directory is available via
+// Result.Workdir so that the caller can collect the commands' output, and
+// is removed by Result.Close.
+func WithTempWorkdir(fsys fs.FS) Option {
+	return func(c *config) {
+		c.onSetup(func(c *config) error {
+			dir, err := ioutil.TempDir("", "pipes-")
+			if err != nil {
+				return err
+			}
+			if fsys != nil {
+				if err = copyFS(dir, fsys); err != nil {
+					os.RemoveAll(dir)
+					return err
+				}
+			}
+			for _, cmd := range c.cmds {
+				cmd.Dir = dir
+			}
+			c.workdir = dir
+			return nil
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package pipes
+
+import (
+	"io"
+	"os"
+)
+
+// copyStream copies from src to dst like io.Copy, but moves the data within
+// the kernel if both are files and the platform supports it, e.g. via
+// sendfile(2) from a file to a command's stdin pipe or splice(2) from a
+// command's output pipe to a file, avoiding copies through this process.
+func copyStream(dst io.Writer, src io.Reader) (int64, error) {
+	df, dok := dst.(*os.File)
+	sf, sok := src.(*os.File)
+	if dok && sok {
+		if n, handled, err := zeroCopy(df, sf); handled {
+			return n, err
+		} else if n > 0 {
+			m, err := io.Copy(dst, src)
+			return n + m, err
+		}
+	}
+	return io.Copy(dst, src)
+}
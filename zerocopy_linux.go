@@ -0,0 +1,94 @@
+package pipes
+
+import (
+	"os"
+	"syscall"
+)
+
+// zeroCopyChunk is the most moved by a single sendfile or splice call.
+const zeroCopyChunk = 1 << 30
+
+// zeroCopy moves data from src to dst within the kernel, via sendfile(2) if
+// src is a regular file or splice(2) if src is a pipe and dst a regular
+// file.  handled is false if neither applies, or the kernel refuses, in
+// which case the remaining data, after n bytes, must be copied by the
+// caller.
+func zeroCopy(dst *os.File, src *os.File) (n int64, handled bool, err error) {
+	si, err := src.Stat()
+	if err != nil {
+		return 0, false, nil
+	}
+	di, err := dst.Stat()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	src2, err := src.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+	dst2, err := dst.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	// Wait on the end that is a pipe, which is non-blocking if created
+	// by os.Pipe, the other end being a regular file.
+	var m int
+	var merr error
+	var name string
+	var move func() error
+	switch {
+	case si.Mode().IsRegular():
+		name = "sendfile"
+		move = func() error {
+			return dst2.Write(func(dfd uintptr) bool {
+				if err := src2.Control(func(sfd uintptr) {
+					m, merr = syscall.Sendfile(int(dfd), int(sfd), nil, zeroCopyChunk)
+				}); err != nil {
+					merr = err
+				}
+				return merr != syscall.EAGAIN
+			})
+		}
+	case si.Mode()&os.ModeNamedPipe != 0 && di.Mode().IsRegular():
+		name = "splice"
+		move = func() error {
+			return src2.Read(func(sfd uintptr) bool {
+				if err := dst2.Control(func(dfd uintptr) {
+					// The count is an int64, or an int on 32-bit
+					// platforms.
+					moved, err := syscall.Splice(int(sfd), nil, int(dfd), nil, zeroCopyChunk, 0)
+					m, merr = int(moved), err
+				}); err != nil {
+					merr = err
+				}
+				return merr != syscall.EAGAIN
+			})
+		}
+	default:
+		return 0, false, nil
+	}
+
+	for {
+		m, merr = 0, nil
+		if err = move(); err == nil {
+			err = merr
+		}
+
+		switch {
+		case err == nil && m > 0:
+			n += int64(m)
+			continue
+		case err == nil:
+			return n, true, nil
+		case n == 0 && (err == syscall.EINVAL || err == syscall.ENOSYS || err == syscall.EOPNOTSUPP || err == syscall.EXDEV):
+			return 0, false, nil
+		case err == syscall.EPIPE:
+			// Report the command having exited early as a write
+			// would, which os/exec ignores for stdin.
+			return n, true, &os.PathError{Op: "write", Path: dst.Name(), Err: err}
+		}
+		return n, true, os.NewSyscallError(name, err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package pipes
+
+import "os"
+
+// zeroCopy moves data within the kernel, which isn't supported on this
+// platform.
+func zeroCopy(dst *os.File, src *os.File) (n int64, handled bool, err error) {
+	return 0, false, nil
+}